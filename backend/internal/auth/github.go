@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+// GitHubConfig は GitHub OAuth App の設定
+type GitHubConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	APIURL       string // 未指定の場合は https://api.github.com
+	AuthURL      string // GitHub Enterprise やモックサーバーを使う場合に指定（任意）
+	TokenURL     string
+}
+
+// GitHubProvider は GitHub の OAuth2.0 プロバイダ
+// GitHub は OIDC に対応していないため、ID トークンの代わりに API からユーザー情報を取得する
+type GitHubProvider struct {
+	config     *oauth2.Config
+	apiURL     string
+	httpClient *http.Client
+}
+
+// NewGitHubProvider は GitHubProvider を生成
+func NewGitHubProvider(cfg GitHubConfig, httpClient *http.Client) *GitHubProvider {
+	endpoint := github.Endpoint
+	if cfg.AuthURL != "" && cfg.TokenURL != "" {
+		endpoint = oauth2.Endpoint{AuthURL: cfg.AuthURL, TokenURL: cfg.TokenURL}
+	}
+	apiURL := strings.TrimSuffix(cfg.APIURL, "/")
+	if apiURL == "" {
+		apiURL = "https://api.github.com"
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &GitHubProvider{
+		config: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       []string{"read:user", "user:email"},
+			Endpoint:     endpoint,
+		},
+		apiURL:     apiURL,
+		httpClient: httpClient,
+	}
+}
+
+func (p *GitHubProvider) Name() string {
+	return "github"
+}
+
+// AuthCodeURL GitHub は nonce を使わないため、state と PKCE のみで検証する
+func (p *GitHubProvider) AuthCodeURL(ctx context.Context, state, codeVerifier, nonce string) (string, error) {
+	return p.config.AuthCodeURL(state, oauth2.S256ChallengeOption(codeVerifier)), nil
+}
+
+func (p *GitHubProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*ExternalIdentity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.httpClient)
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange token: %w", err)
+	}
+
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := getJSON(ctx, p.httpClient, p.apiURL+"/user", token.AccessToken, &user); err != nil {
+		return nil, fmt.Errorf("failed to get github user: %w", err)
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("github user id is empty")
+	}
+
+	identity := &ExternalIdentity{
+		Provider: p.Name(),
+		Subject:  strconv.FormatInt(user.ID, 10), // login は変更できるので、不変の数値IDを使う
+		Name:     user.Name,
+		Picture:  user.AvatarURL,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+
+	// 公開設定に関係なく、確認済みのプライマリメールアドレスを取得する
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, p.httpClient, p.apiURL+"/user/emails", token.AccessToken, &emails); err != nil {
+		return nil, fmt.Errorf("failed to get github emails: %w", err)
+	}
+	for _, e := range emails {
+		if e.Primary {
+			identity.Email = e.Email
+			identity.EmailVerified = e.Verified
+			break
+		}
+	}
+	return identity, nil
+}
@@ -1,218 +1,366 @@
 package auth
 
 import (
+	"OnlineLearningWebApp/pkg/rbac"
+	"OnlineLearningWebApp/pkg/session"
 	"OnlineLearningWebApp/pkg/utils"
-	"context"
-	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 	"gorm.io/gorm"
 )
 
 // AuthHandler は認証関連の処理を提供する構造体
 type AuthHandler struct {
-	DB  *gorm.DB
-	RDB *redis.Client
+	DB        *gorm.DB
+	RDB       *redis.Client
+	Sessions  *session.Store
+	Providers *ProviderRegistry
+	states    *oauthStateStore
 }
 
 // NewAuthHandler は AuthHandler を生成
-func NewAuthHandler(db *gorm.DB, rdb *redis.Client) *AuthHandler {
-	return &AuthHandler{DB: db, RDB: rdb}
+func NewAuthHandler(db *gorm.DB, rdb *redis.Client, providers *ProviderRegistry) *AuthHandler {
+	return &AuthHandler{
+		DB:        db,
+		RDB:       rdb,
+		Sessions:  session.NewStore(rdb),
+		Providers: providers,
+		states:    &oauthStateStore{rdb: rdb},
+	}
+}
+
+// リフレッシュトークンを入れるクッキー名（/api/auth 配下にだけ送られるようにする）
+const refreshTokenCookieName = "refresh_token"
+
+// GetProviders はログインに使えるプロバイダの一覧を返す
+func (h *AuthHandler) GetProviders(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"providers": h.Providers.Names()})
 }
 
-// OAuth2の設定
-var googleOAuthConfig = &oauth2.Config{
-	// なぜか環境変数を読み込むようにするでは、うまく動かない...
-	// exportして手動で設定してもダメだったので、とりあえずハードコードする
-	//ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-	//ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-	//RedirectURL:  os.Getenv("GOOGLE_REDIRECT_URL"),
-	ClientID:     "",
-	ClientSecret: "",
-	RedirectURL:  "",
-	Scopes:       []string{"openid", "profile", "email"},
-	Endpoint:     google.Endpoint,
+// StartLogin はプロバイダの認可URLを返す
+// state・PKCE の code_verifier・nonce はサーバー側（Redis）に保存し、コールバック時に検証する
+func (h *AuthHandler) StartLogin(c echo.Context) error {
+	return h.startAuthorization(c, "")
+}
+
+// StartLink はログイン中のユーザーにプロバイダを紐付けるための認可URLを返す（JWT認証）
+func (h *AuthHandler) StartLink(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+	return h.startAuthorization(c, userID)
+}
+
+func (h *AuthHandler) startAuthorization(c echo.Context, linkUserID string) error {
+	provider, err := h.Providers.Get(c.Param("provider"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Unknown provider"})
+	}
+
+	ctx := c.Request().Context()
+	state, data, err := h.states.Create(ctx, provider.Name(), linkUserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to create state"})
+	}
+	authURL, err := provider.AuthCodeURL(ctx, state, data.CodeVerifier, data.Nonce)
+	if err != nil {
+		log.Println("Failed to build authorization URL:", err)
+		return c.JSON(http.StatusBadGateway, echo.Map{"error": "Failed to contact provider"})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"authUrl": authURL,
+		"state":   state,
+	})
 }
 
 // Login はOAuth2.0でログインし、セッションを作成する
+// /api/auth/:provider/callback と、従来の /api/auth/login（provider クエリ、省略時は google）の両方で使う
+// state が StartLink で作られたものの場合は、ログインではなくプロバイダの紐付けを行う
 func (h *AuthHandler) Login(c echo.Context) error {
+	providerName := c.Param("provider")
+	if providerName == "" {
+		providerName = c.QueryParam("provider")
+	}
+	if providerName == "" {
+		providerName = "google"
+	}
+	provider, err := h.Providers.Get(providerName)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Unknown provider"})
+	}
 
 	code := c.QueryParam("code")
 	if code == "" {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Authorization code is required"})
 	}
 
-	// Google OAuth2.0 でアクセストークンを取得
-	// ここでは、googleOAuthConfigに設定したリダイレクトURLは使用されない。
-	// リダイレクトURLは、認証コードを送信する際に使用されるため、認証コード→アクセストークンへの返還の際には使用されない。
-	// ダイレクトにtokenに入ってくるはず。
-	// なぜ認証コード→アクセストークンの処理ではリダイレクトURLを使用しないのに、リダイレクトURLを設定しておく必要があるのかというと、
-	// GoogleのOAuthの仕様では、アクセストークンに交換するときに、Google Cloud Consoleに登録されたリダイレクトURLとリクエスト時に指定した
-	// リダイレクトURLが一致していることを確認するチェックが行われるため。
-	// つまり、リダイレクトは発生しないが、Googleは「このリダイレクトURLを使って認証を開始したんだな？」と確認するために必要ということ。
-	token, err := googleOAuthConfig.Exchange(context.Background(), code)
+	// state を検証（1回しか使えない）
+	ctx := c.Request().Context()
+	state, err := h.states.Consume(ctx, c.QueryParam("state"), provider.Name())
+	if errors.Is(err, ErrInvalidOAuthState) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid or expired state"})
+	}
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to exchange token"})
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to verify state"})
 	}
 
-	// Googleのユーザー情報を取得
-	userInfo, err := getGoogleUserInfo(token.AccessToken)
+	// 認可コード→トークンの交換（PKCE の code_verifier を送る）と、ID トークン（nonce）の検証
+	identity, err := provider.Exchange(ctx, code, state.CodeVerifier, state.Nonce)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to get user info"})
+		log.Printf("Failed to exchange token with %s: %v", provider.Name(), err)
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Failed to exchange token"})
 	}
 
-	userID := userInfo.Sub // Googleの一意なユーザーID
+	// ログイン中のユーザーへの紐付け
+	if state.LinkUserID != "" {
+		if err := linkIdentity(h.DB, state.LinkUserID, identity); err != nil {
+			if errors.Is(err, ErrIdentityLinkedToOtherUser) {
+				return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+			}
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to link provider"})
+		}
+		return c.JSON(http.StatusOK, echo.Map{
+			"message":  "Provider linked",
+			"provider": provider.Name(),
+		})
+	}
 
-	// ユーザーがDBに存在するか確認（なければ登録）
-	if err2 := ensureUserExists(h.DB, userID, userInfo.Email, userInfo.Name, userInfo.Picture); err2 != nil {
+	// ユーザーを特定（なければ登録）
+	user, _, err := resolveUser(h.DB, identity)
+	if errors.Is(err, ErrEmailAlreadyRegistered) {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "This email is already registered. Please log in with your existing account and link this provider."})
+	}
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to create user"})
 	}
 
-	// ユーザーがDBに存在する場合、その情報をクライアントに返す
-	var user User
-	var count int64
-	if err := h.DB.Table("online_learning_users").Where("id = ?", userID).Count(&count).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to get user count"})
+	// セッションを作成し、アクセストークンとリフレッシュトークンを発行
+	jwtToken, err := h.issueSession(c, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to create session"})
 	}
-	if count > 0 {
-		if err := h.DB.Table("online_learning_users").Where("id = ?", userID).Find(&user).Error; err != nil {
-			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to bind request"})
-		}
+
+	// 画像はプロバイダ側で変わることがあるので、DBに無ければプロバイダのものを返す
+	picURL := user.Avatar
+	if picURL == "" {
+		picURL = identity.Picture
+	}
+	data := map[string]interface{}{
+		"name":   user.Name,
+		"email":  user.Email,
+		"picUrl": picURL,
 	}
 
-	// セッションIDをUUIDで生成
-	sessionID := uuid.New().String()
+	// JWT は JSON レスポンスで返す
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Login successful",
+		"token":   jwtToken,
+		"user":    data,
+	})
 
-	// Redisにセッション情報を保存（1日有効）
-	err = h.RDB.Set(context.Background(), sessionID, userID, 24*time.Hour).Err()
+}
+
+// GetIdentities はログイン中のユーザーに紐付いているプロバイダの一覧を返す（JWT認証）
+func (h *AuthHandler) GetIdentities(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to create session"})
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
 	}
+	identities, err := listIdentities(h.DB, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"identities": identities})
+}
 
-	// JWTを発行
-	jwtToken, err := utils.GenerateToken(userID)
+// Unlink はプロバイダの紐付けを解除する（JWT認証）
+func (h *AuthHandler) Unlink(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to generate token"})
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
 	}
+	if err := unlinkIdentity(h.DB, userID, c.Param("provider")); err != nil {
+		if errors.Is(err, ErrLastIdentity) {
+			return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "Provider unlinked"})
+}
 
-	// セッションIDを `HttpOnly` クッキーに保存
-	c.SetCookie(&http.Cookie{
-		Name:     "session_id",
-		Value:    sessionID,
-		Path:     "/",
-		HttpOnly: false,                   // JavaScript からアクセス不可→アクセス許可に変える。そうでないとJWTでセッション管理することになり。セッションIDがある意味がなくなるので。
-		Secure:   false,                   // 本番環境では true にする（HTTPS 必須）
-		SameSite: http.SameSiteStrictMode, // CSRF 対策
-		MaxAge:   86400,                   // 1日
-	})
+// Refresh はリフレッシュトークンをローテーションして、新しいアクセストークンを発行する
+// 使用済みのリフレッシュトークンが使われた場合は、セッションごと失効させる
+func (h *AuthHandler) Refresh(c echo.Context) error {
+	refreshToken := c.FormValue(refreshTokenCookieName)
+	if cookie, err := c.Cookie(refreshTokenCookieName); err == nil && cookie.Value != "" {
+		refreshToken = cookie.Value
+	}
+	if refreshToken == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Refresh token is required"})
+	}
 
-	data := map[string]interface{}{}
-	if count > 0 {
-		// ユーザーがDBに登録済みの場合
-		data = map[string]interface{}{
-			"name":   user.Name,
-			"email":  userInfo.Email,
-			"picUrl": userInfo.Picture,
-		}
-	} else {
-		// ユーザーがDBに未登録の場合（新しくログインする場合）
-		data = map[string]interface{}{
-			"name":   userInfo.Name,
-			"email":  userInfo.Email,
-			"picUrl": userInfo.Picture,
-		}
+	userID, sessionID, newRefreshToken, err := h.Sessions.RotateRefreshToken(c.Request().Context(), refreshToken)
+	if errors.Is(err, session.ErrRefreshTokenReused) {
+		h.clearAuthCookies(c)
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Refresh token reuse detected. Please log in again"})
+	}
+	if errors.Is(err, session.ErrRefreshTokenInvalid) {
+		h.clearAuthCookies(c)
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid or expired refresh token"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to refresh token"})
 	}
 
-	// JWT は JSON レスポンスで返す
+	// ロールは毎回DBから取り直す（付与・剥奪をリフレッシュ時に反映するため）
+	roles, err := rbac.LoadUserRoles(h.DB, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to get roles"})
+	}
+	jwtToken, err := utils.GenerateToken(userID, sessionID, roles)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to generate token"})
+	}
+	h.setRefreshTokenCookie(c, newRefreshToken)
+
 	return c.JSON(http.StatusOK, echo.Map{
-		"message": "Login successful",
+		"message": "Token refreshed",
 		"token":   jwtToken,
-		"user":    data,
 	})
-
 }
 
 // Logout はセッションを削除する
+// セッションに属するリフレッシュトークンをすべて失効させ、使用中のアクセストークンも失効リストに入れる
+// 失効させられるのは自分のセッションのみ。アクセストークンがあればそのセッション、なければリフレッシュトークンのクッキーのセッションを失効させる
+// session_id を指定した場合は、そのセッションと一致しなければ拒否する
 func (h *AuthHandler) Logout(c echo.Context) error {
-	sessionID := c.QueryParam("session_id")
+	ctx := c.Request().Context()
+	requestedSessionID := c.QueryParam("session_id")
+	sessionID := ""
+
+	// Authorization ヘッダーがあれば、そのアクセストークンも即時失効させる
+	if tokenString, err := utils.ParseBearerToken(c.Request().Header.Get("Authorization")); err == nil {
+		if claims, err := utils.ValidateToken(tokenString); err == nil {
+			sid, _ := claims["sid"].(string)
+			if requestedSessionID != "" && requestedSessionID != sid {
+				return c.JSON(http.StatusForbidden, echo.Map{"error": "Cannot log out another session"})
+			}
+			if jti, ok := claims["jti"].(string); ok {
+				if err := h.Sessions.RevokeAccessToken(ctx, jti, utils.TokenExpiry(claims)); err != nil {
+					return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to revoke token"})
+				}
+			}
+			sessionID = sid
+		}
+	}
+
+	// アクセストークンがない（期限切れなど）場合は、リフレッシュトークンでセッションの持ち主であることを確認する
 	if sessionID == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Session ID is required"})
+		cookie, err := c.Cookie(refreshTokenCookieName)
+		if err != nil || cookie.Value == "" {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Access token or refresh token is required"})
+		}
+		_, sid, err := h.Sessions.LookupRefreshToken(ctx, cookie.Value)
+		if errors.Is(err, session.ErrRefreshTokenInvalid) {
+			h.clearAuthCookies(c)
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Refresh token is invalid or expired"})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to load session"})
+		}
+		if requestedSessionID != "" && requestedSessionID != sid {
+			return c.JSON(http.StatusForbidden, echo.Map{"error": "Cannot log out another session"})
+		}
+		sessionID = sid
 	}
 
-	// Redisからセッション削除
-	err := h.RDB.Del(context.Background(), sessionID).Err()
-	if err != nil {
+	// Redisからセッションとリフレッシュトークンを削除
+	if err := h.Sessions.RevokeSession(ctx, sessionID); err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to delete session"})
 	}
+	h.clearAuthCookies(c)
 
 	return c.JSON(http.StatusOK, echo.Map{"message": "Logged out"})
 }
 
-// Me はログイン中のユーザー情報を返す（JWT認証）
-func (h *AuthHandler) Me(c echo.Context) error {
-	userID, ok := c.Get("user_id").(string)
-	if !ok {
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid token"})
-	}
-
-	return c.JSON(http.StatusOK, echo.Map{"user_id": userID})
-}
+// issueSession はセッションを作成し、アクセストークンを返す
+// セッションIDとリフレッシュトークンはクッキーに保存する
+func (h *AuthHandler) issueSession(c echo.Context, userID string) (string, error) {
+	ctx := c.Request().Context()
 
-// Googleのユーザー情報を取得
-func getGoogleUserInfo(accessToken string) (*GoogleUserInfo, error) {
-	req, err := http.NewRequest("GET", "https://www.googleapis.com/oauth2/v3/userinfo", nil)
+	sessionID, err := h.Sessions.CreateSession(ctx, userID)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	refreshToken, err := h.Sessions.IssueRefreshToken(ctx, userID, sessionID)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	defer resp.Body.Close()
-
-	var userInfo GoogleUserInfo
-	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-		return nil, err
+	roles, err := rbac.LoadUserRoles(h.DB, userID)
+	if err != nil {
+		return "", err
+	}
+	jwtToken, err := utils.GenerateToken(userID, sessionID, roles)
+	if err != nil {
+		return "", err
 	}
 
-	return &userInfo, nil
+	// セッションIDをクッキーに保存（ログアウト時にフロントから送られてくる）
+	c.SetCookie(&http.Cookie{
+		Name:     "session_id",
+		Value:    sessionID,
+		Path:     "/",
+		HttpOnly: false,                   // JavaScript からアクセス不可→アクセス許可に変える。そうでないとJWTでセッション管理することになり。セッションIDがある意味がなくなるので。
+		Secure:   false,                   // 本番環境では true にする（HTTPS 必須）
+		SameSite: http.SameSiteStrictMode, // CSRF 対策
+		MaxAge:   int(session.RefreshTokenTTL.Seconds()),
+	})
+	h.setRefreshTokenCookie(c, refreshToken)
+
+	return jwtToken, nil
+}
+
+// setRefreshTokenCookie はリフレッシュトークンを HttpOnly クッキーに保存する
+func (h *AuthHandler) setRefreshTokenCookie(c echo.Context, refreshToken string) {
+	c.SetCookie(&http.Cookie{
+		Name:     refreshTokenCookieName,
+		Value:    refreshToken,
+		Path:     "/api/auth",
+		HttpOnly: true,  // JavaScript からは読めないようにする
+		Secure:   false, // 本番環境では true にする（HTTPS 必須）
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(session.RefreshTokenTTL.Seconds()),
+	})
 }
 
-// Googleユーザー情報の構造体
-type GoogleUserInfo struct {
-	Sub     string `json:"sub"`
-	Email   string `json:"email"`
-	Name    string `json:"name"`
-	Picture string `json:"picture"` // 追加: Googleのプロフィール画像URL
+// clearAuthCookies はセッションIDとリフレッシュトークンのクッキーを削除する
+func (h *AuthHandler) clearAuthCookies(c echo.Context) {
+	c.SetCookie(&http.Cookie{Name: "session_id", Value: "", Path: "/", MaxAge: -1})
+	c.SetCookie(&http.Cookie{Name: refreshTokenCookieName, Value: "", Path: "/api/auth", MaxAge: -1, HttpOnly: true})
 }
 
-// ユーザーがDBに存在するか確認し、なければ作成
-func ensureUserExists(db *gorm.DB, userID, email, name, avatar string) error {
-	var count int64
-	db.Table("online_learning_users").Where("id = ?", userID).Count(&count)
-	if count > 0 {
-		return nil // 既に登録済みの場合
+// Me はログイン中のユーザー情報を返す（JWT認証）
+func (h *AuthHandler) Me(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid token"})
 	}
 
-	// 新規ユーザー作成
-	user := User{ID: userID, Email: email, Name: name, Avatar: avatar, Era: 0, OccupationId: 0}
-	return db.Create(&user).Error
+	return c.JSON(http.StatusOK, echo.Map{"user_id": userID})
 }
 
 // Userモデル
 type User struct {
 	ID           string    `gorm:"primaryKey;size:255"`
-	Name         string    `gorm:"type:text"` // 文字数制限なしの文字列
-	Email        string    `gorm:"unique;type:text"`
+	Name         string    `gorm:"type:text"`        // 文字数制限なしの文字列
+	Email        *string   `gorm:"unique;type:text"` // 確認済みのメールアドレスがない場合は NULL
 	Avatar       string    `gorm:"type:text"`
 	CreatedAt    time.Time `gorm:"type:date"`
 	UpdatedAt    time.Time `gorm:"type:date"`
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrIdentityLinkedToOtherUser は紐付けようとしたプロバイダのアカウントが別ユーザーに紐付いている場合に返す
+	ErrIdentityLinkedToOtherUser = errors.New("this account is already linked to another user")
+	// ErrEmailAlreadyRegistered は未紐付けのプロバイダでログインしたが、同じメールアドレスのユーザーが存在する場合に返す
+	// 乗っ取りを防ぐため自動では紐付けず、既存のアカウントでログインしてから紐付けてもらう
+	ErrEmailAlreadyRegistered = errors.New("a user with this email already exists")
+	// ErrLastIdentity は最後のログイン手段を解除しようとした場合に返す
+	ErrLastIdentity = errors.New("cannot unlink the last login method")
+)
+
+// UserIdentity 外部プロバイダのアカウントとユーザーの紐付け
+type UserIdentity struct {
+	Provider  string    `json:"provider" gorm:"column:provider;primaryKey;size:50"`
+	Subject   string    `json:"-" gorm:"column:subject;primaryKey;size:255"`
+	UserID    string    `json:"-" gorm:"column:user_id;size:255"`
+	Email     *string   `json:"email" gorm:"column:email;type:text"`
+	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at"`
+}
+
+// テーブル名を指定
+func (UserIdentity) TableName() string {
+	return "online_learning_user_identities"
+}
+
+// resolveUser は外部プロバイダのユーザー情報に対応するユーザーを返す
+// 紐付けがなければユーザーを新規作成して紐付ける（isNew が true になる）
+func resolveUser(db *gorm.DB, identity *ExternalIdentity) (user *User, isNew bool, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var linked UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&linked).Error
+		if err == nil {
+			user = &User{}
+			return tx.Where("id = ?", linked.UserID).First(user).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// 同じメールアドレスのユーザーがいる場合は自動で紐付けない
+		// ただし、メールアドレスを確認していない登録は持ち主か分からないので、削除して外部プロバイダのユーザーを作る
+		// プロバイダ側で確認されていないメールアドレスは本人のものか分からないので使わない
+		email := identity.verifiedEmail()
+		if email != "" {
+			if err := deleteUnverifiedLocalUser(tx, email); err != nil {
+				return err
+			}
+			var count int64
+			if err := tx.Model(&User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrEmailAlreadyRegistered
+			}
+		}
+
+		// 新規ユーザー作成
+		user = &User{
+			ID:           uuid.New().String(),
+			Email:        nullableEmail(email),
+			Name:         identity.Name,
+			Avatar:       identity.Picture,
+			Era:          0,
+			OccupationId: 0,
+		}
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		isNew = true
+		return tx.Create(&UserIdentity{
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			UserID:   user.ID,
+			Email:    nullableEmail(email),
+		}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return user, isNew, nil
+}
+
+// nullableEmail は空のメールアドレスを NULL にする
+// users.email は一意なので、メールアドレスのないユーザーが複数いても衝突しないようにする
+func nullableEmail(email string) *string {
+	if email == "" {
+		return nil
+	}
+	return &email
+}
+
+// deleteUnverifiedLocalUser はメールアドレスを確認していないローカル登録のみのユーザーを削除する
+// 未確認のユーザーはログインできないので、削除しても学習データなどは失われない
+func deleteUnverifiedLocalUser(tx *gorm.DB, email string) error {
+	var userIDs []string
+	if err := tx.Table("online_learning_users u").
+		Joins("JOIN online_learning_local_credentials lc ON lc.user_id = u.id").
+		Where("u.email = ? AND lc.email_verified_at IS NULL", email).
+		Where("NOT EXISTS (SELECT 1 FROM online_learning_user_identities i WHERE i.user_id = u.id)").
+		Pluck("u.id", &userIDs).Error; err != nil {
+		return err
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+	return tx.Where("id IN ?", userIDs).Delete(&User{}).Error
+}
+
+// linkIdentity はログイン中のユーザーに外部プロバイダのアカウントを紐付ける
+func linkIdentity(db *gorm.DB, userID string, identity *ExternalIdentity) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var linked UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&linked).Error
+		if err == nil {
+			if linked.UserID != userID {
+				return ErrIdentityLinkedToOtherUser
+			}
+			return nil // すでに紐付け済み
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Create(&UserIdentity{
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			UserID:   userID,
+			Email:    nullableEmail(identity.verifiedEmail()),
+		}).Error
+	})
+}
+
+// unlinkIdentity はプロバイダの紐付けを解除する（ログイン手段が1つもなくなる場合は解除しない）
+// メールアドレス・パスワードでのログインもログイン手段として数える
+func unlinkIdentity(db *gorm.DB, userID, provider string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var count, localCount int64
+		if err := tx.Model(&UserIdentity{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&LocalCredential{}).Where("user_id = ?", userID).Count(&localCount).Error; err != nil {
+			return err
+		}
+		if count+localCount <= 1 {
+			return ErrLastIdentity
+		}
+		return tx.Where("user_id = ? AND provider = ?", userID, provider).Delete(&UserIdentity{}).Error
+	})
+}
+
+// listIdentities はユーザーに紐付いているプロバイダの一覧を返す
+func listIdentities(db *gorm.DB, userID string) ([]UserIdentity, error) {
+	var identities []UserIdentity
+	if err := db.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
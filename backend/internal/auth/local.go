@@ -0,0 +1,467 @@
+package auth
+
+import (
+	"OnlineLearningWebApp/internal/notification"
+	"OnlineLearningWebApp/pkg/security"
+	"OnlineLearningWebApp/pkg/session"
+	"OnlineLearningWebApp/pkg/utils"
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// メールアドレス確認リンクの有効期間
+	emailVerificationTTL = 24 * time.Hour
+	// パスワード再設定リンクの有効期間
+	passwordResetTTL = time.Hour
+
+	minPasswordLength = 8
+	maxPasswordLength = 72 // bcrypt は72バイトを超える部分を無視するため、それ以上は受け付けない
+)
+
+// bcrypt の比較時間をユーザーの有無で変えないために使うダミーのハッシュ（初回利用時に生成する）
+var (
+	dummyPasswordHash     string
+	dummyPasswordHashOnce sync.Once
+)
+
+func getDummyPasswordHash() string {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = security.HashPassword(uuid.New().String())
+	})
+	return dummyPasswordHash
+}
+
+// LocalCredential メールアドレス・パスワードでログインするユーザーの認証情報
+type LocalCredential struct {
+	UserID            string     `gorm:"column:user_id;primaryKey;size:255"`
+	PasswordHash      string     `gorm:"column:password_hash;type:text"`
+	EmailVerifiedAt   *time.Time `gorm:"column:email_verified_at"`
+	PasswordUpdatedAt time.Time  `gorm:"column:password_updated_at"`
+	CreatedAt         time.Time  `gorm:"column:created_at"`
+}
+
+// テーブル名を指定
+func (LocalCredential) TableName() string {
+	return "online_learning_local_credentials"
+}
+
+// RegisterRequest ユーザー登録のリクエスト
+type RegisterRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+}
+
+// LocalLoginRequest ログインのリクエスト
+type LocalLoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// EmailRequest メールアドレスだけを受け取るリクエスト（確認メール再送・パスワード再設定）
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest パスワード再設定のリクエスト
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ChangePasswordRequest パスワード変更のリクエスト
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+func emailVerificationKey(hash string) string { return "email_verification:" + hash }
+func passwordResetKey(hash string) string     { return "password_reset:" + hash }
+
+// Register はメールアドレス・パスワードでユーザーを登録し、確認メールを送信する
+func (h *AuthHandler) Register(c echo.Context) error {
+	var req RegisterRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid email address"})
+	}
+	if err := validatePassword(req.Password); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Name is required"})
+	}
+
+	hash, err := security.HashPassword(req.Password)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to hash password"})
+	}
+
+	user := User{ID: uuid.New().String(), Email: &email, Name: name, Era: 0, OccupationId: 0}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrEmailAlreadyRegistered
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			// 同時に登録された場合は、件数の確認をすり抜けて一意制約で失敗する
+			if isUniqueViolation(err) {
+				return ErrEmailAlreadyRegistered
+			}
+			return err
+		}
+		return tx.Create(&LocalCredential{
+			UserID:            user.ID,
+			PasswordHash:      hash,
+			PasswordUpdatedAt: time.Now(),
+		}).Error
+	})
+	if errors.Is(err, ErrEmailAlreadyRegistered) {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "This email is already registered"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to create user"})
+	}
+
+	// 確認メールの送信に失敗しても登録自体は成功させる（再送できる）
+	if err := h.sendVerificationEmail(c.Request().Context(), &user); err != nil {
+		log.Println("Failed to send verification email:", err)
+	}
+
+	return c.JSON(http.StatusCreated, echo.Map{
+		"message": "User registered. Please check your email to verify your address.",
+	})
+}
+
+// VerifyEmail はメールアドレス確認リンクのトークンを検証する
+func (h *AuthHandler) VerifyEmail(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Token is required"})
+	}
+
+	userID, err := h.RDB.GetDel(c.Request().Context(), emailVerificationKey(session.HashToken(token))).Result()
+	if errors.Is(err, redis.Nil) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid or expired token"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to verify email"})
+	}
+
+	if err := h.DB.Model(&LocalCredential{}).
+		Where("user_id = ? AND email_verified_at IS NULL", userID).
+		Update("email_verified_at", time.Now()).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to verify email"})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Email verified"})
+}
+
+// ResendVerificationEmail は確認メールを再送する
+// 登録の有無が分からないよう、常に同じレスポンスを返す
+func (h *AuthHandler) ResendVerificationEmail(c echo.Context) error {
+	var req EmailRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid email address"})
+	}
+
+	var user User
+	err = h.DB.Table("online_learning_users as u").
+		Select("u.*").
+		Joins("JOIN online_learning_local_credentials lc ON lc.user_id = u.id").
+		Where("u.email = ? AND lc.email_verified_at IS NULL", email).
+		Take(&user).Error
+	if err == nil {
+		if err := h.sendVerificationEmail(c.Request().Context(), &user); err != nil {
+			log.Println("Failed to send verification email:", err)
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to send email"})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "If the address is registered and not yet verified, a verification email has been sent."})
+}
+
+// LocalLogin はメールアドレス・パスワードでログインし、セッションを作成する
+// 発行するトークンは Login（OAuth）と同じ
+func (h *AuthHandler) LocalLogin(c echo.Context) error {
+	var req LocalLoginRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid email or password"})
+	}
+
+	var user User
+	var credential LocalCredential
+	err = h.DB.Where("email = ?", email).Take(&user).Error
+	if err == nil {
+		err = h.DB.Where("user_id = ?", user.ID).Take(&credential).Error
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to get user"})
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// ユーザーがいない場合も同じ時間がかかるように、ダミーのハッシュと比較する
+		security.CheckPassword(getDummyPasswordHash(), req.Password)
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid email or password"})
+	}
+	if !security.CheckPassword(credential.PasswordHash, req.Password) {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid email or password"})
+	}
+	if credential.EmailVerifiedAt == nil {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "Email address is not verified"})
+	}
+
+	jwtToken, err := h.issueSession(c, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to create session"})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Login successful",
+		"token":   jwtToken,
+		"user": map[string]interface{}{
+			"name":   user.Name,
+			"email":  user.Email,
+			"picUrl": user.Avatar,
+		},
+	})
+}
+
+// ForgotPassword はパスワード再設定メールを送信する
+// Googleなどでしかログインしたことがないユーザーも、ここからパスワードを設定できる
+// 登録の有無が分からないよう、常に同じレスポンスを返す
+func (h *AuthHandler) ForgotPassword(c echo.Context) error {
+	var req EmailRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid email address"})
+	}
+
+	var user User
+	err = h.DB.Where("email = ?", email).Take(&user).Error
+	if err == nil {
+		if err := h.sendPasswordResetEmail(c.Request().Context(), &user); err != nil {
+			log.Println("Failed to send password reset email:", err)
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to send email"})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "If the address is registered, a password reset email has been sent."})
+}
+
+// ResetPassword はパスワード再設定リンクのトークンを検証し、パスワードを設定する
+// メールのリンクを開けた = メールアドレスの持ち主なので、メールアドレスも確認済みにする
+// 再設定後は、すべての端末のセッションを失効させる
+func (h *AuthHandler) ResetPassword(c echo.Context) error {
+	var req ResetPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+	if err := validatePassword(req.Password); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	ctx := c.Request().Context()
+	userID, err := h.RDB.GetDel(ctx, passwordResetKey(session.HashToken(req.Token))).Result()
+	if errors.Is(err, redis.Nil) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid or expired token"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to reset password"})
+	}
+
+	hash, err := security.HashPassword(req.Password)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to hash password"})
+	}
+	now := time.Now()
+	credential := LocalCredential{
+		UserID:            userID,
+		PasswordHash:      hash,
+		EmailVerifiedAt:   &now,
+		PasswordUpdatedAt: now,
+		CreatedAt:         now,
+	}
+	if err := h.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"password_hash":       hash,
+			"password_updated_at": now,
+			"email_verified_at":   gorm.Expr("COALESCE(online_learning_local_credentials.email_verified_at, ?)", now),
+		}),
+	}).Create(&credential).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to reset password"})
+	}
+
+	if err := h.Sessions.RevokeUserSessions(ctx, userID, ""); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to revoke sessions"})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Password has been reset. Please log in again."})
+}
+
+// ChangePassword はログイン中のユーザーのパスワードを変更する（JWT認証）
+// 変更後は、今使っているセッション以外を失効させる
+func (h *AuthHandler) ChangePassword(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	var req ChangePasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	var credential LocalCredential
+	if err := h.DB.Where("user_id = ?", userID).Take(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "Password is not set. Use the password reset flow to set one."})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to get credential"})
+	}
+	if !security.CheckPassword(credential.PasswordHash, req.CurrentPassword) {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Current password is incorrect"})
+	}
+
+	hash, err := security.HashPassword(req.NewPassword)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to hash password"})
+	}
+	if err := h.DB.Model(&LocalCredential{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+		"password_hash":       hash,
+		"password_updated_at": time.Now(),
+	}).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to change password"})
+	}
+
+	currentSessionID, _ := c.Get("session_id").(string)
+	if err := h.Sessions.RevokeUserSessions(c.Request().Context(), userID, currentSessionID); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to revoke sessions"})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Password changed"})
+}
+
+// sendVerificationEmail はメールアドレス確認用のトークンを発行してメールを送る
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, user *User) error {
+	token, err := randomString(32)
+	if err != nil {
+		return err
+	}
+	if err := h.RDB.Set(ctx, emailVerificationKey(session.HashToken(token)), user.ID, emailVerificationTTL).Err(); err != nil {
+		return err
+	}
+	return sendAccountEmail(user, accountEmailData{
+		Title:       "メールアドレスの確認",
+		Message:     "エコランへのご登録ありがとうございます。以下のボタンからメールアドレスの確認を完了してください（24時間有効）。",
+		ActionURL:   notification.FrontendURL() + "/auth/verify-email?token=" + token,
+		ActionLabel: "メールアドレスを確認する",
+	})
+}
+
+// sendPasswordResetEmail はパスワード再設定用のトークンを発行してメールを送る
+func (h *AuthHandler) sendPasswordResetEmail(ctx context.Context, user *User) error {
+	token, err := randomString(32)
+	if err != nil {
+		return err
+	}
+	if err := h.RDB.Set(ctx, passwordResetKey(session.HashToken(token)), user.ID, passwordResetTTL).Err(); err != nil {
+		return err
+	}
+	return sendAccountEmail(user, accountEmailData{
+		Title:       "パスワードの再設定",
+		Message:     "パスワード再設定のリクエストを受け付けました。以下のボタンから新しいパスワードを設定してください（1時間有効）。",
+		ActionURL:   notification.FrontendURL() + "/auth/reset-password?token=" + token,
+		ActionLabel: "パスワードを再設定する",
+	})
+}
+
+// accountEmailData アカウント関連メールのテンプレートに渡すデータ
+type accountEmailData struct {
+	UserName    string
+	Title       string
+	Message     string
+	ActionURL   string
+	ActionLabel string
+}
+
+func sendAccountEmail(user *User, data accountEmailData) error {
+	tmpl, err := template.ParseFiles(filepath.Join("templates", "account_email_template.html"))
+	if err != nil {
+		return err
+	}
+	data.UserName = user.Name
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return err
+	}
+	if user.Email == nil {
+		return errors.New("user has no email address")
+	}
+	return notification.SendMail(*user.Email, data.Title, body.String())
+}
+
+// normalizeEmail はメールアドレスの形式を確認し、小文字にそろえる
+func normalizeEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || addr.Address != strings.TrimSpace(email) {
+		return "", errors.New("invalid email address")
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return errors.New("Password must be at least 8 characters")
+	}
+	if len(password) > maxPasswordLength {
+		return errors.New("Password must be at most 72 bytes")
+	}
+	return nil
+}
+
+// isUniqueViolation は一意制約違反のエラーかどうかを返す
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,386 @@
+package auth
+
+import (
+	"OnlineLearningWebApp/pkg/security"
+	"OnlineLearningWebApp/pkg/session"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeResult は fakeDB が SQL に対して返す結果（rows が nil なら0件）
+type fakeResult struct {
+	columns []string
+	rows    [][]driver.Value
+	err     error
+}
+
+// fakeDB は GORM が発行した SQL を記録し、respond が返す結果を返すテスト用のデータベース
+// respond が nil の場合、SELECT は0件、それ以外は1件更新したものとして扱う
+type fakeDB struct {
+	mu      sync.Mutex
+	queries []string
+	respond func(query string, args []driver.NamedValue) *fakeResult
+}
+
+func (db *fakeDB) result(query string, args []driver.NamedValue) *fakeResult {
+	db.mu.Lock()
+	db.queries = append(db.queries, query)
+	db.mu.Unlock()
+	if db.respond != nil {
+		if r := db.respond(query, args); r != nil {
+			return r
+		}
+	}
+	return &fakeResult{}
+}
+
+// executed は指定した文字列を含む SQL が実行されたかを返す
+func (db *fakeDB) executed(substr string) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, q := range db.queries {
+		if strings.Contains(q, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{db}, nil }
+func (db *fakeDB) Driver() driver.Driver                         { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+func (c fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c fakeConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r := c.db.result(query, args)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &fakeRows{columns: r.columns, rows: r.rows}, nil
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r := c.db.result(query, args)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// newTestHandler は fakeDB と miniredis を使う AuthHandler を返す
+func newTestHandler(t *testing.T, db *fakeDB) (*AuthHandler, *miniredis.Miniredis) {
+	t.Helper()
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(db)}), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewAuthHandler(gormDB, rdb, NewProviderRegistry()), mr
+}
+
+// serve はハンドラーを呼び出し、ステータスコードとレスポンスの JSON を返す
+// setup でコンテキストに値（ログイン中のユーザーなど）をセットできる
+func serve(t *testing.T, handler echo.HandlerFunc, method, target, body string, setup func(c echo.Context)) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if setup != nil {
+		setup(c)
+	}
+	if err := handler(c); err != nil {
+		t.Fatal(err)
+	}
+	var res map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, res
+}
+
+// userRow は email の SELECT に対して、knownEmail のユーザーだけを返す
+func userRow(query string, args []driver.NamedValue, knownEmail string) *fakeResult {
+	if !strings.Contains(query, "online_learning_users") || !strings.HasPrefix(query, "SELECT") {
+		return nil
+	}
+	for _, arg := range args {
+		if arg.Value == knownEmail {
+			return &fakeResult{
+				columns: []string{"id", "name", "email"},
+				rows:    [][]driver.Value{{"user-1", "User One", knownEmail}},
+			}
+		}
+	}
+	return nil
+}
+
+func TestRegister(t *testing.T) {
+	const body = `{"email":"new@example.com","password":"password123","name":"New User"}`
+	tests := []struct {
+		name    string
+		respond func(query string, args []driver.NamedValue) *fakeResult
+		want    int
+	}{
+		{
+			name: "new email",
+			want: http.StatusCreated,
+		},
+		{
+			name: "registered email",
+			respond: func(query string, args []driver.NamedValue) *fakeResult {
+				if strings.HasPrefix(query, "SELECT count(*)") {
+					return &fakeResult{columns: []string{"count"}, rows: [][]driver.Value{{int64(1)}}}
+				}
+				return nil
+			},
+			want: http.StatusConflict,
+		},
+		{
+			// 件数の確認の後に、同じメールアドレスで同時に登録された場合
+			name: "concurrent registration",
+			respond: func(query string, args []driver.NamedValue) *fakeResult {
+				if strings.HasPrefix(query, `INSERT INTO "online_learning_users"`) {
+					return &fakeResult{err: &pgconn.PgError{Code: "23505"}}
+				}
+				return nil
+			},
+			want: http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t, &fakeDB{respond: tt.respond})
+			if got, res := serve(t, h.Register, http.MethodPost, "/api/auth/register", body, nil); got != tt.want {
+				t.Errorf("status = %d, want %d (%v)", got, tt.want, res)
+			}
+		})
+	}
+}
+
+func TestVerifyEmailTokenIsSingleUse(t *testing.T) {
+	db := &fakeDB{}
+	h, _ := newTestHandler(t, db)
+	if err := h.RDB.Set(context.Background(), emailVerificationKey(session.HashToken("token-1")), "user-1", emailVerificationTTL).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := serve(t, h.VerifyEmail, http.MethodPost, "/api/auth/verify-email?token=token-1", "", nil); got != http.StatusOK {
+		t.Fatalf("status = %d, want %d", got, http.StatusOK)
+	}
+	if !db.executed(`UPDATE "online_learning_local_credentials" SET "email_verified_at"`) {
+		t.Errorf("email_verified_at was not updated: %v", db.queries)
+	}
+
+	if got, _ := serve(t, h.VerifyEmail, http.MethodPost, "/api/auth/verify-email?token=token-1", "", nil); got != http.StatusBadRequest {
+		t.Errorf("reused token: status = %d, want %d", got, http.StatusBadRequest)
+	}
+}
+
+func TestVerifyEmailTokenExpires(t *testing.T) {
+	db := &fakeDB{}
+	h, mr := newTestHandler(t, db)
+	if err := h.RDB.Set(context.Background(), emailVerificationKey(session.HashToken("token-1")), "user-1", emailVerificationTTL).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	mr.FastForward(emailVerificationTTL + time.Second)
+	if got, _ := serve(t, h.VerifyEmail, http.MethodPost, "/api/auth/verify-email?token=token-1", "", nil); got != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", got, http.StatusBadRequest)
+	}
+	if db.executed("UPDATE") {
+		t.Error("expired token updated the credential")
+	}
+}
+
+// 登録されていないメールアドレスでも、登録済みの場合と同じレスポンスを返す
+func TestEmailRequestsDoNotRevealRegistration(t *testing.T) {
+	const knownEmail = "known@example.com"
+	tests := []struct {
+		name      string
+		handler   func(h *AuthHandler) echo.HandlerFunc
+		keyPrefix string
+	}{
+		{"ForgotPassword", func(h *AuthHandler) echo.HandlerFunc { return h.ForgotPassword }, "password_reset:"},
+		{"ResendVerificationEmail", func(h *AuthHandler) echo.HandlerFunc { return h.ResendVerificationEmail }, "email_verification:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mr := newTestHandler(t, &fakeDB{respond: func(query string, args []driver.NamedValue) *fakeResult {
+				return userRow(query, args, knownEmail)
+			}})
+
+			knownStatus, knownRes := serve(t, tt.handler(h), http.MethodPost, "/", `{"email":"`+knownEmail+`"}`, nil)
+			unknownStatus, unknownRes := serve(t, tt.handler(h), http.MethodPost, "/", `{"email":"unknown@example.com"}`, nil)
+
+			if knownStatus != http.StatusOK || unknownStatus != knownStatus || unknownRes["message"] != knownRes["message"] {
+				t.Errorf("responses differ: known = %d %v, unknown = %d %v", knownStatus, knownRes, unknownStatus, unknownRes)
+			}
+			// トークンは登録済みのユーザーにだけ発行する
+			if keys := mr.Keys(); len(keys) != 1 || !strings.HasPrefix(keys[0], tt.keyPrefix) {
+				t.Errorf("issued tokens = %v, want one %s token", mr.Keys(), tt.keyPrefix)
+			}
+		})
+	}
+}
+
+func TestResetPasswordRevokesSessions(t *testing.T) {
+	db := &fakeDB{}
+	h, _ := newTestHandler(t, db)
+	ctx := context.Background()
+
+	var sessionIDs []string
+	for _, userID := range []string{"user-1", "user-1", "user-2"} {
+		sessionID, err := h.Sessions.CreateSession(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	if err := h.RDB.Set(ctx, passwordResetKey(session.HashToken("token-1")), "user-1", passwordResetTTL).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	const body = `{"token":"token-1","password":"new-password"}`
+	if got, res := serve(t, h.ResetPassword, http.MethodPost, "/api/auth/password/reset", body, nil); got != http.StatusOK {
+		t.Fatalf("status = %d, want %d (%v)", got, http.StatusOK, res)
+	}
+	if !db.executed(`INSERT INTO "online_learning_local_credentials"`) {
+		t.Errorf("credential was not saved: %v", db.queries)
+	}
+
+	// user-1 のセッションはすべて失効し、user-2 のセッションは残る
+	for i, want := range []bool{false, false, true} {
+		userID := "user-1"
+		if i == 2 {
+			userID = "user-2"
+		}
+		active, err := h.Sessions.IsSessionActive(ctx, sessionIDs[i], userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if active != want {
+			t.Errorf("session %d active = %v, want %v", i, active, want)
+		}
+	}
+
+	if got, _ := serve(t, h.ResetPassword, http.MethodPost, "/api/auth/password/reset", body, nil); got != http.StatusBadRequest {
+		t.Errorf("reused token: status = %d, want %d", got, http.StatusBadRequest)
+	}
+}
+
+func TestResetPasswordTokenExpires(t *testing.T) {
+	h, mr := newTestHandler(t, &fakeDB{})
+	if err := h.RDB.Set(context.Background(), passwordResetKey(session.HashToken("token-1")), "user-1", passwordResetTTL).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	mr.FastForward(passwordResetTTL + time.Second)
+	const body = `{"token":"token-1","password":"new-password"}`
+	if got, _ := serve(t, h.ResetPassword, http.MethodPost, "/api/auth/password/reset", body, nil); got != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", got, http.StatusBadRequest)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	hash, err := security.HashPassword("old-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &fakeDB{respond: func(query string, args []driver.NamedValue) *fakeResult {
+		if strings.HasPrefix(query, `SELECT * FROM "online_learning_local_credentials"`) {
+			return &fakeResult{columns: []string{"user_id", "password_hash"}, rows: [][]driver.Value{{"user-1", hash}}}
+		}
+		return nil
+	}}
+	h, _ := newTestHandler(t, db)
+	ctx := context.Background()
+	current, err := h.Sessions.CreateSession(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := h.Sessions.CreateSession(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	login := func(c echo.Context) {
+		c.Set("user_id", "user-1")
+		c.Set("session_id", current)
+	}
+
+	const wrong = `{"currentPassword":"wrong-password","newPassword":"new-password"}`
+	if got, _ := serve(t, h.ChangePassword, http.MethodPost, "/api/auth/password/change", wrong, login); got != http.StatusUnauthorized {
+		t.Errorf("wrong password: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if db.executed("UPDATE") {
+		t.Error("password was changed with a wrong current password")
+	}
+
+	const body = `{"currentPassword":"old-password","newPassword":"new-password"}`
+	if got, res := serve(t, h.ChangePassword, http.MethodPost, "/api/auth/password/change", body, login); got != http.StatusOK {
+		t.Fatalf("status = %d, want %d (%v)", got, http.StatusOK, res)
+	}
+	// 今使っているセッションだけが残る
+	for sessionID, want := range map[string]bool{current: true, other: false} {
+		active, err := h.Sessions.IsSessionActive(ctx, sessionID, "user-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if active != want {
+			t.Errorf("session %s active = %v, want %v", sessionID, active, want)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig は OpenID Connect プロバイダの設定
+type OIDCConfig struct {
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string // 未指定の場合は openid profile email
+	// MultiTenant が true の場合、iss の完全一致ではなく
+	// ディスカバリーの issuer の {tenantid} を ID トークンの tid で置き換えて検証する（Microsoft 用）
+	MultiTenant bool
+}
+
+// OIDCProvider はディスカバリー（/.well-known/openid-configuration）を使う汎用の OIDC プロバイダ
+// Google / Microsoft / 任意の OIDC サーバー（ローカルのモックサーバー含む）で共通
+type OIDCProvider struct {
+	cfg        OIDCConfig
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]interface{} // kid -> 公開鍵
+	keysAt    time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// ID トークンの検証に使うクレーム
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string      `json:"nonce"`
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"` // プロバイダによって bool / "true" の場合がある
+	Name          string      `json:"name"`
+	Picture       string      `json:"picture"`
+	TenantID      string      `json:"tid"`
+}
+
+// 署名鍵を取り直す最短間隔（未知の kid が来るたびに JWKS を取りに行かないようにする）
+const jwksRefreshInterval = 5 * time.Minute
+
+// NewOIDCProvider は OIDCProvider を生成する
+// ディスカバリーは初回利用時に行う（起動時にプロバイダへ接続できなくてもサーバーは起動できるようにする）
+func NewOIDCProvider(cfg OIDCConfig, httpClient *http.Client) *OIDCProvider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &OIDCProvider{cfg: cfg, httpClient: httpClient}
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, codeVerifier, nonce string) (string, error) {
+	conf, err := p.oauth2Config(ctx)
+	if err != nil {
+		return "", err
+	}
+	return conf.AuthCodeURL(state,
+		oauth2.S256ChallengeOption(codeVerifier),
+		oauth2.SetAuthURLParam("nonce", nonce),
+	), nil
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*ExternalIdentity, error) {
+	conf, err := p.oauth2Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.httpClient)
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange token: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("id_token is missing in token response")
+	}
+	claims, err := p.verifyIDToken(ctx, rawIDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &ExternalIdentity{
+		Provider:      p.cfg.Name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: isTrue(claims.EmailVerified),
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+	}
+
+	// ID トークンにメールアドレス等が含まれていない場合は userinfo から補完する
+	if identity.Email == "" || identity.Name == "" {
+		if err := p.fillFromUserinfo(ctx, token, identity); err != nil {
+			return nil, err
+		}
+	}
+	return identity, nil
+}
+
+// verifyIDToken は ID トークンの署名・iss・aud・exp・nonce を検証する
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, rawIDToken, nonce string) (*idTokenClaims, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims idTokenClaims
+	_, err = jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	expectedIssuer := discovery.Issuer
+	if p.cfg.MultiTenant {
+		expectedIssuer = strings.ReplaceAll(expectedIssuer, "{tenantid}", claims.TenantID)
+	}
+	if claims.Issuer != expectedIssuer {
+		return nil, fmt.Errorf("invalid id_token: unexpected issuer %q", claims.Issuer)
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("invalid id_token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid id_token: sub is empty")
+	}
+	return &claims, nil
+}
+
+func (p *OIDCProvider) fillFromUserinfo(ctx context.Context, token *oauth2.Token, identity *ExternalIdentity) error {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return err
+	}
+	if discovery.UserinfoEndpoint == "" {
+		return nil
+	}
+
+	var userInfo struct {
+		Sub           string      `json:"sub"`
+		Email         string      `json:"email"`
+		EmailVerified interface{} `json:"email_verified"`
+		Name          string      `json:"name"`
+		Picture       string      `json:"picture"`
+	}
+	if err := getJSON(ctx, p.httpClient, discovery.UserinfoEndpoint, token.AccessToken, &userInfo); err != nil {
+		return fmt.Errorf("failed to get userinfo: %w", err)
+	}
+	// userinfo の sub は ID トークンの sub と一致しなければならない（OIDC Core 5.3.2）
+	if userInfo.Sub != identity.Subject {
+		return errors.New("userinfo sub does not match id_token")
+	}
+	if identity.Email == "" {
+		identity.Email = userInfo.Email
+		identity.EmailVerified = isTrue(userInfo.EmailVerified)
+	}
+	if identity.Name == "" {
+		identity.Name = userInfo.Name
+	}
+	if identity.Picture == "" {
+		identity.Picture = userInfo.Picture
+	}
+	return nil
+}
+
+func (p *OIDCProvider) oauth2Config(ctx context.Context) (*oauth2.Config, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       p.cfg.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+	}, nil
+}
+
+func (p *OIDCProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+	var discovery oidcDiscovery
+	if err := getJSON(ctx, p.httpClient, wellKnown, "", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", p.cfg.Name, err)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("incomplete discovery document for %s", p.cfg.Name)
+	}
+	if !p.cfg.MultiTenant && strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(p.cfg.IssuerURL, "/") {
+		return nil, fmt.Errorf("issuer mismatch in discovery document for %s", p.cfg.Name)
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// getKey は kid に対応する公開鍵を返す（見つからなければ JWKS を取り直す）
+func (p *OIDCProvider) getKey(ctx context.Context, kid string) (interface{}, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if p.keys != nil && time.Since(p.keysAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, p.httpClient, discovery.JWKSURI, "", &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	keys := make(map[string]interface{})
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue // 対応していない鍵は無視する
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	p.keysAt = time.Now()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// jsonWebKey は JWKS に含まれる公開鍵（RSA / EC のみ対応）
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// getJSON は GET リクエストを送り、レスポンスの JSON を out にデコードする
+func getJSON(ctx context.Context, client *http.Client, url, accessToken string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// email_verified は bool の場合と文字列の場合がある
+func isTrue(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return b == "true"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testClientID    = "test-client"
+	testRedirectURL = "http://localhost:3000/auth/callback"
+	testKeyID       = "test-key"
+)
+
+// fakeOIDCServer はディスカバリー・認可・トークン・JWKS のエンドポイントを持つテスト用の OIDC サーバー
+// 認可リクエストの code_challenge と nonce を認可コードごとに覚えておき、トークン交換時に検証・返却する
+type fakeOIDCServer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+	// idTokenNonce が空でなければ、認可リクエストの nonce の代わりにこの値を ID トークンに入れる
+	idTokenNonce string
+}
+
+type authorization struct {
+	challenge string
+	nonce     string
+}
+
+func newFakeOIDCServer(t *testing.T) *fakeOIDCServer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeOIDCServer{key: key, codes: make(map[string]authorization)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 s.URL,
+			"authorization_endpoint": s.URL + "/authorize",
+			"token_endpoint":         s.URL + "/token",
+			"jwks_uri":               s.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": testKeyID,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// authorize はユーザーがログインした後のリダイレクトを返す（state はそのまま返す）
+func (s *fakeOIDCServer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != testClientID || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	code, err := randomString(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	s.codes[code] = authorization{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	s.mu.Unlock()
+
+	redirect, _ := url.Parse(q.Get("redirect_uri"))
+	params := url.Values{"code": {code}, "state": {q.Get("state")}}
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token は認可コードを1回だけ交換し、code_verifier が code_challenge と一致する場合のみ ID トークンを返す
+func (s *fakeOIDCServer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	auth, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	nonce := auth.nonce
+	if s.idTokenNonce != "" {
+		nonce = s.idTokenNonce
+	}
+	s.mu.Unlock()
+
+	if !ok || oauth2.S256ChallengeFromVerifier(r.PostForm.Get("code_verifier")) != auth.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            s.URL,
+		"sub":            "user-1",
+		"aud":            testClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          "user1@example.com",
+		"email_verified": true,
+		"name":           "User One",
+	})
+	idToken.Header["kid"] = testKeyID
+	raw, err := idToken.SignedString(s.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     raw,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// login は認可URLを作ってサーバーの認可エンドポイントを開き、リダイレクト先の code と state を返す
+func (s *fakeOIDCServer) login(t *testing.T, p *OIDCProvider, state, verifier, nonce string) (code, returnedState string) {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), state, verifier, nonce)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), testRedirectURL) {
+		t.Fatalf("redirected to %q, want %q", location, testRedirectURL)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func newTestOIDCProvider(s *fakeOIDCServer) *OIDCProvider {
+	return NewOIDCProvider(OIDCConfig{
+		Name:        "oidc",
+		IssuerURL:   s.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	}, s.Client())
+}
+
+func TestOIDCProviderAuthCodeURL(t *testing.T) {
+	s := newFakeOIDCServer(t)
+	p := newTestOIDCProvider(s)
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	want := map[string]string{
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"response_type":         "code",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        oauth2.S256ChallengeFromVerifier(verifier),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := q.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if q.Get("code_verifier") != "" {
+		t.Error("code_verifier must not be sent to the authorization endpoint")
+	}
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	s := newFakeOIDCServer(t)
+	p := newTestOIDCProvider(s)
+	verifier := oauth2.GenerateVerifier()
+
+	code, state := s.login(t, p, "state-1", verifier, "nonce-1")
+	if state != "state-1" {
+		t.Fatalf("state = %q, want %q", state, "state-1")
+	}
+
+	identity, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Provider != "oidc" || identity.Subject != "user-1" || identity.Email != "user1@example.com" || !identity.EmailVerified {
+		t.Errorf("unexpected identity: %+v", identity)
+	}
+
+	// 認可コードは1回しか使えない
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce-1"); err == nil {
+		t.Error("reused authorization code was accepted")
+	}
+}
+
+func TestOIDCProviderExchangeRejectsWrongVerifier(t *testing.T) {
+	s := newFakeOIDCServer(t)
+	p := newTestOIDCProvider(s)
+
+	code, _ := s.login(t, p, "state-1", oauth2.GenerateVerifier(), "nonce-1")
+	if _, err := p.Exchange(context.Background(), code, oauth2.GenerateVerifier(), "nonce-1"); err == nil {
+		t.Error("token exchange with a different code_verifier was accepted")
+	}
+}
+
+func TestOIDCProviderExchangeRejectsNonceMismatch(t *testing.T) {
+	s := newFakeOIDCServer(t)
+	p := newTestOIDCProvider(s)
+	verifier := oauth2.GenerateVerifier()
+
+	// state に保存した nonce と異なる nonce で認可した場合
+	code, _ := s.login(t, p, "state-1", verifier, "nonce-other")
+	_, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err == nil || !strings.Contains(err.Error(), "nonce mismatch") {
+		t.Errorf("err = %v, want nonce mismatch", err)
+	}
+
+	// サーバーが別の nonce の ID トークンを返した場合（リプレイ）
+	s.idTokenNonce = "replayed-nonce"
+	code, _ = s.login(t, p, "state-2", verifier, "nonce-2")
+	_, err = p.Exchange(context.Background(), code, verifier, "nonce-2")
+	if err == nil || !strings.Contains(err.Error(), "nonce mismatch") {
+		t.Errorf("err = %v, want nonce mismatch", err)
+	}
+}
+
+// state のない認可コードは、トークン交換の前に拒否する（従来の /api/auth/login も同じ）
+func TestLoginRequiresState(t *testing.T) {
+	s := newFakeOIDCServer(t)
+	p := newTestOIDCProvider(s)
+	code, _ := s.login(t, p, "state-1", oauth2.GenerateVerifier(), "nonce-1")
+
+	h := NewAuthHandler(nil, nil, NewProviderRegistry(p))
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login?provider=oidc&code="+url.QueryEscape(code), nil)
+	rec := httptest.NewRecorder()
+	if err := h.Login(e.NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
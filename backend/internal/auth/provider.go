@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrProviderNotFound は未設定のプロバイダが指定された場合に返す
+var ErrProviderNotFound = errors.New("oauth provider not found")
+
+// ExternalIdentity は外部プロバイダから取得したユーザー情報
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string // プロバイダ内で一意なユーザーID（OIDC の sub）
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// verifiedEmail はプロバイダが確認済みのメールアドレスを返す（未確認の場合は空文字）
+func (i *ExternalIdentity) verifiedEmail() string {
+	if !i.EmailVerified {
+		return ""
+	}
+	return i.Email
+}
+
+// Provider は OAuth2.0 / OIDC のログインプロバイダ
+// 認可URLの生成と、認可コード→ユーザー情報への変換だけを担当する
+// state の保存・検証はハンドラー側（oauthStateStore）で行う
+type Provider interface {
+	Name() string
+	// AuthCodeURL は PKCE（S256）のチャレンジと nonce を含んだ認可URLを返す
+	AuthCodeURL(ctx context.Context, state, codeVerifier, nonce string) (string, error)
+	// Exchange は認可コードをトークンに交換し、ID トークン等を検証した上でユーザー情報を返す
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*ExternalIdentity, error)
+}
+
+// ProviderRegistry は名前でプロバイダを引けるようにしたもの
+type ProviderRegistry struct {
+	providers map[string]Provider
+}
+
+// NewProviderRegistry は ProviderRegistry を生成
+func NewProviderRegistry(providers ...Provider) *ProviderRegistry {
+	r := &ProviderRegistry{providers: make(map[string]Provider)}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+	return r
+}
+
+// Get は名前に対応するプロバイダを返す
+func (r *ProviderRegistry) Get(name string) (Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrProviderNotFound, name)
+	}
+	return p, nil
+}
+
+// Names は設定済みのプロバイダ名を返す
+func (r *ProviderRegistry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadProvidersFromEnv は環境変数からプロバイダを設定する
+// CLIENT_ID が設定されているプロバイダだけを有効にする
+//
+//	GOOGLE_CLIENT_ID / GOOGLE_CLIENT_SECRET / GOOGLE_REDIRECT_URL
+//	GITHUB_CLIENT_ID / GITHUB_CLIENT_SECRET / GITHUB_REDIRECT_URL / GITHUB_API_URL（GitHub Enterprise 用、任意）
+//	MICROSOFT_CLIENT_ID / MICROSOFT_CLIENT_SECRET / MICROSOFT_REDIRECT_URL / MICROSOFT_TENANT（既定は common）
+//	OIDC_NAME / OIDC_ISSUER_URL / OIDC_CLIENT_ID / OIDC_CLIENT_SECRET / OIDC_REDIRECT_URL / OIDC_SCOPES（汎用 OIDC）
+//
+// 環境変数はパッケージ初期化時ではなく、godotenv の読み込み後（ルート登録時）に参照する
+func LoadProvidersFromEnv() *ProviderRegistry {
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	var providers []Provider
+
+	if clientID := os.Getenv("GOOGLE_CLIENT_ID"); clientID != "" {
+		providers = append(providers, NewOIDCProvider(OIDCConfig{
+			Name:         "google",
+			IssuerURL:    "https://accounts.google.com",
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("GOOGLE_REDIRECT_URL"),
+		}, httpClient))
+	}
+
+	if clientID := os.Getenv("GITHUB_CLIENT_ID"); clientID != "" {
+		providers = append(providers, NewGitHubProvider(GitHubConfig{
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("GITHUB_REDIRECT_URL"),
+			APIURL:       os.Getenv("GITHUB_API_URL"),
+		}, httpClient))
+	}
+
+	if clientID := os.Getenv("MICROSOFT_CLIENT_ID"); clientID != "" {
+		tenant := os.Getenv("MICROSOFT_TENANT")
+		if tenant == "" {
+			tenant = "common"
+		}
+		providers = append(providers, NewOIDCProvider(OIDCConfig{
+			Name:         "microsoft",
+			IssuerURL:    "https://login.microsoftonline.com/" + tenant + "/v2.0",
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("MICROSOFT_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("MICROSOFT_REDIRECT_URL"),
+			// マルチテナント（common 等）の場合、ID トークンの iss には実際のテナントIDが入る
+			MultiTenant: tenant == "common" || tenant == "organizations" || tenant == "consumers",
+		}, httpClient))
+	}
+
+	if issuer := os.Getenv("OIDC_ISSUER_URL"); issuer != "" {
+		name := os.Getenv("OIDC_NAME")
+		if name == "" {
+			name = "oidc"
+		}
+		var scopes []string
+		if s := os.Getenv("OIDC_SCOPES"); s != "" {
+			scopes = strings.Fields(strings.ReplaceAll(s, ",", " "))
+		}
+		providers = append(providers, NewOIDCProvider(OIDCConfig{
+			Name:         name,
+			IssuerURL:    issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+			Scopes:       scopes,
+		}, httpClient))
+	}
+
+	registry := NewProviderRegistry(providers...)
+	if len(providers) == 0 {
+		log.Println("Warning: No OAuth providers configured.")
+	} else {
+		log.Println("OAuth providers:", strings.Join(registry.Names(), ", "))
+	}
+	return registry
+}
@@ -1,20 +1,49 @@
 package auth
 
 import (
+	"OnlineLearningWebApp/pkg/middleware"
 	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
 func AuthRegisterRoutes(e *echo.Echo, db *gorm.DB, rdb *redis.Client) {
-	authHandler := NewAuthHandler(db, rdb)
+	authHandler := NewAuthHandler(db, rdb, LoadProvidersFromEnv())
 
-	// ログイン・ログアウト
+	// ログインに使えるプロバイダ一覧
+	e.GET("/api/auth/providers", authHandler.GetProviders)
+
+	// ログイン開始（認可URLの取得）とコールバック
+	e.GET("/api/auth/:provider/start", authHandler.StartLogin)
+	e.POST("/api/auth/:provider/callback", authHandler.Login)
+
+	// ログイン・ログアウト（/api/auth/login は provider クエリで指定、省略時は google。/start で発行した state が必要）
 	e.POST("/api/auth/login", authHandler.Login)
 	e.POST("/api/auth/logout", authHandler.Logout)
 
+	// アクセストークンの再発行（リフレッシュトークンのローテーション）
+	e.POST("/api/auth/refresh", authHandler.Refresh)
+
+	// メールアドレス・パスワードでのユーザー登録・ログイン
+	e.POST("/api/auth/register", authHandler.Register)
+	e.POST("/api/auth/verify-email", authHandler.VerifyEmail)
+	e.POST("/api/auth/verify-email/resend", authHandler.ResendVerificationEmail)
+	e.POST("/api/auth/local/login", authHandler.LocalLogin)
+
+	// パスワード再設定（メールで送ったリンクから再設定する）
+	e.POST("/api/auth/password/forgot", authHandler.ForgotPassword)
+	e.POST("/api/auth/password/reset", authHandler.ResetPassword)
+
 	// JWT認証が必要なエンドポイント
-	//protected := e.Group("/auth")
-	//protected.Use(middleware.JWTMiddleware)
+	protected := e.Group("/api/auth")
+	protected.Use(middleware.JWTMiddleware(rdb))
 	//protected.GET("/me", authHandler.Me) // 認証済みユーザー情報取得
+
+	// ログイン中のユーザーへのプロバイダの紐付け・解除
+	protected.GET("/identities", authHandler.GetIdentities)
+	protected.GET("/:provider/link", authHandler.StartLink)
+	protected.POST("/:provider/unlink", authHandler.Unlink)
+
+	// パスワード変更
+	protected.POST("/password/change", authHandler.ChangePassword)
 }
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/oauth2"
+)
+
+// state の有効期間（認可画面でログインしてコールバックされるまで）
+const oauthStateTTL = 10 * time.Minute
+
+// ErrInvalidOAuthState は state が存在しない・期限切れ・使用済みの場合に返す
+var ErrInvalidOAuthState = errors.New("invalid or expired oauth state")
+
+// oauthState は認可リクエスト開始時に保存し、コールバック時に照合する値
+type oauthState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"codeVerifier"` // PKCE
+	Nonce        string `json:"nonce"`        // ID トークンの nonce
+	LinkUserID   string `json:"linkUserId"`   // ログイン中のユーザーにプロバイダを紐付ける場合のみ
+}
+
+// oauthStateStore は state を Redis に保存する（1回だけ使えるように取得時に削除する）
+type oauthStateStore struct {
+	rdb *redis.Client
+}
+
+func oauthStateKey(state string) string { return "oauth_state:" + state }
+
+// Create は state・PKCE の verifier・nonce を生成して保存し、state を返す
+func (s *oauthStateStore) Create(ctx context.Context, provider, linkUserID string) (string, *oauthState, error) {
+	state, err := randomString(32)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return "", nil, err
+	}
+	data := &oauthState{
+		Provider:     provider,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.rdb.Set(ctx, oauthStateKey(state), raw, oauthStateTTL).Err(); err != nil {
+		return "", nil, err
+	}
+	return state, data, nil
+}
+
+// Consume は state を取り出して削除する。プロバイダが一致しない場合もエラーにする
+func (s *oauthStateStore) Consume(ctx context.Context, state, provider string) (*oauthState, error) {
+	if state == "" {
+		return nil, ErrInvalidOAuthState
+	}
+	raw, err := s.rdb.GetDel(ctx, oauthStateKey(state)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrInvalidOAuthState
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data oauthState
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return nil, err
+	}
+	if data.Provider != provider {
+		return nil, ErrInvalidOAuthState
+	}
+	return &data, nil
+}
+
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -1,23 +1,70 @@
 package notification
 
 import (
+	"OnlineLearningWebApp/pkg/utils"
 	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
+	"net/http"
+	"strconv"
 )
 
 // NotificationHandler は認証関連の処理を提供する構造体
 type NotificationHandler struct {
-	DB  *gorm.DB
-	RDB *redis.Client
+	DB      *gorm.DB
+	RDB     *redis.Client
+	Service *NotificationService
 }
 
 // NewNotificationHandler はNotificationHandlerを生成
 func NewNotificationHandler(db *gorm.DB, rdb *redis.Client) *NotificationHandler {
-	return &NotificationHandler{DB: db, RDB: rdb}
+	return &NotificationHandler{DB: db, RDB: rdb, Service: &NotificationService{DB: db}}
 }
 
 // GetNotifications **通知一覧を取得**
+// unread=true の場合は未読の通知のみ返す
 func (h *NotificationHandler) GetNotifications(c echo.Context) error {
-	return nil
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	unreadOnly := c.QueryParam("unread") == "true"
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+
+	notifications, unreadCount, err := h.Service.GetWebNotifications(userID, unreadOnly, page, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"unreadCount":   unreadCount,
+		"notifications": notifications,
+	})
+}
+
+// MarkNotificationsRead **通知を既読にする**
+// ids を省略した場合は、すべての未読の通知を既読にする
+func (h *NotificationHandler) MarkNotificationsRead(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	var req struct {
+		IDs []int `json:"ids"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	updated, err := h.Service.MarkWebNotificationsRead(userID, req.IDs)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"updated": updated})
 }
@@ -7,7 +7,9 @@ import (
 	"gorm.io/gorm"
 	"html/template"
 	"log"
+	"mime"
 	"net/smtp"
+	"os"
 	"path/filepath"
 	"sync"
 	"time"
@@ -170,13 +172,6 @@ type EmailData struct {
 // SendEmail
 // ** メール通知 **
 func (s *NotificationService) SendEmail(to string, userName string, message string, isProgressOnSchedule bool, progress float64, questionSetID int) error {
-	from := ""     // 通知を送信する用のアカウントのメールアドレスを設定する
-	password := "" // 通知を送信する用のアカウントのアプリパスワードを設定する
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
-
-	auth := smtp.PlainAuth("", from, password, smtpHost)
-
 	// **テンプレートファイルの読み込み**
 	templatePath := filepath.Join("templates", "email_template.html")
 	tmpl, err := template.ParseFiles(templatePath)
@@ -191,7 +186,7 @@ func (s *NotificationService) SendEmail(to string, userName string, message stri
 		Message:              message,
 		IsProgressOnSchedule: isProgressOnSchedule,
 		Progress:             progress, // 小数点を整数のパーセントに変換
-		QuestionSetURL:       fmt.Sprintf("http://localhost:3000/question/set/%d", questionSetID),
+		QuestionSetURL:       fmt.Sprintf("%s/question/set/%d", FrontendURL(), questionSetID),
 	}
 
 	var body bytes.Buffer
@@ -203,11 +198,30 @@ func (s *NotificationService) SendEmail(to string, userName string, message stri
 
 	// **メール送信**
 	currentDate := time.Now().Format("2006-01-02") // "2025-02-19" のような形式
-	subject := fmt.Sprintf("Subject: [%s] 学習進捗通知\r\n", currentDate)
+	return SendMail(to, fmt.Sprintf("[%s] 学習進捗通知", currentDate), body.String())
+}
+
+// SendMail
+// ** HTMLメールを1通送信する（進捗通知以外のメールでも使う）**
+// 送信元アカウントは環境変数 SMTP_FROM / SMTP_PASSWORD（アプリパスワード）で設定する
+func SendMail(to string, subject string, htmlBody string) error {
+	from := os.Getenv("SMTP_FROM")
+	password := os.Getenv("SMTP_PASSWORD")
+	smtpHost := os.Getenv("SMTP_HOST")
+	if smtpHost == "" {
+		smtpHost = "smtp.gmail.com"
+	}
+	smtpPort := os.Getenv("SMTP_PORT")
+	if smtpPort == "" {
+		smtpPort = "587"
+	}
+
+	auth := smtp.PlainAuth("", from, password, smtpHost)
+
 	headers := "MIME-Version: 1.0\r\nContent-Type: text/html; charset=UTF-8\r\n"
-	msg := subject + headers + "\r\n" + body.String()
+	msg := "Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n" + headers + "\r\n" + htmlBody
 
-	err = smtp.SendMail(smtpHost+":"+smtpPort, auth, from, []string{to}, []byte(msg))
+	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, from, []string{to}, []byte(msg))
 	if err != nil {
 		log.Println("Failed to send email:", err)
 		return err
@@ -216,3 +230,12 @@ func (s *NotificationService) SendEmail(to string, userName string, message stri
 	log.Println("Email sent successfully to", to)
 	return nil
 }
+
+// FrontendURL
+// メール本文のリンクに使うフロントエンドのURL（環境変数 FRONTEND_URL、未設定の場合はローカル）
+func FrontendURL() string {
+	if url := os.Getenv("FRONTEND_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:3000"
+}
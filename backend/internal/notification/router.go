@@ -2,6 +2,7 @@ package notification
 
 import (
 	"OnlineLearningWebApp/pkg/middleware"
+	"OnlineLearningWebApp/pkg/rbac"
 	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
@@ -12,11 +13,15 @@ func NotificationRegisterRoutes(e *echo.Echo, db *gorm.DB, rdb *redis.Client) {
 
 	// 認証が必要なルート
 	protected := e.Group("/api")
-	protected.Use(middleware.JWTMiddleware) // JWT認証ミドルウェアを適用（この処理を抜けないと下にはいけない）
+	protected.Use(middleware.JWTMiddleware(rdb)) // JWT認証ミドルウェアを適用（この処理を抜けないと下にはいけない）
+	protected.Use(middleware.RequirePermission(rbac.PermNotificationRead))
 
-	//notificationHandler := NewNotificationHandler(db, rdb)
+	notificationHandler := NewNotificationHandler(db, rdb)
 
 	// 通知を取得するAPI
-	//protected.GET("/AllGenres", notificationHandler.GetAllGenres)
+	protected.GET("/GetNotifications", notificationHandler.GetNotifications)
+
+	// 通知を既読にするAPI
+	protected.POST("/MarkNotificationsRead", notificationHandler.MarkNotificationsRead)
 
 }
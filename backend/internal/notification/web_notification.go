@@ -0,0 +1,76 @@
+package notification
+
+import (
+	"time"
+)
+
+// Web通知（画面の通知一覧に表示する通知。online_learning_notifications）
+// メールと違い、ユーザーが既読にするまで未読として残る
+
+// 通知の種類
+const (
+	// KindQuestionSetUpdated マイ学習リストに追加している問題集が修正された
+	KindQuestionSetUpdated = "question_set_updated"
+)
+
+// WebNotification 通知テーブルのレコード
+type WebNotification struct {
+	ID     int    `json:"id" gorm:"column:id;primaryKey"`
+	UserID string `json:"userId" gorm:"column:user_id"`
+	Kind   string `json:"kind" gorm:"column:kind"`
+	// 通知に関係する問題集（ない場合は nil）
+	QuestionSetID *int   `json:"questionSetId,omitempty" gorm:"column:question_set_id"`
+	Title         string `json:"title" gorm:"column:title"`
+	Message       string `json:"message" gorm:"column:message"`
+	// 既読にした日時（未読の場合は nil）
+	ReadAt    *time.Time `json:"readAt" gorm:"column:read_at"`
+	CreatedAt time.Time  `json:"createdAt" gorm:"column:created_at"`
+}
+
+// テーブル名を指定
+func (WebNotification) TableName() string {
+	return "online_learning_notifications"
+}
+
+// GetWebNotifications
+// ユーザー宛ての通知を新しい順に取得する（unreadOnly の場合は未読のみ）。未読の件数もあわせて返す
+func (s *NotificationService) GetWebNotifications(userID string, unreadOnly bool, page, limit int) ([]WebNotification, int64, error) {
+	// ページ番号・取得件数のバリデーション
+	if page < 1 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+
+	query := s.DB.Model(&WebNotification{}).Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+	var notifications []WebNotification
+	if err := query.Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&notifications).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var unreadCount int64
+	if err := s.DB.Model(&WebNotification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Count(&unreadCount).Error; err != nil {
+		return nil, 0, err
+	}
+	return notifications, unreadCount, nil
+}
+
+// MarkWebNotificationsRead
+// ユーザー宛ての通知を既読にする（ids が空の場合はすべての未読の通知）。既読にした件数を返す
+func (s *NotificationService) MarkWebNotificationsRead(userID string, ids []int) (int64, error) {
+	query := s.DB.Model(&WebNotification{}).Where("user_id = ? AND read_at IS NULL", userID)
+	if len(ids) > 0 {
+		query = query.Where("id IN (?)", ids)
+	}
+	result := query.Update("read_at", time.Now())
+	return result.RowsAffected, result.Error
+}
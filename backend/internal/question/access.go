@@ -0,0 +1,95 @@
+package question
+
+import "errors"
+
+// 問題集へのアクセス制御
+// 問題集を読む・回答する処理は、必ず AuthorizeQuestionSet を通すこと
+
+// AccessAction 問題集に対して何をしようとしているか
+type AccessAction int
+
+const (
+	// AccessRead 問題集の閲覧（詳細表示、マイ学習リストへの追加、お気に入り、評価）
+	AccessRead AccessAction = iota
+	// AccessAnswer 問題集の回答
+	AccessAnswer
+)
+
+var (
+	// ErrQuestionSetForbidden は閲覧・回答する権限がない問題集にアクセスした場合に返す（ハンドラーで403にする）
+	ErrQuestionSetForbidden = errors.New("この問題集にアクセスする権限がありません。")
+	// ErrQuestionNotInSet は出題されていない問題IDが指定された場合に返す（ハンドラーで400にする）
+	ErrQuestionNotInSet = errors.New("question does not belong to the question set")
+)
+
+// QuestionSetAccessInfo アクセス制御の判定に使う問題集の情報
+// Shared / Registered は判定するユーザーについての情報
+type QuestionSetAccessInfo struct {
+	QuestionSetID int    `gorm:"column:set_id"`
+	OwnerID       string `gorm:"column:user_id"`
+	Visibility    string `gorm:"column:visibility"`
+	// 共有トークンを開いたことがあるか（限定公開）
+	Shared bool `gorm:"column:shared"`
+	// マイ学習リストに追加しているか（アーカイブ）
+	Registered bool `gorm:"column:registered"`
+}
+
+// canAccessQuestionSet はアクセス制御のルール
+// 下書きは作成者のみ閲覧でき、誰も回答できない。それ以外の状態では作成者はすべての操作が可能
+// 作成者以外のユーザーは、公開（public）の問題集、共有トークンを開いた限定公開（unlisted）の問題集、
+// マイ学習リストに追加済みのアーカイブ（archived）の問題集のみ閲覧・回答できる
+func canAccessQuestionSet(info *QuestionSetAccessInfo, userID string, action AccessAction) bool {
+	if info.Visibility == VisibilityDraft {
+		return info.OwnerID == userID && action == AccessRead
+	}
+	if info.OwnerID == userID {
+		return true
+	}
+	switch action {
+	case AccessRead, AccessAnswer:
+		switch info.Visibility {
+		case VisibilityPublic:
+			return true
+		case VisibilityUnlisted:
+			return info.Shared
+		case VisibilityArchived:
+			return info.Registered
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+}
+
+// authorizeQuestionSetEdit 問題集を修正できるかを判定し、問題集の作成者のユーザーIDを返す
+// 作成者本人か、canEditAny（モデレーター）の場合のみ修正できる
+func (q QuestionService) authorizeQuestionSetEdit(userID string, questionSetID int, canEditAny bool) (string, error) {
+	owner, err := q.Repo.GetQuestionSetOwner(questionSetID)
+	if err != nil {
+		return "", err
+	}
+	if owner == "" {
+		return "", ErrQuestionSetNotFound
+	}
+	if owner != userID && !canEditAny {
+		return "", ErrNotQuestionWriter
+	}
+	return owner, nil
+}
+
+// AuthorizeQuestionSet 問題集に対する操作が許可されているかを判定する
+// 存在しない場合は ErrQuestionSetNotFound、権限がない場合は ErrQuestionSetForbidden を返す
+func (q QuestionService) AuthorizeQuestionSet(userID string, questionSetID int, action AccessAction) error {
+	info, err := q.Repo.GetQuestionSetAccessInfo(questionSetID, userID)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		return ErrQuestionSetNotFound
+	}
+	if !canAccessQuestionSet(info, userID, action) {
+		return ErrQuestionSetForbidden
+	}
+	return nil
+}
@@ -0,0 +1,682 @@
+package question
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 回答（アテンプト）
+// 回答画面には正解を含まない問題（DeliveredQuestion）だけを渡し、採点はサーバー側でのみ行う
+// 回答開始時にアテンプトを作成し、そのIDをアテンプトトークンとして SubmitQuestions で照合する
+// アテンプトと問題ごとの回答は online_learning_attempts / online_learning_attempt_responses に保存する
+
+// アテンプトの種類
+const (
+	AttemptKindStandard = "standard"  // 問題集の回答
+	AttemptKindReview   = "review"    // 復習（複数の問題集から復習期限が来た問題を出題する）
+	AttemptKindExam     = "exam"      // 試験モード（制限時間あり）
+	AttemptKindPractice = "practice"  // 間違えた問題の練習
+	AttemptKindMockExam = "mock_exam" // 模擬試験（複数のジャンルから出題する）
+)
+
+// アテンプトの状態
+const (
+	AttemptStatusInProgress = "in_progress"
+	AttemptStatusSubmitted  = "submitted"
+	AttemptStatusExpired    = "expired" // 制限時間を過ぎたため締め切った
+)
+
+// attemptGracePeriod 制限時間を過ぎてからも提出を受け付ける猶予（通信の遅延を考慮する）
+const attemptGracePeriod = 30 * time.Second
+
+// attemptTTL 回答中のアテンプトを再開できる期間（過ぎたものは定期実行で締め切る）
+const attemptTTL = 24 * time.Hour
+
+const (
+	// defaultAttemptListLimit 回答履歴の1ページあたりの件数
+	defaultAttemptListLimit = 10
+	// maxAttemptListLimit 回答履歴の1ページあたりの件数の上限
+	maxAttemptListLimit = 100
+)
+
+var (
+	// ErrInvalidAttemptToken はアテンプトトークンが存在しない・提出済み・別の問題集のものの場合に返す（ハンドラーで400にする）
+	ErrInvalidAttemptToken = errors.New("invalid or expired attempt token")
+	// ErrAttemptExpired は制限時間を過ぎてから提出された場合に返す（ハンドラーで409にする）
+	ErrAttemptExpired = errors.New("the time limit for this attempt has passed")
+	// ErrAttemptNotFound は閲覧しようとしたアテンプトが存在しない（または他のユーザーのもの）場合に返す（ハンドラーで404にする）
+	ErrAttemptNotFound = errors.New("attempt not found")
+)
+
+// Attempt 回答1回分の記録
+type Attempt struct {
+	ID            string `json:"id" gorm:"column:id;primaryKey"`
+	UserID        string `json:"-" gorm:"column:user_id"`
+	QuestionSetID int    `json:"questionSetId" gorm:"column:question_set_id"`
+	// 回答した問題集のリビジョン（問題集をまたいで出題するアテンプトは 0）
+	Revision       int    `json:"revision" gorm:"column:revision"`
+	Kind           string `json:"kind" gorm:"column:kind"`
+	Status         string `json:"status" gorm:"column:status"`
+	TotalQuestions int    `json:"totalQuestions" gorm:"column:total_questions"`
+	CorrectCount   int    `json:"correctCount" gorm:"column:correct_count"`
+	// 配点の合計と得点（Score は得点の割合。0〜100）
+	TotalPoints  int     `json:"totalPoints" gorm:"column:total_points"`
+	EarnedPoints float64 `json:"earnedPoints" gorm:"column:earned_points"`
+	Score        float64 `json:"score" gorm:"column:score"`
+	// 合格点（提出時の問題集の設定。0 の場合は合否を判定しない）と合否
+	PassThreshold float64    `json:"passThreshold" gorm:"column:pass_threshold"`
+	Passed        *bool      `json:"passed" gorm:"column:passed"`
+	StartedAt     time.Time  `json:"startedAt" gorm:"column:started_at"`
+	DeadlineAt    *time.Time `json:"deadlineAt" gorm:"column:deadline_at"` // 制限時間がない場合は nil
+	SubmittedAt   *time.Time `json:"submittedAt" gorm:"column:submitted_at"`
+	// 回答開始から提出までの秒数
+	DurationSeconds int `json:"durationSeconds" gorm:"column:duration_seconds"`
+}
+
+// isOverdue は猶予を含めても制限時間を過ぎているかを返す
+func (a *Attempt) isOverdue(now time.Time) bool {
+	return a.DeadlineAt != nil && now.After(a.DeadlineAt.Add(attemptGracePeriod))
+}
+
+// テーブル名を指定
+func (Attempt) TableName() string {
+	return "online_learning_attempts"
+}
+
+// AttemptResponse アテンプトで出題した問題と、その回答
+// 回答開始時に出題した問題の分だけ作成し、提出時に回答と正誤を記録する（未回答の問題は AnsweredAt が nil）
+type AttemptResponse struct {
+	AttemptID     string       `json:"-" gorm:"column:attempt_id;primaryKey"`
+	QuestionID    int          `json:"questionId" gorm:"column:question_id;primaryKey"`
+	Position      int          `json:"position" gorm:"column:position"`
+	UserAnswer    *AnswerValue `json:"userAnswer" gorm:"column:user_answer;type:jsonb"`
+	CorrectAnswer *AnswerValue `json:"correctAnswer" gorm:"column:correct_answer;type:jsonb"`
+	Correct       bool         `json:"correct" gorm:"column:correct"`
+	AnsweredAt    *time.Time   `json:"answeredAt" gorm:"column:answered_at"`
+	// 採点に使った正規化後の回答（記述式・数値の問題のみ）
+	NormalizedAnswer string `json:"normalizedAnswer" gorm:"column:normalized_answer"`
+	// 回答の自信度（sure / unsure / guess。未指定の場合は空文字）
+	Confidence string `json:"confidence" gorm:"column:confidence"`
+	// 回答中に表示したヒントの数
+	HintsUsed int `json:"hintsUsed" gorm:"column:hints_used"`
+	// テンプレート問題で出題した値
+	Variables templateValues `json:"variables,omitempty" gorm:"column:variables;type:jsonb"`
+	// 得点の割合（0〜1）、配点（出題時の値）と得点（ヒントを使った分を減らした値）
+	Credit       float64 `json:"credit" gorm:"column:credit"`
+	Points       int     `json:"points" gorm:"column:points"`
+	EarnedPoints float64 `json:"earnedPoints" gorm:"column:earned_points"`
+	// 問題ごとに回答にかかった秒数（フロントから送られた値を、回答開始からの経過時間までに切り詰める）
+	TimeSpentSeconds int `json:"timeSpentSeconds" gorm:"column:time_spent_seconds"`
+	// 出題した選択肢の並び順（別の端末で再開しても同じ順番で表示する）
+	Choices stringList `json:"-" gorm:"column:choices;type:jsonb"`
+	// 途中保存した日時（提出前の回答は UserAnswer に保存し、AnsweredAt は nil のまま）
+	SavedAt *time.Time `json:"-" gorm:"column:saved_at"`
+}
+
+// stringList 文字列の配列を jsonb 列に保存する
+type stringList []string
+
+// Value は jsonb 列に保存する値を返す
+func (l stringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan は jsonb 列の値を読み込む
+func (l *stringList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, (*[]string)(l))
+	case string:
+		return json.Unmarshal([]byte(v), (*[]string)(l))
+	default:
+		return fmt.Errorf("unexpected type for string list: %T", value)
+	}
+}
+
+// テーブル名を指定
+func (AttemptResponse) TableName() string {
+	return "online_learning_attempt_responses"
+}
+
+// AttemptSummary GetMyAttempts で返すアテンプトの一覧
+type AttemptSummary struct {
+	Attempt
+	Title string `json:"title" gorm:"column:title"`
+}
+
+// Value は user_answer / correct_answer 列に保存する値を返す
+func (a AnswerValue) Value() (driver.Value, error) {
+	b, err := a.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan は user_answer / correct_answer 列の値を読み込む
+func (a *AnswerValue) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return a.UnmarshalJSON(v)
+	case string:
+		return a.UnmarshalJSON([]byte(v))
+	default:
+		return fmt.Errorf("unexpected type for answer: %T", value)
+	}
+}
+
+// DeliveredQuestion 回答画面に渡す問題（正解は含めず、選択肢はシャッフル済み）
+type DeliveredQuestion struct {
+	ID        int      `json:"id"`
+	Title     string   `json:"title"`
+	Question  string   `json:"question"`
+	GenreName string   `json:"genreName"`
+	Type      string   `json:"type"`
+	Choices   []string `json:"choices"`
+	Points    int      `json:"points"`
+	HintCount int      `json:"hintCount"`
+}
+
+// QuizDelivery StartAttempt で返す構造体
+type QuizDelivery struct {
+	AttemptToken  string `json:"attemptToken"`
+	QuestionSetID int    `json:"questionSetId"`
+	// 出題した問題集のリビジョン（問題集をまたぐアテンプトは 0）
+	Revision   int                 `json:"revision"`
+	Questions  []DeliveredQuestion `json:"questions"`
+	StartedAt  time.Time           `json:"startedAt"`
+	DeadlineAt *time.Time          `json:"deadlineAt,omitempty"` // 試験モードのみ
+	// 途中保存した回答と秒数（再開した場合のみ）
+	SavedAnswers map[int]AnswerValue `json:"savedAnswers,omitempty"`
+	TimeSpent    map[int]int         `json:"timeSpent,omitempty"`
+	// 途中保存した自信度（再開した場合のみ）
+	Confidence map[int]string `json:"confidence,omitempty"`
+	// 表示済みのヒント（再開した場合のみ）
+	RevealedHints map[int][]string `json:"revealedHints,omitempty"`
+}
+
+// SubmitQuestionsRequest SubmitQuestions のリクエストボディ
+// answers は 問題ID → 回答、timeSpent は 問題ID → 回答にかかった秒数（任意）、confidence は 問題ID → 自信度（任意）
+type SubmitQuestionsRequest struct {
+	AttemptToken string              `json:"attemptToken"`
+	Answers      map[int]AnswerValue `json:"answers"`
+	TimeSpent    map[int]int         `json:"timeSpent"`
+	Confidence   map[int]string      `json:"confidence"`
+}
+
+// StartAttempt 回答を開始する
+// 回答できる問題集かを確認し、アテンプトと正解を含まない出題データを作成する
+// 同じ問題集に回答中のアテンプトがある場合は、新しく作らずにそのアテンプトを再開する
+func (q QuestionService) StartAttempt(userID string, questionSetID int) (*QuizDelivery, error) {
+	if err := q.AuthorizeQuestionSet(userID, questionSetID, AccessAnswer); err != nil {
+		return nil, err
+	}
+	if delivery, err := q.resumeAttempt(userID, questionSetID, AttemptKindStandard); err != nil || delivery != nil {
+		return delivery, err
+	}
+
+	questions, err := q.questionsOfSet(questionSetID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := q.Repo.GetQuestionSetSettings(questionSetID)
+	if err != nil {
+		return nil, err
+	}
+	return q.createAttempt(newAttempt(userID, questionSetID, AttemptKindStandard), drawQuestions(questions, settings))
+}
+
+// drawQuestions 問題集の設定に従って出題する問題と順番を決める
+// 問題プール（DrawCount）の場合はアテンプトごとに DrawCount 問を選ぶ。選んだ問題は attempt_responses に保存され、採点もその問題だけを対象にする
+func drawQuestions(questions []Question, settings *QuestionSetSettings) []Question {
+	pool := settings.DrawCount > 0 && settings.DrawCount < len(questions)
+	if !pool && !settings.ShuffleQuestions {
+		return questions
+	}
+	drawn := append([]Question(nil), questions...)
+	rand.Shuffle(len(drawn), func(i, j int) {
+		drawn[i], drawn[j] = drawn[j], drawn[i]
+	})
+	if pool {
+		drawn = drawn[:settings.DrawCount]
+	}
+	return drawn
+}
+
+// questionsOfSet 問題集の問題を出題順（問題ID順）に取得する
+func (q QuestionService) questionsOfSet(questionSetID int) ([]Question, error) {
+	questionIDs, err := q.Repo.GetQuestionIdsByQuestionSetId(questionSetID)
+	if err != nil {
+		return nil, err
+	}
+	if len(questionIDs) == 0 {
+		return nil, ErrQuestionSetNotFound
+	}
+	questions, err := q.Repo.GetQuestionsByIds(questionIDs)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(questions, func(i, j int) bool { return questions[i].ID < questions[j].ID })
+	return questions, nil
+}
+
+// newAttempt 回答を開始するアテンプトを作る
+// 問題集をまたいで出題する場合（復習など）は questionSetID を 0 にする
+func newAttempt(userID string, questionSetID int, kind string) *Attempt {
+	return &Attempt{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		QuestionSetID: questionSetID,
+		Kind:          kind,
+		Status:        AttemptStatusInProgress,
+		StartedAt:     time.Now(),
+	}
+}
+
+// createAttempt 出題する問題からアテンプトと正解を含まない出題データを作成する
+func (q QuestionService) createAttempt(attempt *Attempt, questions []Question) (*QuizDelivery, error) {
+	return q.createAttemptWith(attempt, questions, nil)
+}
+
+// createAttemptWith はアテンプトの作成と同じトランザクションで fn を実行する（fn が nil の場合は何もしない）
+func (q QuestionService) createAttemptWith(attempt *Attempt, questions []Question, fn func(repo QuestionRepository) error) (*QuizDelivery, error) {
+	attempt.TotalQuestions = len(questions)
+	delivery := &QuizDelivery{
+		AttemptToken:  attempt.ID,
+		QuestionSetID: attempt.QuestionSetID,
+		StartedAt:     attempt.StartedAt,
+		DeadlineAt:    attempt.DeadlineAt,
+	}
+	var responses []AttemptResponse
+	for i, question := range questions {
+		// テンプレート問題はアテンプトごとに値を選んで問題文を作る
+		variables, err := instantiateTemplate(&question)
+		if err != nil {
+			return nil, err
+		}
+		choices := deliveryChoices(question)
+		points := pointsOf(question.Spec)
+		attempt.TotalPoints += points
+		responses = append(responses, AttemptResponse{
+			AttemptID:  attempt.ID,
+			QuestionID: question.ID,
+			Position:   i + 1,
+			Choices:    choices,
+			Variables:  variables,
+			Points:     points,
+		})
+		delivery.Questions = append(delivery.Questions, deliveredQuestion(question, choices))
+	}
+
+	if err := q.Repo.Transaction(func(repo QuestionRepository) error {
+		// 問題集のアテンプトは、出題した時点のリビジョンを記録する
+		if attempt.QuestionSetID != 0 {
+			info, err := repo.GetQuestionSetInfo(attempt.QuestionSetID)
+			if err != nil {
+				return err
+			}
+			if info != nil {
+				attempt.Revision = info.Revision
+			}
+		}
+		if err := repo.CreateAttempt(attempt, responses); err != nil {
+			return err
+		}
+		if fn == nil {
+			return nil
+		}
+		return fn(repo)
+	}); err != nil {
+		return nil, err
+	}
+	delivery.Revision = attempt.Revision
+	return delivery, nil
+}
+
+// deliveredQuestion 回答画面に渡す問題を作る
+func deliveredQuestion(question Question, choices []string) DeliveredQuestion {
+	return DeliveredQuestion{
+		ID:        question.ID,
+		Title:     question.Title,
+		Question:  question.Question,
+		GenreName: question.GenreName,
+		Type:      question.QuestionType,
+		Choices:   choices,
+		Points:    pointsOf(question.Spec),
+		HintCount: question.HintCount,
+	}
+}
+
+// SubmitAttempt 回答を提出する
+// アテンプトトークンを照合して採点し、アテンプト・回答・初めて正解した問題・進捗率を1トランザクションで記録する
+// 同じアテンプトは1回しか提出できない。途中保存した回答も提出した回答とあわせて採点する
+// 制限時間を過ぎて提出された場合は採点せずにアテンプトを締め切り、ErrAttemptExpired を返す
+// 問題集をまたぐアテンプト（復習など）は questionSetID に 0 を指定する
+func (q QuestionService) SubmitAttempt(userID string, questionSetID int, req SubmitQuestionsRequest) (*Attempt, error) {
+	if questionSetID != 0 {
+		if err := q.AuthorizeQuestionSet(userID, questionSetID, AccessAnswer); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateConfidence(req.Confidence); err != nil {
+		return nil, err
+	}
+
+	var submitted *Attempt
+	expired := false
+	err := q.Repo.Transaction(func(repo QuestionRepository) error {
+		// アテンプトトークンを照合する（別のユーザー・別の問題集・提出済みのトークンは無効）
+		attempt, err := repo.GetAttemptForUpdate(req.AttemptToken)
+		if err != nil {
+			return err
+		}
+		if attempt == nil || attempt.UserID != userID || attempt.QuestionSetID != questionSetID || attempt.Status != AttemptStatusInProgress {
+			return ErrInvalidAttemptToken
+		}
+
+		// 制限時間を過ぎている場合は締め切る（締め切った記録は残すため、エラーにせずコミットする）
+		now := time.Now()
+		if attempt.isOverdue(now) {
+			expired = true
+			return closeAttempt(repo, attempt, AttemptStatusExpired, now)
+		}
+
+		responses, err := repo.GetAttemptResponses(attempt.ID)
+		if err != nil {
+			return err
+		}
+		delivered := make(map[int]AttemptResponse, len(responses))
+		for _, response := range responses {
+			delivered[response.QuestionID] = response
+		}
+		// 出題されていない問題IDが送られてきた場合は採点しない
+		for questionID := range req.Answers {
+			if _, ok := delivered[questionID]; !ok {
+				return ErrQuestionNotInSet
+			}
+		}
+		merged := mergeDraftAnswers(responses, req)
+		if len(merged.Answers) == 0 {
+			return fmt.Errorf("%w: answers is required", ErrInvalidQuestion)
+		}
+
+		// 問題が所属する問題集（回答できなくなった問題集の問題は採点しない）
+		var answeredIDs []int
+		for questionID := range merged.Answers {
+			answeredIDs = append(answeredIDs, questionID)
+		}
+		setIDs, err := repo.GetQuestionSetIdsByQuestionIds(answeredIDs)
+		if err != nil {
+			return err
+		}
+		if questionSetID == 0 {
+			authorized := make(map[int]bool)
+			for _, setID := range setIDs {
+				if authorized[setID] {
+					continue
+				}
+				if err := q.AuthorizeQuestionSet(userID, setID, AccessAnswer); err != nil {
+					return err
+				}
+				authorized[setID] = true
+			}
+		}
+
+		// 回答の正誤判定（問題の種類ごとの採点）
+		results, err := gradeResponses(repo, attempt, merged.Answers, delivered)
+		if err != nil {
+			return err
+		}
+		for i := range results {
+			results[i].Confidence = merged.Confidence[results[i].QuestionID]
+		}
+
+		// 問題ごとの回答を記録
+		elapsed := int(now.Sub(attempt.StartedAt).Seconds())
+		var answered []AttemptResponse
+		newCorrectAnswers := make(map[int][]int) // 問題集ID → 初めて正解した問題
+		answeredSets := make(map[int]bool)
+		var liveResults []Result // 今も問題集に残っている問題の結果（復習・進捗に使う）
+		for _, result := range results {
+			// 回答中に削除された問題も出題したリビジョンで採点するが、復習・進捗には含めない
+			setID, live := setIDs[result.QuestionID]
+			if live {
+				answeredSets[setID] = true
+				liveResults = append(liveResults, result)
+			}
+			attempt.EarnedPoints += result.EarnedPoints
+			userAnswer, correctAnswer := result.UserAnswer, result.CorrectAnswer
+			answered = append(answered, AttemptResponse{
+				AttemptID:        attempt.ID,
+				QuestionID:       result.QuestionID,
+				UserAnswer:       &userAnswer,
+				CorrectAnswer:    &correctAnswer,
+				Correct:          result.Correct,
+				AnsweredAt:       &now,
+				NormalizedAnswer: result.NormalizedAnswer,
+				Credit:           result.Credit,
+				Points:           result.Points,
+				EarnedPoints:     result.EarnedPoints,
+				TimeSpentSeconds: clampSeconds(merged.TimeSpent[result.QuestionID], elapsed),
+				Confidence:       result.Confidence,
+			})
+			if result.Correct {
+				attempt.CorrectCount++
+				if !live {
+					continue
+				}
+				// 初めて正解した問題のチェック
+				count, err := repo.CountCorrectAnswers(userID, result.QuestionID)
+				if err != nil {
+					return err
+				}
+				if count == 0 {
+					newCorrectAnswers[setID] = append(newCorrectAnswers[setID], result.QuestionID)
+				}
+			}
+		}
+		if err := repo.SaveAttemptResponses(answered); err != nil {
+			return err
+		}
+
+		// アテンプトを提出済みにして、問題集に合格点が設定されていれば合否を判定する
+		if attempt.QuestionSetID != 0 {
+			settings, err := repo.GetQuestionSetSettings(attempt.QuestionSetID)
+			if err != nil {
+				return err
+			}
+			attempt.PassThreshold = settings.PassThreshold
+		}
+		if err := closeAttempt(repo, attempt, AttemptStatusSubmitted, now); err != nil {
+			return err
+		}
+
+		// 復習スケジュールの更新
+		if err := updateReviewStates(repo, userID, liveResults, now, attempt.Kind == AttemptKindReview); err != nil {
+			return err
+		}
+
+		// 問題集をマイ学習リストに追加している場合は、初めて正解した問題を online_learning_correct_answers に追加して進捗率を更新する
+		for setID := range answeredSets {
+			if err := recordProgress(repo, userID, setID, newCorrectAnswers[setID]); err != nil {
+				return err
+			}
+		}
+
+		submitted = attempt
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, ErrAttemptExpired
+	}
+	return submitted, nil
+}
+
+// closeAttempt アテンプトを提出済み・締め切りにして、得点と所要時間を記録する
+func closeAttempt(repo QuestionRepository, attempt *Attempt, status string, now time.Time) error {
+	attempt.Status = status
+	attempt.SubmittedAt = &now
+	attempt.DurationSeconds = int(now.Sub(attempt.StartedAt).Seconds())
+	switch {
+	case attempt.TotalPoints > 0:
+		attempt.Score = attempt.EarnedPoints / float64(attempt.TotalPoints) * 100
+	case attempt.TotalQuestions > 0:
+		attempt.Score = float64(attempt.CorrectCount) / float64(attempt.TotalQuestions) * 100
+	}
+	if status == AttemptStatusSubmitted && attempt.PassThreshold > 0 {
+		passed := attempt.Score >= attempt.PassThreshold
+		attempt.Passed = &passed
+	}
+	return repo.FinalizeAttempt(attempt)
+}
+
+// clampSeconds フロントから送られた秒数を 0〜max の範囲に切り詰める
+func clampSeconds(seconds, max int) int {
+	if seconds < 0 {
+		return 0
+	}
+	if seconds > max {
+		return max
+	}
+	return seconds
+}
+
+// recordProgress マイ学習リストに追加している問題集の場合、初めて正解した問題と進捗率・ステータスを更新する
+func recordProgress(repo QuestionRepository, userID string, questionSetID int, newCorrectAnswers []int) error {
+	countIsRegistered, err := repo.CountIsRegistered(userID, questionSetID)
+	if err != nil {
+		return err
+	}
+	if countIsRegistered == 0 {
+		return nil
+	}
+	// 初めて正解した問題を online_learning_correct_answers に追加
+	if len(newCorrectAnswers) > 0 {
+		var insertValues []map[string]interface{}
+		for _, qID := range newCorrectAnswers {
+			insertValues = append(insertValues, map[string]interface{}{
+				"user_id":         userID,
+				"question_id":     qID,
+				"question_set_id": questionSetID,
+			})
+		}
+		if err := repo.InsertCorrectAnswers(insertValues); err != nil {
+			return err
+		}
+	}
+	// 進捗率の更新
+	if err := repo.UpdateProgress(userID, questionSetID); err != nil {
+		return err
+	}
+	// online_learning_my_questionsのstatusがnot_startedならin_progressに変更
+	return repo.ChangeStatusToInProgress(userID, questionSetID)
+}
+
+// GetAttemptResult 過去のアテンプトの結果を取得する（自分のアテンプトのみ）
+func (q QuestionService) GetAttemptResult(userID, attemptID string) (*SubmissionResult, error) {
+	attempt, err := q.Repo.GetAttempt(attemptID)
+	if err != nil {
+		return nil, err
+	}
+	if attempt == nil || attempt.UserID != userID {
+		return nil, ErrAttemptNotFound
+	}
+	responses, err := q.Repo.GetAttemptResponses(attempt.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 採点後なので、解説・参考リンク・ヒントもあわせて返す
+	var questionIDs []int
+	for _, response := range responses {
+		questionIDs = append(questionIDs, response.QuestionID)
+	}
+	explanations, err := q.Repo.GetQuestionExplanations(questionIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SubmissionResult{
+		Attempt:  *attempt,
+		Progress: "updated",
+	}
+	for _, response := range responses {
+		// 未回答の問題は結果に含めない
+		if response.AnsweredAt == nil {
+			continue
+		}
+		result.Results = append(result.Results, Result{
+			QuestionID:          response.QuestionID,
+			UserAnswer:          derefAnswer(response.UserAnswer),
+			CorrectAnswer:       derefAnswer(response.CorrectAnswer),
+			Correct:             response.Correct,
+			NormalizedAnswer:    response.NormalizedAnswer,
+			Credit:              response.Credit,
+			Points:              response.Points,
+			EarnedPoints:        response.EarnedPoints,
+			TimeSpentSeconds:    response.TimeSpentSeconds,
+			HintsUsed:           response.HintsUsed,
+			Confidence:          response.Confidence,
+			QuestionExplanation: explanations[response.QuestionID],
+		})
+	}
+	return result, nil
+}
+
+// GetMyAttempts 自分のアテンプトの一覧を取得する（questionSetID が 0 の場合はすべての問題集）
+func (q QuestionService) GetMyAttempts(userID string, questionSetID, page, limit int) ([]AttemptSummary, int64, error) {
+	// ページ番号・取得件数のバリデーション
+	if page < 1 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = defaultAttemptListLimit
+	}
+	if limit > maxAttemptListLimit {
+		limit = maxAttemptListLimit
+	}
+	offset := (page - 1) * limit
+	return q.Repo.GetAttempts(userID, questionSetID, offset, limit)
+}
+
+func derefAnswer(a *AnswerValue) AnswerValue {
+	if a == nil {
+		return AnswerValue{}
+	}
+	return *a
+}
+
+// shuffleChoices 正解と選択肢をまとめてシャッフルする（空の選択肢は除く）
+// 正解が常に同じ位置にならないよう、アテンプトごとに並び順を変える
+func shuffleChoices(choices ...string) []string {
+	var shuffled []string
+	for _, choice := range choices {
+		if choice != "" {
+			shuffled = append(shuffled, choice)
+		}
+	}
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return shuffled
+}
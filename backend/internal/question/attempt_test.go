@@ -0,0 +1,40 @@
+package question
+
+import "testing"
+
+// attemptListRepository は GetAttempts に渡された offset と limit を記録する
+type attemptListRepository struct {
+	QuestionRepository
+	offset, limit int
+}
+
+func (r *attemptListRepository) GetAttempts(userID string, questionSetID, offset, limit int) ([]AttemptSummary, int64, error) {
+	r.offset, r.limit = offset, limit
+	return nil, 0, nil
+}
+
+func TestGetMyAttemptsPaging(t *testing.T) {
+	tests := []struct {
+		name        string
+		page, limit int
+		wantOffset  int
+		wantLimit   int
+	}{
+		{"defaults", 0, 0, 0, defaultAttemptListLimit},
+		{"negative limit", 1, -5, 0, defaultAttemptListLimit},
+		{"second page", 2, 20, 20, 20},
+		{"limit at maximum", 1, maxAttemptListLimit, 0, maxAttemptListLimit},
+		{"limit above maximum", 3, 100000, 2 * maxAttemptListLimit, maxAttemptListLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &attemptListRepository{}
+			if _, _, err := (QuestionService{Repo: repo}).GetMyAttempts("user-1", 0, tt.page, tt.limit); err != nil {
+				t.Fatal(err)
+			}
+			if repo.offset != tt.wantOffset || repo.limit != tt.wantLimit {
+				t.Errorf("offset, limit = %d, %d; want %d, %d", repo.offset, repo.limit, tt.wantOffset, tt.wantLimit)
+			}
+		})
+	}
+}
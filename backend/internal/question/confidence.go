@@ -0,0 +1,119 @@
+package question
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 回答の自信度とキャリブレーション
+// 回答ごとに自信度（sure / unsure / guess）を付けられるようにし、復習スケジュールの回答の質に反映する
+// 正解でも自信がなかった問題は早めに復習に戻す。自信度ごとの正答率をジャンル別に集計して返す
+
+// 回答の自信度（未指定の場合は空文字）
+const (
+	ConfidenceSure   = "sure"
+	ConfidenceUnsure = "unsure"
+	ConfidenceGuess  = "guess"
+)
+
+// confidenceLevels 集計で返す自信度の並び順
+var confidenceLevels = []string{ConfidenceSure, ConfidenceUnsure, ConfidenceGuess}
+
+// validateConfidence はリクエストの自信度を検証する
+func validateConfidence(confidence map[int]string) error {
+	for questionID, level := range confidence {
+		switch level {
+		case "", ConfidenceSure, ConfidenceUnsure, ConfidenceGuess:
+		default:
+			return fmt.Errorf("%w: unknown confidence %q for question %d", ErrInvalidQuestion, level, questionID)
+		}
+	}
+	return nil
+}
+
+// CalibrationStat 自信度ごとの回答数と正解数（リポジトリの集計結果）
+type CalibrationStat struct {
+	GenreID       int    `gorm:"column:genre_id"`
+	GenreName     string `gorm:"column:genre_name"`
+	Confidence    string `gorm:"column:confidence"`
+	AnsweredCount int    `gorm:"column:answered_count"`
+	CorrectCount  int    `gorm:"column:correct_count"`
+}
+
+// CalibrationBucket 自信度ごとの正答率
+type CalibrationBucket struct {
+	Confidence    string  `json:"confidence"`
+	AnsweredCount int     `json:"answeredCount"`
+	CorrectCount  int     `json:"correctCount"`
+	Accuracy      float64 `json:"accuracy"` // 0〜100
+}
+
+// GenreCalibration ジャンルごとの自信度別の正答率
+type GenreCalibration struct {
+	GenreID   int                 `json:"genreId"`
+	GenreName string              `json:"genreName"`
+	Buckets   []CalibrationBucket `json:"buckets"`
+}
+
+// CalibrationReport GetCalibrationReport で返す構造体
+type CalibrationReport struct {
+	Overall []CalibrationBucket `json:"overall"`
+	Genres  []GenreCalibration  `json:"genres"`
+}
+
+// GetCalibrationReport 自信度ごとの正答率を全体とジャンル別に集計する（genreID が 0 の場合はすべてのジャンル）
+func (q QuestionService) GetCalibrationReport(userID string, genreID int) (*CalibrationReport, error) {
+	stats, err := q.Repo.GetCalibrationStats(userID, genreID)
+	if err != nil {
+		return nil, err
+	}
+
+	overall := make(map[string]*CalibrationBucket)
+	genres := make(map[int]*GenreCalibration)
+	byGenre := make(map[int]map[string]*CalibrationBucket)
+	for _, stat := range stats {
+		if _, ok := genres[stat.GenreID]; !ok {
+			genres[stat.GenreID] = &GenreCalibration{GenreID: stat.GenreID, GenreName: stat.GenreName}
+			byGenre[stat.GenreID] = make(map[string]*CalibrationBucket)
+		}
+		addCalibration(overall, stat)
+		addCalibration(byGenre[stat.GenreID], stat)
+	}
+
+	report := &CalibrationReport{
+		Overall: calibrationBuckets(overall),
+		Genres:  []GenreCalibration{},
+	}
+	for id, genre := range genres {
+		genre.Buckets = calibrationBuckets(byGenre[id])
+		report.Genres = append(report.Genres, *genre)
+	}
+	sort.Slice(report.Genres, func(i, j int) bool { return report.Genres[i].GenreID < report.Genres[j].GenreID })
+	return report, nil
+}
+
+func addCalibration(buckets map[string]*CalibrationBucket, stat CalibrationStat) {
+	bucket, ok := buckets[stat.Confidence]
+	if !ok {
+		bucket = &CalibrationBucket{Confidence: stat.Confidence}
+		buckets[stat.Confidence] = bucket
+	}
+	bucket.AnsweredCount += stat.AnsweredCount
+	bucket.CorrectCount += stat.CorrectCount
+}
+
+// calibrationBuckets は自信度の順に並べ、正答率を計算する（回答がない自信度も 0 件として含める）
+func calibrationBuckets(buckets map[string]*CalibrationBucket) []CalibrationBucket {
+	var result []CalibrationBucket
+	for _, level := range confidenceLevels {
+		bucket := CalibrationBucket{Confidence: level}
+		if b, ok := buckets[level]; ok {
+			bucket = *b
+		}
+		if bucket.AnsweredCount > 0 {
+			bucket.Accuracy = float64(bucket.CorrectCount) / float64(bucket.AnsweredCount) * 100
+		}
+		result = append(result, bucket)
+	}
+	return result
+}
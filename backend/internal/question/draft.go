@@ -0,0 +1,243 @@
+package question
+
+import (
+	"log"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+// 回答の途中保存と再開
+// 回答中のアテンプトに回答を少しずつ保存し、別の端末からでも同じアテンプトを再開できるようにする
+// 提出されないまま有効期間（attemptTTL）や制限時間を過ぎたアテンプトは、定期実行で締め切る
+
+// ResumeAttempt 回答中のアテンプトを再開する（途中保存した回答も返す）
+// questionSetID が 0 の場合は復習のアテンプトを再開する
+func (q QuestionService) ResumeAttempt(userID string, questionSetID int) (*QuizDelivery, error) {
+	if questionSetID != 0 {
+		if err := q.AuthorizeQuestionSet(userID, questionSetID, AccessAnswer); err != nil {
+			return nil, err
+		}
+	}
+	delivery, err := q.resumeAttempt(userID, questionSetID, "")
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil {
+		return nil, ErrAttemptNotFound
+	}
+	return delivery, nil
+}
+
+// resumeAttempt 回答中のアテンプトがあれば出題データを作り直して返す（なければ nil）
+// kind が空の場合は種類を問わず最後に開始したアテンプトを対象にする
+func (q QuestionService) resumeAttempt(userID string, questionSetID int, kind string) (*QuizDelivery, error) {
+	now := time.Now()
+	attempt, err := q.Repo.GetActiveAttempt(userID, questionSetID, kind, now.Add(-attemptTTL))
+	if err != nil || attempt == nil {
+		return nil, err
+	}
+	// 制限時間を過ぎている場合は締め切って、再開できるアテンプトはないものとする
+	if attempt.isOverdue(now) {
+		err := q.Repo.Transaction(func(repo QuestionRepository) error {
+			return closeAttempt(repo, attempt, AttemptStatusExpired, now)
+		})
+		return nil, err
+	}
+
+	responses, err := q.Repo.GetAttemptResponses(attempt.ID)
+	if err != nil {
+		return nil, err
+	}
+	var questionIDs []int
+	for _, response := range responses {
+		questionIDs = append(questionIDs, response.QuestionID)
+	}
+	questions, err := q.Repo.GetQuestionsByIds(questionIDs)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]Question, len(questions))
+	for _, question := range questions {
+		byID[question.ID] = question
+	}
+
+	delivery := &QuizDelivery{
+		AttemptToken:  attempt.ID,
+		QuestionSetID: attempt.QuestionSetID,
+		StartedAt:     attempt.StartedAt,
+		DeadlineAt:    attempt.DeadlineAt,
+		SavedAnswers:  make(map[int]AnswerValue),
+		TimeSpent:     make(map[int]int),
+		Confidence:    make(map[int]string),
+	}
+	// 表示済みのヒント
+	var hintedIDs []int
+	for _, response := range responses {
+		if response.HintsUsed > 0 {
+			hintedIDs = append(hintedIDs, response.QuestionID)
+		}
+	}
+	explanations := make(map[int]QuestionExplanation)
+	if len(hintedIDs) > 0 {
+		if explanations, err = q.Repo.GetQuestionExplanations(hintedIDs); err != nil {
+			return nil, err
+		}
+		delivery.RevealedHints = make(map[int][]string)
+	}
+
+	for _, response := range responses {
+		question, ok := byID[response.QuestionID]
+		if !ok {
+			continue // 回答中に削除された問題
+		}
+		// 出題時の選択肢の並び順を使う（保存されていない場合はシャッフルし直す）
+		choices := []string(response.Choices)
+		if choices == nil {
+			choices = deliveryChoices(question)
+		}
+		// テンプレート問題は出題したときの値で問題文を作り直す
+		if question.QuestionType == QuestionTypeTemplate && response.Variables != nil {
+			question.Question = renderTemplate(question.Question, response.Variables)
+		}
+		delivery.Questions = append(delivery.Questions, deliveredQuestion(question, choices))
+		if response.UserAnswer != nil && response.AnsweredAt == nil {
+			delivery.SavedAnswers[response.QuestionID] = *response.UserAnswer
+			delivery.TimeSpent[response.QuestionID] = response.TimeSpentSeconds
+			if response.Confidence != "" {
+				delivery.Confidence[response.QuestionID] = response.Confidence
+			}
+		}
+		if hints := explanations[response.QuestionID].Hints; response.HintsUsed > 0 {
+			delivery.RevealedHints[response.QuestionID] = hints[:min(response.HintsUsed, len(hints))]
+		}
+	}
+	return delivery, nil
+}
+
+// SaveDraftAnswers 回答中のアテンプトに回答を途中保存する（採点はしない）
+// 同じ問題を再度保存した場合は上書きする。制限時間を過ぎている場合は締め切り、ErrAttemptExpired を返す
+func (q QuestionService) SaveDraftAnswers(userID string, req SubmitQuestionsRequest) (*time.Time, error) {
+	if len(req.Answers) == 0 {
+		return nil, ErrInvalidQuestion
+	}
+	if err := validateConfidence(req.Confidence); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expired := false
+	err := q.Repo.Transaction(func(repo QuestionRepository) error {
+		attempt, err := repo.GetAttemptForUpdate(req.AttemptToken)
+		if err != nil {
+			return err
+		}
+		if attempt == nil || attempt.UserID != userID || attempt.Status != AttemptStatusInProgress {
+			return ErrInvalidAttemptToken
+		}
+		if attempt.isOverdue(now) {
+			expired = true
+			return closeAttempt(repo, attempt, AttemptStatusExpired, now)
+		}
+
+		responses, err := repo.GetAttemptResponses(attempt.ID)
+		if err != nil {
+			return err
+		}
+		existing := make(map[int]AttemptResponse, len(responses))
+		for _, response := range responses {
+			existing[response.QuestionID] = response
+		}
+
+		elapsed := int(now.Sub(attempt.StartedAt).Seconds())
+		var drafts []AttemptResponse
+		for questionID, answer := range req.Answers {
+			response, ok := existing[questionID]
+			if !ok {
+				return ErrQuestionNotInSet
+			}
+			answer := answer
+			timeSpent := response.TimeSpentSeconds
+			if seconds, ok := req.TimeSpent[questionID]; ok {
+				timeSpent = clampSeconds(seconds, elapsed)
+			}
+			confidence := response.Confidence
+			if level, ok := req.Confidence[questionID]; ok {
+				confidence = level
+			}
+			drafts = append(drafts, AttemptResponse{
+				AttemptID:        attempt.ID,
+				QuestionID:       questionID,
+				UserAnswer:       &answer,
+				TimeSpentSeconds: timeSpent,
+				Confidence:       confidence,
+				SavedAt:          &now,
+			})
+		}
+		return repo.SaveDraftResponses(drafts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, ErrAttemptExpired
+	}
+	return &now, nil
+}
+
+// mergeDraftAnswers 途中保存した回答に、提出された回答（秒数・自信度も含む）を上書きしてまとめる
+func mergeDraftAnswers(responses []AttemptResponse, req SubmitQuestionsRequest) SubmitQuestionsRequest {
+	merged := SubmitQuestionsRequest{
+		AttemptToken: req.AttemptToken,
+		Answers:      make(map[int]AnswerValue),
+		TimeSpent:    make(map[int]int),
+		Confidence:   make(map[int]string),
+	}
+	for _, response := range responses {
+		if response.UserAnswer != nil && response.AnsweredAt == nil {
+			merged.Answers[response.QuestionID] = *response.UserAnswer
+			merged.TimeSpent[response.QuestionID] = response.TimeSpentSeconds
+			merged.Confidence[response.QuestionID] = response.Confidence
+		}
+	}
+	for questionID, answer := range req.Answers {
+		merged.Answers[questionID] = answer
+	}
+	for questionID, seconds := range req.TimeSpent {
+		merged.TimeSpent[questionID] = seconds
+	}
+	for questionID, level := range req.Confidence {
+		merged.Confidence[questionID] = level
+	}
+	return merged
+}
+
+// ExpireStaleAttempts 提出されないまま有効期間や制限時間を過ぎたアテンプトを締め切る
+func (q QuestionService) ExpireStaleAttempts() (int64, error) {
+	now := time.Now()
+	return q.Repo.ExpireAttempts(now.Add(-attemptTTL), now.Add(-attemptGracePeriod), now)
+}
+
+// ScheduleAttemptCleanup 期限切れのアテンプトを締め切る処理を定期実行する
+func ScheduleAttemptCleanup(db *gorm.DB) {
+	service := &QuestionService{Repo: &GormRepository{DB: db}}
+	c := cron.New()
+
+	_, err := c.AddFunc("*/10 * * * *", func() { // 10分ごと
+		count, err := service.ExpireStaleAttempts()
+		if err != nil {
+			log.Println("Failed to expire attempts:", err)
+			return
+		}
+		if count > 0 {
+			log.Printf("Expired %d attempts", count)
+		}
+	})
+
+	if err != nil {
+		log.Fatal("Failed to schedule attempt cleanup:", err)
+	}
+
+	c.Start()
+}
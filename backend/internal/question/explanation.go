@@ -0,0 +1,182 @@
+package question
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// 解説・参考リンク・ヒント
+// 解説と参考リンクは採点後の結果（GetSubmittedQuestions）でのみ返す
+// ヒントは回答中に RevealHint で1つずつ表示でき、使ったヒントの数だけその問題の得点を HintPenalty の割合ずつ減らす
+
+const (
+	// maxHints 1問に設定できるヒントの数
+	maxHints = 5
+	// maxReferences 1問に設定できる参考リンクの数
+	maxReferences = 10
+)
+
+// ErrNoMoreHints はすべてのヒントを表示済みの場合（またはヒントがない問題の場合）に返す（ハンドラーで404にする）
+var ErrNoMoreHints = errors.New("no more hints for this question")
+
+// QuestionExplanation 問題の解説・参考リンク・ヒント（questions テーブルの列）
+type QuestionExplanation struct {
+	Explanation string         `json:"explanation" gorm:"column:explanation"`
+	References  referenceLinks `json:"references" gorm:"column:reference_links;type:jsonb"`
+	Hints       stringList     `json:"hints" gorm:"column:hints;type:jsonb"`
+	// ヒントを1つ使うごとに減らす得点の割合（0〜1。0 の場合は減らさない）
+	HintPenalty float64 `json:"hintPenalty" gorm:"column:hint_penalty"`
+}
+
+// validate はヒント・参考リンクの数と値を検証する
+func (e *QuestionExplanation) validate() error {
+	if len(e.Hints) > maxHints {
+		return fmt.Errorf("%w: at most %d hints", ErrInvalidQuestion, maxHints)
+	}
+	if len(e.References) > maxReferences {
+		return fmt.Errorf("%w: at most %d references", ErrInvalidQuestion, maxReferences)
+	}
+	for _, reference := range e.References {
+		u, err := url.Parse(reference.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: reference url must be http or https", ErrInvalidQuestion)
+		}
+	}
+	if e.HintPenalty < 0 || e.HintPenalty > 1 {
+		return fmt.Errorf("%w: hintPenalty must be between 0 and 1", ErrInvalidQuestion)
+	}
+	return nil
+}
+
+// ReferenceLink 参考リンク
+type ReferenceLink struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// referenceLinks 参考リンクを jsonb 列に保存する
+type referenceLinks []ReferenceLink
+
+// Value は jsonb 列に保存する値を返す
+func (l referenceLinks) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]ReferenceLink(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan は jsonb 列の値を読み込む
+func (l *referenceLinks) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, (*[]ReferenceLink)(l))
+	case string:
+		return json.Unmarshal([]byte(v), (*[]ReferenceLink)(l))
+	default:
+		return fmt.Errorf("unexpected type for reference links: %T", value)
+	}
+}
+
+// QuestionExplanationRow 問題IDと解説（GetQuestionExplanations で使う）
+type QuestionExplanationRow struct {
+	ID int `gorm:"column:id"`
+	QuestionExplanation
+}
+
+// hintFactor はヒントを使った数から得点の倍率を求める（0 未満にはしない）
+func hintFactor(hintsUsed int, penalty float64) float64 {
+	factor := 1 - float64(hintsUsed)*penalty
+	if factor < 0 {
+		return 0
+	}
+	return factor
+}
+
+// RevealHintRequest RevealHint のリクエストボディ
+type RevealHintRequest struct {
+	AttemptToken string `json:"attemptToken"`
+	QuestionID   int    `json:"questionId"`
+}
+
+// HintResponse RevealHint で返す構造体
+type HintResponse struct {
+	QuestionID int    `json:"questionId"`
+	Hint       string `json:"hint"`
+	// 表示したヒントの数と、残りのヒントの数
+	HintsUsed      int     `json:"hintsUsed"`
+	RemainingHints int     `json:"remainingHints"`
+	HintPenalty    float64 `json:"hintPenalty"`
+}
+
+// RevealHint 回答中の問題のヒントを1つ表示する（表示した数は提出時の得点に反映する）
+func (q QuestionService) RevealHint(userID string, req RevealHintRequest) (*HintResponse, error) {
+	now := time.Now()
+	expired := false
+	var hint *HintResponse
+	err := q.Repo.Transaction(func(repo QuestionRepository) error {
+		attempt, err := repo.GetAttemptForUpdate(req.AttemptToken)
+		if err != nil {
+			return err
+		}
+		if attempt == nil || attempt.UserID != userID || attempt.Status != AttemptStatusInProgress {
+			return ErrInvalidAttemptToken
+		}
+		if attempt.isOverdue(now) {
+			expired = true
+			return closeAttempt(repo, attempt, AttemptStatusExpired, now)
+		}
+
+		responses, err := repo.GetAttemptResponses(attempt.ID)
+		if err != nil {
+			return err
+		}
+		var response *AttemptResponse
+		for i := range responses {
+			if responses[i].QuestionID == req.QuestionID {
+				response = &responses[i]
+				break
+			}
+		}
+		if response == nil {
+			return ErrQuestionNotInSet
+		}
+
+		explanations, err := repo.GetQuestionExplanations([]int{req.QuestionID})
+		if err != nil {
+			return err
+		}
+		explanation := explanations[req.QuestionID]
+		if response.HintsUsed >= len(explanation.Hints) {
+			return ErrNoMoreHints
+		}
+		if err := repo.IncrementHintsUsed(attempt.ID, req.QuestionID); err != nil {
+			return err
+		}
+		hint = &HintResponse{
+			QuestionID:     req.QuestionID,
+			Hint:           explanation.Hints[response.HintsUsed],
+			HintsUsed:      response.HintsUsed + 1,
+			RemainingHints: len(explanation.Hints) - response.HintsUsed - 1,
+			HintPenalty:    explanation.HintPenalty,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, ErrAttemptExpired
+	}
+	return hint, nil
+}
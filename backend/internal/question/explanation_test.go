@@ -0,0 +1,59 @@
+package question
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestHintFactor(t *testing.T) {
+	tests := []struct {
+		hintsUsed int
+		penalty   float64
+		want      float64
+	}{
+		{0, 0.25, 1},
+		{1, 0.25, 0.75},
+		{3, 0.25, 0.25},
+		{4, 0.25, 0},
+		{5, 0.25, 0}, // 0 未満にはしない
+		{3, 0, 1},    // 減点なし
+		{1, 1, 0},
+	}
+	for _, tt := range tests {
+		if got := hintFactor(tt.hintsUsed, tt.penalty); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("hintFactor(%d, %v) = %v, want %v", tt.hintsUsed, tt.penalty, got, tt.want)
+		}
+	}
+}
+
+func TestQuestionExplanationValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		explanation QuestionExplanation
+		wantErr     bool
+	}{
+		{"empty", QuestionExplanation{}, false},
+		{"valid", QuestionExplanation{
+			Hints:       stringList{"hint"},
+			References:  referenceLinks{{Title: "docs", URL: "https://example.com/docs"}},
+			HintPenalty: 0.5,
+		}, false},
+		{"too many hints", QuestionExplanation{Hints: make(stringList, maxHints+1)}, true},
+		{"non-http reference", QuestionExplanation{References: referenceLinks{{URL: "javascript:alert(1)"}}}, true},
+		{"reference without host", QuestionExplanation{References: referenceLinks{{URL: "https://"}}}, true},
+		{"negative penalty", QuestionExplanation{HintPenalty: -0.1}, true},
+		{"penalty above 1", QuestionExplanation{HintPenalty: 1.5}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.explanation.validate()
+			if tt.wantErr && !errors.Is(err, ErrInvalidQuestion) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidQuestion)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
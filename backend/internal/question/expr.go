@@ -0,0 +1,296 @@
+package question
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode"
+)
+
+// テンプレート問題の計算式
+// 四則演算・剰余（%）・べき乗（^）・括弧・単項マイナスと、いくつかの関数を使える
+// 式は最初に構文木に変換し、変数の値を変えて何度でも計算できるようにする
+
+// ErrInvalidFormula は計算式が正しくない場合に返す
+var ErrInvalidFormula = errors.New("invalid formula")
+
+// formulaFuncs 計算式で使える関数（引数の数ごと）
+var formulaFuncs = map[string]func(args []float64) (float64, error){
+	"abs":   unaryFunc(math.Abs),
+	"sqrt":  unaryFunc(math.Sqrt),
+	"round": unaryFunc(math.Round),
+	"floor": unaryFunc(math.Floor),
+	"ceil":  unaryFunc(math.Ceil),
+	"min":   binaryFunc(math.Min),
+	"max":   binaryFunc(math.Max),
+	"pow":   binaryFunc(math.Pow),
+}
+
+func unaryFunc(f func(float64) float64) func([]float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("%w: expected 1 argument", ErrInvalidFormula)
+		}
+		return f(args[0]), nil
+	}
+}
+
+func binaryFunc(f func(float64, float64) float64) func([]float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		if len(args) != 2 {
+			return 0, fmt.Errorf("%w: expected 2 arguments", ErrInvalidFormula)
+		}
+		return f(args[0], args[1]), nil
+	}
+}
+
+// exprNode 計算式の構文木
+type exprNode interface {
+	eval(vars map[string]float64) (float64, error)
+}
+
+type numberNode float64
+
+func (n numberNode) eval(map[string]float64) (float64, error) { return float64(n), nil }
+
+type varNode string
+
+func (n varNode) eval(vars map[string]float64) (float64, error) {
+	v, ok := vars[string(n)]
+	if !ok {
+		return 0, fmt.Errorf("%w: undefined variable %q", ErrInvalidFormula, string(n))
+	}
+	return v, nil
+}
+
+type negNode struct{ x exprNode }
+
+func (n negNode) eval(vars map[string]float64) (float64, error) {
+	v, err := n.x.eval(vars)
+	return -v, err
+}
+
+type binaryNode struct {
+	op   byte
+	l, r exprNode
+}
+
+func (n binaryNode) eval(vars map[string]float64) (float64, error) {
+	l, err := n.l.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.r.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case '+':
+		return l + r, nil
+	case '-':
+		return l - r, nil
+	case '*':
+		return l * r, nil
+	case '/':
+		return l / r, nil
+	case '%':
+		return math.Mod(l, r), nil
+	default: // '^'
+		return math.Pow(l, r), nil
+	}
+}
+
+type callNode struct {
+	name string
+	args []exprNode
+}
+
+func (n callNode) eval(vars map[string]float64) (float64, error) {
+	args := make([]float64, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = v
+	}
+	return formulaFuncs[n.name](args)
+}
+
+// parseFormula は計算式を構文木に変換する
+func parseFormula(src string) (exprNode, error) {
+	p := &exprParser{src: []rune(src)}
+	node, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("%w: unexpected %q at %d", ErrInvalidFormula, string(p.src[p.pos]), p.pos)
+	}
+	return node, nil
+}
+
+// exprParser 再帰下降で計算式を読む
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = unary { ("*" | "/" | "%") unary }
+//	unary  = "-" unary | power
+//	power  = primary [ "^" unary ]
+//	primary = number | ident [ "(" expr { "," expr } ")" ] | "(" expr ")"
+type exprParser struct {
+	src []rune
+	pos int
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.src) && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+// peek は空白を飛ばして次の文字を返す（末尾の場合は 0）
+func (p *exprParser) peek() rune {
+	p.skipSpaces()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *exprParser) parseExpr() (exprNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: byte(op), l: left, r: right}
+	}
+}
+
+func (p *exprParser) parseTerm() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: byte(op), l: left, r: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.peek() == '-' {
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{x}, nil
+	}
+	return p.parsePower()
+}
+
+func (p *exprParser) parsePower() (exprNode, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != '^' {
+		return base, nil
+	}
+	p.pos++
+	// べき乗は右結合（2^3^2 = 2^9）
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return binaryNode{op: '^', l: base, r: exponent}, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("%w: unexpected end of formula", ErrInvalidFormula)
+	case c == '(':
+		p.pos++
+		node, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("%w: missing ')'", ErrInvalidFormula)
+		}
+		p.pos++
+		return node, nil
+	case unicode.IsDigit(c) || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (unicode.IsDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		v, err := strconv.ParseFloat(string(p.src[start:p.pos]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid number %q", ErrInvalidFormula, string(p.src[start:p.pos]))
+		}
+		return numberNode(v), nil
+	case isIdentStart(c):
+		start := p.pos
+		for p.pos < len(p.src) && isIdentPart(p.src[p.pos]) {
+			p.pos++
+		}
+		name := string(p.src[start:p.pos])
+		if p.peek() != '(' {
+			return varNode(name), nil
+		}
+		if _, ok := formulaFuncs[name]; !ok {
+			return nil, fmt.Errorf("%w: unknown function %q", ErrInvalidFormula, name)
+		}
+		p.pos++
+		var args []exprNode
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("%w: missing ')'", ErrInvalidFormula)
+		}
+		p.pos++
+		return callNode{name: name, args: args}, nil
+	default:
+		return nil, fmt.Errorf("%w: unexpected %q at %d", ErrInvalidFormula, string(c), p.pos)
+	}
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c rune) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,80 @@
+package question
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseFormula(t *testing.T) {
+	vars := map[string]float64{"a": 3, "b": 4, "x_1": 0.5}
+	tests := []struct {
+		formula string
+		want    float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"12 / 4 / 3", 1},
+		{"7 % 4", 3},
+		{"2 ^ 3 ^ 2", 512}, // べき乗は右結合
+		{"-2 ^ 2", -4},
+		{"2 ^ -1", 0.5},
+		{"--3", 3},
+		{"a * b", 12},
+		{"sqrt(a^2 + b^2)", 5},
+		{"max(a, b) - min(a, b)", 1},
+		{"pow(2, 10)", 1024},
+		{"round(2.5) + floor(1.9) + ceil(1.1) + abs(-1)", 7},
+		{" x_1 * 4 ", 2},
+		{".5 + 1.25", 1.75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.formula, func(t *testing.T) {
+			node, err := parseFormula(tt.formula)
+			if err != nil {
+				t.Fatalf("parseFormula: %v", err)
+			}
+			got, err := node.eval(vars)
+			if err != nil {
+				t.Fatalf("eval: %v", err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFormulaErrors(t *testing.T) {
+	for _, formula := range []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"1 2",
+		"1..2",
+		"foo(1)",
+		"max(1, 2",
+		"2 * $",
+	} {
+		if _, err := parseFormula(formula); !errors.Is(err, ErrInvalidFormula) {
+			t.Errorf("parseFormula(%q) err = %v, want %v", formula, err, ErrInvalidFormula)
+		}
+	}
+}
+
+func TestEvalFormulaErrors(t *testing.T) {
+	for _, formula := range []string{
+		"a + c",      // 未定義の変数
+		"sqrt(1, 2)", // 引数の数が違う
+		"max(1)",
+	} {
+		node, err := parseFormula(formula)
+		if err != nil {
+			t.Fatalf("parseFormula(%q): %v", formula, err)
+		}
+		if _, err := node.eval(map[string]float64{"a": 1}); !errors.Is(err, ErrInvalidFormula) {
+			t.Errorf("eval(%q) err = %v, want %v", formula, err, ErrInvalidFormula)
+		}
+	}
+}
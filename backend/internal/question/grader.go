@@ -0,0 +1,294 @@
+package question
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 採点
+// 問題の種類ごとに採点関数を用意し、gradeAnswer から呼び分ける
+
+// grader 問題と回答を受け取り、正解かどうかを返す
+type grader func(question IDAnswer, answer AnswerValue) bool
+
+var graders = map[string]grader{
+	QuestionTypeSingleChoice: gradeSingleChoice,
+	QuestionTypeMultiSelect:  gradeMultiSelect,
+	QuestionTypeTrueFalse:    gradeTrueFalse,
+	QuestionTypeFreeText:     gradeFreeText,
+	QuestionTypeNumeric:      gradeNumeric,
+	QuestionTypeOrdering:     gradeOrdering,
+	QuestionTypeTemplate:     gradeTemplate,
+}
+
+// gradeAnswer は問題の種類に応じた採点関数で採点する（種類が未設定の問題は従来の3択として扱う）
+func gradeAnswer(question IDAnswer, answer AnswerValue) bool {
+	g, ok := graders[question.QuestionType]
+	if !ok {
+		g = gradeSingleChoice
+	}
+	return g(question, answer)
+}
+
+// creditOf は得点の割合（0〜1）を返す
+// 部分点を与える問題（Spec.PartialCredit）のうち multi_select と ordering は途中まで合っていれば部分点、それ以外は正解なら 1
+func creditOf(question IDAnswer, answer AnswerValue) float64 {
+	if question.Spec.PartialCredit {
+		switch question.QuestionType {
+		case QuestionTypeMultiSelect:
+			return multiSelectCredit(question, answer)
+		case QuestionTypeOrdering:
+			return orderingCredit(question, answer)
+		}
+	}
+	if gradeAnswer(question, answer) {
+		return 1
+	}
+	return 0
+}
+
+// multiSelectCredit 選んだ正解の数から選んだ不正解の数を引き、正解の数で割る（0 未満は 0）
+func multiSelectCredit(question IDAnswer, answer AnswerValue) float64 {
+	correct := question.Spec.CorrectOptions
+	if len(correct) == 0 {
+		return 0
+	}
+	hits, misses := 0, 0
+	seen := make(map[string]bool)
+	for _, value := range answer.Values {
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		if containsString(correct, value) {
+			hits++
+		} else {
+			misses++
+		}
+	}
+	credit := float64(hits-misses) / float64(len(correct))
+	return math.Max(0, math.Min(1, credit))
+}
+
+// orderingCredit 正しい位置に並べた選択肢の割合
+func orderingCredit(question IDAnswer, answer AnswerValue) float64 {
+	options := question.Spec.Options
+	if len(options) == 0 {
+		return 0
+	}
+	matched := 0
+	for i, option := range options {
+		if i < len(answer.Values) && answer.Values[i] == option {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(options))
+}
+
+// correctAnswerOf は回答結果に表示する正解を返す
+func correctAnswerOf(question IDAnswer) AnswerValue {
+	switch question.QuestionType {
+	case QuestionTypeMultiSelect:
+		return AnswerValue{Values: question.Spec.CorrectOptions, IsList: true}
+	case QuestionTypeOrdering:
+		return AnswerValue{Values: question.Spec.Options, IsList: true}
+	case QuestionTypeTemplate:
+		expected, err := templateAnswer(question.Spec, question.Variables)
+		if err != nil {
+			return AnswerValue{}
+		}
+		return AnswerValue{Values: []string{formatNumber(expected)}}
+	default:
+		return AnswerValue{Values: []string{question.Answer}}
+	}
+}
+
+func gradeSingleChoice(question IDAnswer, answer AnswerValue) bool {
+	return !answer.IsList && answer.Single() == question.Answer
+}
+
+// gradeMultiSelect 正解の選択肢をすべて選び、それ以外を選んでいなければ正解
+func gradeMultiSelect(question IDAnswer, answer AnswerValue) bool {
+	return sameSet(answer.Values, question.Spec.CorrectOptions)
+}
+
+func gradeTrueFalse(question IDAnswer, answer AnswerValue) bool {
+	return !answer.IsList && strings.EqualFold(strings.TrimSpace(answer.Single()), question.Answer)
+}
+
+// gradeFreeText Answer か AcceptedAnswers のいずれかと一致すれば正解
+// 正解と回答は問題の設定（Spec.Normalization）に従って正規化してから比較する
+func gradeFreeText(question IDAnswer, answer AnswerValue) bool {
+	if answer.IsList {
+		return false
+	}
+	settings := question.Spec.Normalization
+	userAnswer := normalizeAnswer(answer.Single(), settings)
+	if userAnswer == "" {
+		return false
+	}
+	if question.Answer != "" && userAnswer == normalizeAnswer(question.Answer, settings) {
+		return true
+	}
+	for _, accepted := range question.Spec.AcceptedAnswers {
+		if userAnswer == normalizeAnswer(accepted, settings) {
+			return true
+		}
+	}
+	return false
+}
+
+// gradeNumeric Answer との差が Tolerance 以内なら正解（全角数字も受け付ける）
+func gradeNumeric(question IDAnswer, answer AnswerValue) bool {
+	if answer.IsList {
+		return false
+	}
+	expected, err := strconv.ParseFloat(question.Answer, 64)
+	if err != nil {
+		return false
+	}
+	actual, err := strconv.ParseFloat(normalizeNumber(answer.Single()), 64)
+	if err != nil {
+		return false
+	}
+	return math.Abs(expected-actual) <= question.Spec.Tolerance
+}
+
+// gradeTemplate 出題した値で計算した正解との差が Tolerance 以内なら正解
+func gradeTemplate(question IDAnswer, answer AnswerValue) bool {
+	if answer.IsList {
+		return false
+	}
+	expected, err := templateAnswer(question.Spec, question.Variables)
+	if err != nil {
+		return false
+	}
+	actual, err := strconv.ParseFloat(normalizeNumber(answer.Single()), 64)
+	if err != nil {
+		return false
+	}
+	return math.Abs(expected-actual) <= question.Spec.Tolerance
+}
+
+// gradeOrdering 保存されている順番（Options）と完全に一致すれば正解
+func gradeOrdering(question IDAnswer, answer AnswerValue) bool {
+	if len(answer.Values) != len(question.Spec.Options) {
+		return false
+	}
+	for i, option := range question.Spec.Options {
+		if answer.Values[i] != option {
+			return false
+		}
+	}
+	return true
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string(nil), a...)
+	y := append([]string(nil), b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizedAnswerOf は採点に使った正規化後の回答を返す（正規化しない種類の問題は空文字）
+func normalizedAnswerOf(question IDAnswer, answer AnswerValue) string {
+	if answer.IsList {
+		return ""
+	}
+	switch question.QuestionType {
+	case QuestionTypeFreeText:
+		return normalizeAnswer(answer.Single(), question.Spec.Normalization)
+	case QuestionTypeNumeric, QuestionTypeTemplate:
+		return normalizeNumber(answer.Single())
+	default:
+		return ""
+	}
+}
+
+// answersForAttempt 採点に使う正解を取得する
+// 問題集のアテンプトは、出題した時点のリビジョンに保存された問題で採点する（回答中に問題が修正・削除されても結果が変わらない）
+// 問題集をまたぐアテンプト（リビジョンが 0）と、リビジョンがない古いアテンプトは、現在の問題で採点する
+func answersForAttempt(repo QuestionRepository, attempt *Attempt, questionIDs []int) ([]IDAnswer, error) {
+	if attempt.QuestionSetID == 0 || attempt.Revision == 0 {
+		return repo.GetAnswersByIds(questionIDs)
+	}
+	revision, err := repo.GetQuestionSetRevision(attempt.QuestionSetID, attempt.Revision)
+	if err != nil {
+		return nil, err
+	}
+	if revision == nil {
+		return repo.GetAnswersByIds(questionIDs)
+	}
+
+	wanted := make(map[int]bool, len(questionIDs))
+	for _, id := range questionIDs {
+		wanted[id] = true
+	}
+	var answers []IDAnswer
+	for _, question := range revision.Questions {
+		if !wanted[question.ID] {
+			continue
+		}
+		answers = append(answers, IDAnswer{
+			ID:           question.ID,
+			Answer:       question.Answer,
+			QuestionType: question.QuestionType,
+			Spec:         question.Spec,
+			HintPenalty:  question.HintPenalty,
+		})
+	}
+	return answers, nil
+}
+
+// gradeResponses 回答を採点する（正解は DB から取得し、サーバー側でのみ照合する）
+// delivered はアテンプトで出題した問題（問題ID → 出題時の配点・テンプレート問題の値・使ったヒントの数）
+func gradeResponses(repo QuestionRepository, attempt *Attempt, userAnswers map[int]AnswerValue, delivered map[int]AttemptResponse) ([]Result, error) {
+	var questionIDs []int
+	for id := range userAnswers {
+		questionIDs = append(questionIDs, id)
+	}
+	answers, err := answersForAttempt(repo, attempt, questionIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, ans := range answers {
+		userAns, exists := userAnswers[ans.ID]
+		if !exists {
+			continue
+		}
+		response := delivered[ans.ID]
+		ans.Variables = response.Variables
+		credit := creditOf(ans, userAns)
+		// 配点は出題時の値を使う（回答中に問題が修正されても合計点が変わらないようにする）
+		points := response.Points
+		if points <= 0 {
+			points = pointsOf(ans.Spec)
+		}
+		results = append(results, Result{
+			QuestionID:       ans.ID,
+			UserAnswer:       userAns,
+			CorrectAnswer:    correctAnswerOf(ans),
+			Correct:          credit == 1,
+			Credit:           credit,
+			Points:           points,
+			EarnedPoints:     credit * float64(points) * hintFactor(response.HintsUsed, ans.HintPenalty),
+			NormalizedAnswer: normalizedAnswerOf(ans, userAns),
+			HintsUsed:        response.HintsUsed,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].QuestionID < results[j].QuestionID })
+	return results, nil
+}
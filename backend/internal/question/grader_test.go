@@ -0,0 +1,104 @@
+package question
+
+import "testing"
+
+func single(value string) AnswerValue { return AnswerValue{Values: []string{value}} }
+
+func list(values ...string) AnswerValue { return AnswerValue{Values: values, IsList: true} }
+
+func TestGradeAnswer(t *testing.T) {
+	singleChoice := IDAnswer{QuestionType: QuestionTypeSingleChoice, Answer: "b", Spec: QuestionSpec{Options: []string{"a", "b", "c"}}}
+	multiSelect := IDAnswer{QuestionType: QuestionTypeMultiSelect, Spec: QuestionSpec{Options: []string{"a", "b", "c", "d"}, CorrectOptions: []string{"a", "c"}}}
+	trueFalse := IDAnswer{QuestionType: QuestionTypeTrueFalse, Answer: "true"}
+	freeText := IDAnswer{QuestionType: QuestionTypeFreeText, Answer: "東京", Spec: QuestionSpec{AcceptedAnswers: []string{"Tokyo"}}}
+	numeric := IDAnswer{QuestionType: QuestionTypeNumeric, Answer: "3.14", Spec: QuestionSpec{Tolerance: 0.01}}
+	ordering := IDAnswer{QuestionType: QuestionTypeOrdering, Spec: QuestionSpec{Options: []string{"first", "second", "third"}}}
+	legacy := IDAnswer{Answer: "b"}
+
+	tests := []struct {
+		name     string
+		question IDAnswer
+		answer   AnswerValue
+		want     bool
+	}{
+		{"single choice correct", singleChoice, single("b"), true},
+		{"single choice wrong", singleChoice, single("a"), false},
+		{"single choice list", singleChoice, list("b"), false},
+		{"untyped question is single choice", legacy, single("b"), true},
+
+		{"multi select correct", multiSelect, list("c", "a"), true},
+		{"multi select missing option", multiSelect, list("a"), false},
+		{"multi select extra option", multiSelect, list("a", "b", "c"), false},
+
+		{"true false correct", trueFalse, single("TRUE "), true},
+		{"true false wrong", trueFalse, single("false"), false},
+
+		{"free text answer", freeText, single("東京"), true},
+		{"free text accepted answer", freeText, single("ＴＯＫＹＯ"), true},
+		{"free text empty", freeText, single("  "), false},
+		{"free text wrong", freeText, single("大阪"), false},
+
+		{"numeric exact", numeric, single("3.14"), true},
+		{"numeric within tolerance", numeric, single("3.149"), true},
+		{"numeric full width", numeric, single("３．１４"), true},
+		{"numeric outside tolerance", numeric, single("3.2"), false},
+		{"numeric not a number", numeric, single("pi"), false},
+
+		{"ordering correct", ordering, list("first", "second", "third"), true},
+		{"ordering wrong order", ordering, list("second", "first", "third"), false},
+		{"ordering missing item", ordering, list("first", "second"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gradeAnswer(tt.question, tt.answer); got != tt.want {
+				t.Errorf("gradeAnswer(%v) = %v, want %v", tt.answer.Values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreditOf(t *testing.T) {
+	multiSelect := IDAnswer{QuestionType: QuestionTypeMultiSelect, Spec: QuestionSpec{
+		Options:        []string{"a", "b", "c", "d", "e"},
+		CorrectOptions: []string{"a", "b", "c", "d"},
+		PartialCredit:  true,
+	}}
+	ordering := IDAnswer{QuestionType: QuestionTypeOrdering, Spec: QuestionSpec{
+		Options:       []string{"1", "2", "3", "4"},
+		PartialCredit: true,
+	}}
+	withoutPartial := multiSelect
+	withoutPartial.Spec.PartialCredit = false
+	numeric := IDAnswer{QuestionType: QuestionTypeNumeric, Answer: "10", Spec: QuestionSpec{PartialCredit: true}}
+
+	tests := []struct {
+		name     string
+		question IDAnswer
+		answer   AnswerValue
+		want     float64
+	}{
+		{"multi select all correct", multiSelect, list("a", "b", "c", "d"), 1},
+		{"multi select half", multiSelect, list("a", "b"), 0.5},
+		{"multi select wrong option subtracts", multiSelect, list("a", "b", "c", "e"), 0.5},
+		{"multi select duplicates count once", multiSelect, list("a", "a", "a"), 0.25},
+		{"multi select never negative", multiSelect, list("e"), 0},
+		{"multi select nothing selected", multiSelect, list(), 0},
+		{"multi select without partial credit", withoutPartial, list("a", "b", "c"), 0},
+		{"multi select without partial credit correct", withoutPartial, list("a", "b", "c", "d"), 1},
+
+		{"ordering all in place", ordering, list("1", "2", "3", "4"), 1},
+		{"ordering two in place", ordering, list("1", "2", "4", "3"), 0.5},
+		{"ordering none in place", ordering, list("4", "3", "2", "1"), 0},
+		{"ordering short answer", ordering, list("1"), 0.25},
+
+		{"other types are all or nothing", numeric, single("10"), 1},
+		{"other types are all or nothing wrong", numeric, single("9"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := creditOf(tt.question, tt.answer); got != tt.want {
+				t.Errorf("creditOf(%v) = %v, want %v", tt.answer.Values, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,10 @@ package question
 
 import (
 	"OnlineLearningWebApp/internal/cache"
+	"OnlineLearningWebApp/pkg/rbac"
 	"OnlineLearningWebApp/pkg/utils"
-	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
@@ -79,10 +77,13 @@ func (q *QuestionHandler) GetQuestionSet(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, err)
 	}
 
-	// 画面に表示するデータを返す構造体
-	resData, err := q.Service.GetQuestionsByQuestionSetId(QuestionSetID)
+	// 画面に表示するデータを返す構造体（閲覧できない問題集の場合は403/404を返す）
+	resData, err := q.Service.GetQuestionsByQuestionSetId(userID, QuestionSetID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+		return questionSetErrorResponse(c, err)
+	}
+	if len(resData) == 0 {
+		return questionSetErrorResponse(c, ErrQuestionSetNotFound)
 	}
 
 	count, err := q.Service.CountMyQuestions(userID, QuestionSetID)
@@ -111,6 +112,129 @@ func (q *QuestionHandler) GetQuestionSet(c echo.Context) error {
 	return c.JSON(http.StatusOK, resData)
 }
 
+// GetQuestionSetInfo
+// 問題集のタイトル・説明・ジャンル・公開範囲などを取得
+func (q *QuestionHandler) GetQuestionSetInfo(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	questionSetID, err := strconv.Atoi(c.QueryParam("question_set_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid question_set_id"})
+	}
+
+	info, err := q.Service.GetQuestionSetInfo(userID, questionSetID)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, info)
+}
+
+// OpenSharedQuestionSet
+// 共有トークンで限定公開の問題集を開く（以降はこのユーザーも閲覧・回答できる）
+func (q *QuestionHandler) OpenSharedQuestionSet(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	var req struct {
+		ShareToken string `json:"shareToken"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	info, err := q.Service.OpenSharedQuestionSet(userID, req.ShareToken)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, info)
+}
+
+// GetQuestionSetRevisions
+// 問題集のリビジョンの一覧を取得（作成者のみ）
+func (q *QuestionHandler) GetQuestionSetRevisions(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	questionSetID, err := strconv.Atoi(c.QueryParam("question_set_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid question_set_id"})
+	}
+
+	canEditAny := rbac.HasPermission(utils.GetRolesFromContext(c), rbac.PermQuestionEditAny)
+	revisions, err := q.Service.GetQuestionSetRevisions(userID, questionSetID, canEditAny)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"revisions": revisions})
+}
+
+// GetQuestionSetRevisionDiff
+// 問題集の2つのリビジョンの差分を取得（作成者のみ）
+func (q *QuestionHandler) GetQuestionSetRevisionDiff(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	questionSetID, err := strconv.Atoi(c.QueryParam("question_set_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid question_set_id"})
+	}
+	from, err := strconv.Atoi(c.QueryParam("from"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid from"})
+	}
+	to, err := strconv.Atoi(c.QueryParam("to"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid to"})
+	}
+
+	canEditAny := rbac.HasPermission(utils.GetRolesFromContext(c), rbac.PermQuestionEditAny)
+	diff, err := q.Service.GetQuestionSetRevisionDiff(userID, questionSetID, from, to, canEditAny)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, diff)
+}
+
+// RestoreQuestionSetRevision
+// 問題集を指定したリビジョンの内容に戻す（作成者のみ。復元した内容で新しいリビジョンを作る）
+func (q *QuestionHandler) RestoreQuestionSetRevision(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	var req RestoreRevisionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	canEditAny := rbac.HasPermission(utils.GetRolesFromContext(c), rbac.PermQuestionEditAny)
+	revision, err := q.Service.RestoreQuestionSetRevision(userID, req.QuestionSetID, req.Revision, canEditAny)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, revision)
+}
+
 // GetQuestionSetForFix
 // 問題集詳細を取得（問題集修正用）
 func (q *QuestionHandler) GetQuestionSetForFix(c echo.Context) error {
@@ -128,7 +252,8 @@ func (q *QuestionHandler) GetQuestionSetForFix(c echo.Context) error {
 	}
 
 	// 画面に表示するデータを返す構造体
-	resData, err := q.Service.GetQuestionsForFixByQuestionSetId(QuestionSetID, userID)
+	canEditAny := rbac.HasPermission(utils.GetRolesFromContext(c), rbac.PermQuestionEditAny)
+	resData, err := q.Service.GetQuestionsForFixByQuestionSetId(QuestionSetID, userID, canEditAny)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, err)
 	}
@@ -174,6 +299,11 @@ func (q *QuestionHandler) RegisterMyQuestions(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "Invalid deadline format. Expected format: YYYY-MM-DD")
 	}
 
+	// 閲覧できない問題集はマイ学習リストに追加できない
+	if err := q.Service.AuthorizeQuestionSet(userID, QuestionSetID, AccessRead); err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
 	// すでに登録済みであるか確認する
 	count, err := q.Service.CountMyQuestions(userID, QuestionSetID)
 	if err != nil {
@@ -254,8 +384,9 @@ func (q *QuestionHandler) DeleteQuestionSet(c echo.Context) error {
 	}
 
 	// 削除しようとしているユーザーが問題作成者であるかを確認した上で削除を実行
-	if err := q.Service.DeleteQuestionSet(userID, questionSetID); err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+	canDeleteAny := rbac.HasPermission(utils.GetRolesFromContext(c), rbac.PermQuestionDeleteAny)
+	if err := q.Service.DeleteQuestionSet(userID, questionSetID, canDeleteAny); err != nil {
+		return questionSetErrorResponse(c, err)
 	}
 
 	return c.JSON(http.StatusOK, nil)
@@ -325,6 +456,11 @@ func (q *QuestionHandler) RatingQuestionSet(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "rating must be between 1 and 5"})
 	}
 
+	// 閲覧できない問題集は評価できない
+	if err := q.Service.AuthorizeQuestionSet(userID, questionSetID, AccessRead); err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
 	// GORM のトランザクションで更新処理を実施
 	avgStar, err := q.Service.InsertOrUpdateStarRating(questionSetID, rating)
 	if err != nil {
@@ -353,129 +489,327 @@ func (q *QuestionHandler) SubmitQuestions(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
 	}
 
-	// クエリパラメータから question_set_id を取得
-	QuestionSetIDStr := c.QueryParam("question_set_id")
-	QuestionSetID, err := strconv.Atoi(QuestionSetIDStr)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+	// クエリパラメータから question_set_id を取得（復習など問題集をまたぐアテンプトの場合は省略する）
+	QuestionSetID := 0
+	if QuestionSetIDStr := c.QueryParam("question_set_id"); QuestionSetIDStr != "" {
+		QuestionSetID, err = strconv.Atoi(QuestionSetIDStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid question_set_id"})
+		}
 	}
 
-	// リクエストボディを map[string]interface{} として受け取る
-	var reqBody map[string]interface{}
+	// リクエストボディ（アテンプトトークンと 問題ID → 回答 のマップ）を受け取る
+	var reqBody SubmitQuestionsRequest
 	if err := c.Bind(&reqBody); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request body"})
+	}
+	if reqBody.AttemptToken == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "attemptToken is required"})
+	}
+
+	// 採点・回答の記録・進捗率の更新（アテンプトトークンの照合もサービスで行う）
+	attempt, err := q.Service.SubmitAttempt(userID, QuestionSetID, reqBody)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	// フロント側には submissionId（アテンプトID）のみ返し、結果確認画面ではこのIDからデータを取得する
+	return c.JSON(http.StatusOK, echo.Map{
+		"submissionId": attempt.ID,
+	})
+}
+
+// StartAttempt
+// 問題集の回答を開始する（正解を含まない問題とアテンプトトークンを返す）
+func (q *QuestionHandler) StartAttempt(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	questionSetID, err := strconv.Atoi(c.QueryParam("question_set_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid question_set_id"})
+	}
+
+	delivery, err := q.Service.StartAttempt(userID, questionSetID)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// StartExam
+// 試験モードで問題集の回答を開始する（問題集に設定された制限時間を過ぎた提出は受け付けない）
+func (q *QuestionHandler) StartExam(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	questionSetID, err := strconv.Atoi(c.QueryParam("question_set_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid question_set_id"})
+	}
+
+	delivery, err := q.Service.StartExam(userID, questionSetID)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// GetActiveAttempt
+// 回答中のアテンプトを再開する（別の端末で途中まで回答した場合も、途中保存した回答を返す）
+func (q *QuestionHandler) GetActiveAttempt(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
 	}
 
-	// 受け取った回答データのキー（QuestionID）を int に変換してマップ作成
-	userAnswers := make(map[int]string)
-	var questionIDs []int
-	for strID, answer := range reqBody {
-		questionID, err := strconv.Atoi(strID)
+	// 復習のアテンプトを再開する場合は question_set_id を省略する
+	questionSetID := 0
+	if questionSetIDStr := c.QueryParam("question_set_id"); questionSetIDStr != "" {
+		questionSetID, err = strconv.Atoi(questionSetIDStr)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid question ID format"})
-		}
-		if userAnswer, ok := answer.(string); ok {
-			userAnswers[questionID] = userAnswer
-			questionIDs = append(questionIDs, questionID)
-		} else {
-			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid answer format"})
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid question_set_id"})
 		}
 	}
 
-	// DBから該当する問題の正解を取得
-	answers, err := q.Service.GetAnswersByIds(questionIDs)
+	delivery, err := q.Service.ResumeAttempt(userID, questionSetID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return questionSetErrorResponse(c, err)
 	}
 
-	// 回答の正誤判定
-	var results []Result
-	var newCorrectAnswers []int
-	for _, ans := range answers {
-		userAns, exists := userAnswers[ans.ID]
-		if !exists {
-			continue
-		}
-		correct := ans.Answer == userAns
-		results = append(results, Result{
-			QuestionID: ans.ID,
-			UserAnswer: userAns,
-			Correct:    correct,
-		})
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// SaveDraftAnswers
+// 回答を途中保存する（採点は SubmitQuestions で提出したときに行う）
+func (q *QuestionHandler) SaveDraftAnswers(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	var reqBody SubmitQuestionsRequest
+	if err := c.Bind(&reqBody); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request body"})
+	}
+	if reqBody.AttemptToken == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "attemptToken is required"})
+	}
+
+	savedAt, err := q.Service.SaveDraftAnswers(userID, reqBody)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"savedAt": savedAt,
+	})
+}
+
+// RevealHint
+// 回答中の問題のヒントを1つ表示する
+func (q *QuestionHandler) RevealHint(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
 
-		// 初めて正解した問題のチェック
-		if correct {
-			count, err := q.Service.CountCorrectAnswers(userID, ans.ID)
-			if err != nil {
-				return c.JSON(http.StatusInternalServerError, err.Error())
-			}
-			if count == 0 {
-				newCorrectAnswers = append(newCorrectAnswers, ans.ID)
-			}
+	var reqBody RevealHintRequest
+	if err := c.Bind(&reqBody); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request body"})
+	}
+	if reqBody.AttemptToken == "" || reqBody.QuestionID == 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "attemptToken and questionId are required"})
+	}
+
+	hint, err := q.Service.RevealHint(userID, reqBody)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, hint)
+}
+
+// GetCalibrationReport
+// 自信度ごとの正答率を全体とジャンル別に返す（genre_id を指定した場合はそのジャンルのみ）
+func (q *QuestionHandler) GetCalibrationReport(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	genreID := 0
+	if genreIDStr := c.QueryParam("genre_id"); genreIDStr != "" {
+		genreID, err = strconv.Atoi(genreIDStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid genre_id"})
 		}
 	}
 
-	// 追加（2025/02/25）
-	// 問題集をマイ学習リストに追加している場合は、初めて正解した問題を online_learning_correct_answers に追加する
-	// そうでない場合は、正誤判定した結果だけ返す
-	countIsRegistered, err := q.Service.CountIsRegistered(userID, QuestionSetID)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
-	}
-	if countIsRegistered > 0 {
-		// 初めて正解した問題を online_learning_correct_answers に追加
-		if len(newCorrectAnswers) > 0 {
-			var insertValues []map[string]interface{}
-			for _, qID := range newCorrectAnswers {
-				insertValues = append(insertValues, map[string]interface{}{
-					"user_id":         userID,
-					"question_id":     qID,
-					"question_set_id": QuestionSetID,
-				})
-			}
-			err := q.Service.InsertCorrectAnswers(insertValues)
-			if err != nil {
-				return c.JSON(http.StatusInternalServerError, err.Error())
-			}
+	report, err := q.Service.GetCalibrationReport(userID, genreID)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// GetQuestionSetSettings
+// 問題集の設定（制限時間など）を取得する
+func (q *QuestionHandler) GetQuestionSetSettings(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	questionSetID, err := strconv.Atoi(c.QueryParam("question_set_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid question_set_id"})
+	}
+
+	settings, err := q.Service.GetQuestionSetSettings(userID, questionSetID)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+// UpdateQuestionSetSettings
+// 問題集の設定（制限時間など）を更新する（作成者のみ）
+func (q *QuestionHandler) UpdateQuestionSetSettings(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	var req QuestionSetSettings
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	canEditAny := rbac.HasPermission(utils.GetRolesFromContext(c), rbac.PermQuestionEditAny)
+	settings, err := q.Service.UpdateQuestionSetSettings(userID, req, canEditAny)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+// StartReviewSession
+// 今日が復習期限の問題（マイ学習リストのすべての問題集が対象）で復習を開始する
+func (q *QuestionHandler) StartReviewSession(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	delivery, err := q.Service.StartReviewSession(userID, limit)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// StartMistakePractice
+// 間違えた問題で練習を開始する（question_set_id か genre_id で範囲を指定できる）
+func (q *QuestionHandler) StartMistakePractice(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
 
+	var scope MistakeScope
+	if questionSetIDStr := c.QueryParam("question_set_id"); questionSetIDStr != "" {
+		scope.QuestionSetID, err = strconv.Atoi(questionSetIDStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid question_set_id"})
 		}
-		// 進捗率の更新
-		err := q.Service.UpdateProgress(userID, QuestionSetID)
+	}
+	if genreIDStr := c.QueryParam("genre_id"); genreIDStr != "" {
+		scope.GenreID, err = strconv.Atoi(genreIDStr)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, err.Error())
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid genre_id"})
 		}
+	}
+	if scope.QuestionSetID != 0 && scope.GenreID != 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "specify either question_set_id or genre_id"})
+	}
 
-		// online_learning_my_questionsのstatusがnot_startedならin_progressに変更
-		if err := q.Service.ChangeStatusToInProgress(userID, QuestionSetID); err != nil {
-			return c.JSON(http.StatusInternalServerError, err.Error())
-		}
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	delivery, err := q.Service.StartMistakePractice(userID, scope, limit)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// StartMockExam
+// ジャンルごとの問題数と難易度を指定して模擬試験を開始する
+func (q *QuestionHandler) StartMockExam(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	var reqBody MockExamRequest
+	if err := c.Bind(&reqBody); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request body"})
 	}
 
-	// 提出結果をまとめる
-	submissionResult := SubmissionResult{
-		Results:  results,
-		Progress: "updated",
+	delivery, err := q.Service.StartMockExam(userID, reqBody)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
 	}
 
-	// ここから Redis に一時保存する処理
-	submissionId := uuid.New().String()
-	jsonData, err := json.Marshal(submissionResult)
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// GetMockExamReport
+// 模擬試験の結果をジャンル別に返す
+func (q *QuestionHandler) GetMockExamReport(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to marshal submission data"})
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
 	}
 
-	if err := q.Cache.Set(context.Background(), submissionId, jsonData, 24*time.Hour); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to cache submission data"})
+	attemptID := c.QueryParam("attempt_id")
+	if attemptID == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "attempt_id is required"})
 	}
 
-	// フロント側には submissionId のみ返し、結果確認画面ではこのIDからデータを取得する
-	return c.JSON(http.StatusOK, echo.Map{
-		"submissionId": submissionId,
-	})
+	report, err := q.Service.GetMockExamReport(userID, attemptID)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, report)
 }
 
 // GetSubmissionResult
-// 回答結果を見る
+// 回答結果を見る（過去のアテンプトもこのIDで参照できる）
 func (q *QuestionHandler) GetSubmissionResult(c echo.Context) error {
 	// ユーザー認証チェック
 	userID, err := utils.GetUserIDFromContext(c)
@@ -484,31 +818,46 @@ func (q *QuestionHandler) GetSubmissionResult(c echo.Context) error {
 	}
 
 	submissionId := c.QueryParam("submitted_id")
+	if submissionId == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "submitted_id is required"})
+	}
 
-	jsonData, err := q.Cache.Get(context.Background(), submissionId)
-	if errors.Is(err, redis.Nil) {
-		return c.JSON(http.StatusNotFound, echo.Map{"error": "submissionId not found or expired"})
-	} else if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to retrieve submission data"})
+	submissionResult, err := q.Service.GetAttemptResult(userID, submissionId)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
 	}
 
-	// jsonDataのデータ型がinterface{}なので、[]byte(jsonData)では対応しないので、以下に修正
-	var dataBytes []byte
-	switch v := jsonData.(type) {
-	case []byte:
-		dataBytes = v
-	case string:
-		dataBytes = []byte(v)
-	default:
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "unexpected type for submission data"})
+	return c.JSON(http.StatusOK, submissionResult)
+}
+
+// GetMyAttempts
+// 自分の回答履歴を取得する（question_set_id を指定した場合はその問題集のみ）
+func (q *QuestionHandler) GetMyAttempts(c echo.Context) error {
+	// ユーザー認証チェック
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	questionSetID := 0
+	if questionSetIDStr := c.QueryParam("question_set_id"); questionSetIDStr != "" {
+		questionSetID, err = strconv.Atoi(questionSetIDStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid question_set_id"})
+		}
 	}
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
 
-	var submissionResult SubmissionResult
-	if err := json.Unmarshal(dataBytes, &submissionResult); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to unmarshal submission data"})
+	attempts, totalCount, err := q.Service.GetMyAttempts(userID, questionSetID, page, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 	}
 
-	return c.JSON(http.StatusOK, submissionResult)
+	return c.JSON(http.StatusOK, echo.Map{
+		"totalCount": totalCount,
+		"attempts":   attempts,
+	})
 }
 
 // GetQuestionsByQuestionIds
@@ -537,10 +886,11 @@ func (q *QuestionHandler) GetQuestionsByQuestionIds(c echo.Context) error {
 		ids = append(ids, id)
 	}
 
-	// 表示するための問題をquestionIdを元に検索する
-	questions, err := q.Service.GetQuestionsByIds(ids)
-
-	fmt.Println(questions)
+	// 表示するための問題をquestionIdを元に検索する（閲覧できない問題集の問題が含まれる場合は403/404を返す）
+	questions, err := q.Service.GetQuestionsByIds(userID, ids)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
+	}
 
 	return c.JSON(http.StatusOK, echo.Map{
 		"questions": questions,
@@ -565,28 +915,37 @@ func (q *QuestionHandler) InsertQuestions(c echo.Context) error {
 	var questions []InsertQuestion
 	for _, item := range req.Questions {
 		question := InsertQuestion{
-			UserID:     userID,
-			Title:      req.Title,
-			GenreID:    item.GenreID,
-			Visibility: item.Visibility,
-			Question:   item.Question,
-			Answer:     item.Answer,
-			Choices1:   item.Choices1,
-			Choices2:   item.Choices2,
-			CreatedAt:  time.Now(),
-			UpdatedAt:  time.Now(),
+			UserID:              userID,
+			GenreID:             item.GenreID,
+			Question:            item.Question,
+			Answer:              item.Answer,
+			Choices1:            item.Choices1,
+			Choices2:            item.Choices2,
+			QuestionType:        item.QuestionType,
+			Spec:                item.Spec,
+			QuestionExplanation: item.QuestionExplanation,
+			CreatedAt:           time.Now(),
+			UpdatedAt:           time.Now(),
 		}
 		questions = append(questions, question)
 	}
 
-	// トランザクション開始
-	if err := q.Service.CreateQuestionSet(questions); err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+	// 問題集のジャンル・公開範囲が指定されていない場合は、先頭の問題の値を使う
+	fields := req.QuestionSetFields
+	if len(req.Questions) > 0 {
+		fields.applyDefaults(req.Questions[0].GenreID, req.Questions[0].Visibility)
+	}
+
+	// トランザクション開始（問題の種類に対して正解・選択肢が正しくない場合は400を返す）
+	questionSet, err := q.Service.CreateQuestionSet(userID, fields, questions)
+	if err != nil {
+		return questionSetErrorResponse(c, err)
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{
-		"message": "questions created successfully",
-		"count":   len(questions),
+		"message":       "questions created successfully",
+		"count":         len(questions),
+		"questionSetId": questionSet.ID,
 	})
 }
 
@@ -605,30 +964,70 @@ func (q *QuestionHandler) FixQuestions(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
 	}
 
+	fields, questions := fixQuestionsFromRequest(req)
+
+	// トランザクション開始
+	canEditAny := rbac.HasPermission(utils.GetRolesFromContext(c), rbac.PermQuestionEditAny)
+	if err := q.Service.FixQuestionSet(req.QuestionSetId, fields, questions, userId, canEditAny); err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "questions created successfully",
+	})
+}
+
+// AutosaveQuestionSet 下書きの問題集を上書き保存する（作成途中の自動保存。リクエストは FixMyQuestions と同じ）
+func (q *QuestionHandler) AutosaveQuestionSet(c echo.Context) error {
+	// ユーザー認証チェック
+	userId, contextErr := utils.GetUserIDFromContext(c)
+	if contextErr != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+
+	var req FixQuestionsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	fields, questions := fixQuestionsFromRequest(req)
+
+	canEditAny := rbac.HasPermission(utils.GetRolesFromContext(c), rbac.PermQuestionEditAny)
+	if err := q.Service.AutosaveQuestionSet(req.QuestionSetId, fields, questions, userId, canEditAny); err != nil {
+		return questionSetErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "draft saved successfully",
+		"savedAt": time.Now(),
+	})
+}
+
+// fixQuestionsFromRequest 問題集修正のリクエストから、問題集の項目と修正する問題を作る
+func fixQuestionsFromRequest(req FixQuestionsRequest) (QuestionSetFields, []FixQuestion) {
 	var questions []FixQuestion
 	for _, item := range req.Questions {
 		question := FixQuestion{
-			ID:         item.ID,
-			Title:      req.Title,
-			GenreID:    item.GenreID,
-			Visibility: item.Visibility,
-			Question:   item.Question,
-			Answer:     item.Answer,
-			Choices1:   item.Choices1,
-			Choices2:   item.Choices2,
-			UpdatedAt:  time.Now(),
+			ID:                  item.ID,
+			GenreID:             item.GenreID,
+			Question:            item.Question,
+			Answer:              item.Answer,
+			Choices1:            item.Choices1,
+			Choices2:            item.Choices2,
+			QuestionType:        item.QuestionType,
+			Spec:                item.Spec,
+			QuestionExplanation: item.QuestionExplanation,
+			UpdatedAt:           time.Now(),
 		}
 		questions = append(questions, question)
 	}
 
-	// トランザクション開始
-	if err := q.Service.FixQuestionSet(req.QuestionSetId, questions, req.GenreId, req.Title, userId); err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+	// 問題集のジャンル・公開範囲が指定されていない場合は、先頭の問題の値を使う
+	fields := req.QuestionSetFields
+	if len(req.Questions) > 0 {
+		fields.applyDefaults(req.Questions[0].GenreID, req.Questions[0].Visibility)
 	}
-
-	return c.JSON(http.StatusOK, echo.Map{
-		"message": "questions created successfully",
-	})
+	return fields, questions
 }
 
 // SearchQuestions 問題集の検索で使用する
@@ -729,7 +1128,10 @@ func (q *QuestionHandler) AddToFavorite(c echo.Context) error {
 	// isFavoriteがtrueならonline_learning_favorite_questionsにuserIDとquestionIdをインサート
 	// isFavoriteがfalseならonline_learning_favorite_questionsにuserIDとquestionIdを元にレコードを削除
 	if isFavorite {
-		// お気に入り登録
+		// お気に入り登録（閲覧できない問題集は登録できない）
+		if err := q.Service.AuthorizeQuestionSet(userID, questionSetID, AccessRead); err != nil {
+			return questionSetErrorResponse(c, err)
+		}
 		if err := q.Service.InsertFavoriteQuestion(userID, questionSetID); err != nil {
 			return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 		}
@@ -744,3 +1146,23 @@ func (q *QuestionHandler) AddToFavorite(c echo.Context) error {
 		"message": "updating favorite question successfully",
 	})
 }
+
+// questionSetErrorResponse サービスが返したエラーをステータスコードに対応させて返す
+func questionSetErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, ErrQuestionSetNotFound), errors.Is(err, ErrAttemptNotFound), errors.Is(err, ErrNoDueReviews),
+		errors.Is(err, ErrNoMistakes), errors.Is(err, ErrNotEnoughQuestions), errors.Is(err, ErrNoMoreHints),
+		errors.Is(err, ErrRevisionNotFound):
+		return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+	case errors.Is(err, ErrNotQuestionWriter), errors.Is(err, ErrQuestionSetForbidden):
+		return c.JSON(http.StatusForbidden, echo.Map{"error": err.Error()})
+	case errors.Is(err, ErrQuestionNotInSet), errors.Is(err, ErrInvalidAttemptToken), errors.Is(err, ErrInvalidQuestion),
+		errors.Is(err, ErrInvalidSettings), errors.Is(err, ErrNoTimeLimit), errors.Is(err, ErrInvalidMockExam),
+		errors.Is(err, ErrInvalidQuestionSet):
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	case errors.Is(err, ErrAttemptExpired):
+		return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+}
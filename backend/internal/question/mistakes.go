@@ -0,0 +1,62 @@
+package question
+
+import (
+	"errors"
+)
+
+// 間違えた問題の練習
+// 提出した回答（online_learning_attempt_responses）から、最後に回答したときに間違えた問題を集めて出題する
+// 一度も正解していない問題も、最後の回答が不正解なので対象になる。採点は通常どおり SubmitQuestions で行う
+
+// defaultMistakeLimit 1回の練習で出題する問題数
+const defaultMistakeLimit = 20
+
+// ErrNoMistakes は練習の対象になる間違えた問題がない場合に返す（ハンドラーで404にする）
+var ErrNoMistakes = errors.New("no missed questions to practice")
+
+// MistakeScope 練習の対象にする範囲
+// QuestionSetID を指定した場合はその問題集、GenreID を指定した場合はそのジャンルの問題
+// どちらも 0 の場合はマイ学習リストに追加している問題集の問題を対象にする
+type MistakeScope struct {
+	QuestionSetID int
+	GenreID       int
+}
+
+// StartMistakePractice 間違えた問題で練習を開始する（最近間違えた順に limit 問まで）
+// 問題集を指定した場合はその問題集のアテンプトとして記録し、提出時も question_set_id を指定する
+// それ以外は問題集をまたぐアテンプトになるため、提出時は question_set_id を省略する
+func (q QuestionService) StartMistakePractice(userID string, scope MistakeScope, limit int) (*QuizDelivery, error) {
+	if scope.QuestionSetID != 0 {
+		if err := q.AuthorizeQuestionSet(userID, scope.QuestionSetID, AccessAnswer); err != nil {
+			return nil, err
+		}
+	}
+	if limit <= 0 {
+		limit = defaultMistakeLimit
+	}
+
+	questionIDs, err := q.Repo.GetMissedQuestionIds(userID, scope, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(questionIDs) == 0 {
+		return nil, ErrNoMistakes
+	}
+	questions, err := q.Repo.GetQuestionsByIds(questionIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// 最近間違えた順に出題する
+	byID := make(map[int]Question, len(questions))
+	for _, question := range questions {
+		byID[question.ID] = question
+	}
+	var ordered []Question
+	for _, id := range questionIDs {
+		if question, ok := byID[id]; ok {
+			ordered = append(ordered, question)
+		}
+	}
+	return q.createAttempt(newAttempt(userID, scope.QuestionSetID, AttemptKindPractice), ordered)
+}
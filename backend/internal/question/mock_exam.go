@@ -0,0 +1,376 @@
+package question
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// 模擬試験
+// 公開されている問題と自分の問題から、ジャンルごとの問題数と難易度を指定して試験を作る
+// 出題した問題IDは模擬試験ごとに保存し、以前と同じシード・条件で作り直した場合は保存した問題をそのまま出題する
+// （回答数や公開範囲の変化で候補が変わっても同じ試験になる。選択肢の並び順はアテンプトごとに変わる）
+// 提出は通常どおり SubmitQuestions（question_set_id は省略）で行い、GetMockExamReport でジャンル別の得点を返す
+
+// 難易度（回答全体の正答率から決める）
+const (
+	DifficultyEasy   = "easy"
+	DifficultyMedium = "medium"
+	DifficultyHard   = "hard"
+)
+
+const (
+	// maxMockExamQuestions 1回の模擬試験で出題できる問題数の上限
+	maxMockExamQuestions = 100
+	// minDifficultySamples 難易度を判定するのに必要な回答数（足りない問題は medium として扱う）
+	minDifficultySamples = 5
+	// easyCorrectRate 正答率がこれ以上の問題は easy
+	easyCorrectRate = 0.8
+	// hardCorrectRate 正答率がこれ未満の問題は hard
+	hardCorrectRate = 0.5
+)
+
+var (
+	// ErrInvalidMockExam は模擬試験の条件が正しくない場合に返す（ハンドラーで400にする）
+	ErrInvalidMockExam = errors.New("invalid mock exam request")
+	// ErrNotEnoughQuestions は条件に合う問題が指定した問題数に足りない場合に返す（ハンドラーで404にする）
+	ErrNotEnoughQuestions = errors.New("not enough questions match the mock exam conditions")
+)
+
+// MockExamSection ジャンルごとの出題数
+type MockExamSection struct {
+	GenreID int `json:"genreId"`
+	Count   int `json:"count"`
+}
+
+// mockExamSections ジャンルごとの出題数を jsonb 列に保存する
+type mockExamSections []MockExamSection
+
+// Value は jsonb 列に保存する値を返す
+func (s mockExamSections) Value() (driver.Value, error) {
+	b, err := json.Marshal([]MockExamSection(s))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan は jsonb 列の値を読み込む
+func (s *mockExamSections) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, (*[]MockExamSection)(s))
+	case string:
+		return json.Unmarshal([]byte(v), (*[]MockExamSection)(s))
+	default:
+		return fmt.Errorf("unexpected type for mock exam sections: %T", value)
+	}
+}
+
+// questionIDList 問題IDの配列を jsonb 列に保存する
+type questionIDList []int
+
+// Value は jsonb 列に保存する値を返す
+func (l questionIDList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]int(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan は jsonb 列の値を読み込む
+func (l *questionIDList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, (*[]int)(l))
+	case string:
+		return json.Unmarshal([]byte(v), (*[]int)(l))
+	default:
+		return fmt.Errorf("unexpected type for question id list: %T", value)
+	}
+}
+
+// MockExamRequest StartMockExam のリクエストボディ
+// seed を省略した場合はサーバーで決め、レスポンスで返す（同じ試験を作り直すときに、同じ条件とあわせて指定する）
+type MockExamRequest struct {
+	Sections   []MockExamSection `json:"sections"`
+	Difficulty string            `json:"difficulty"` // easy / medium / hard（省略した場合は問わない）
+	Seed       *int64            `json:"seed"`
+	// 制限時間（秒）。0 の場合は制限時間なし
+	TimeLimitSeconds int `json:"timeLimitSeconds"`
+}
+
+// validate はリクエストの値を検証する
+func (r *MockExamRequest) validate() error {
+	if len(r.Sections) == 0 {
+		return fmt.Errorf("%w: sections is required", ErrInvalidMockExam)
+	}
+	total := 0
+	genres := make(map[int]bool)
+	for _, section := range r.Sections {
+		if section.GenreID <= 0 || section.Count <= 0 {
+			return fmt.Errorf("%w: genreId and count must be positive", ErrInvalidMockExam)
+		}
+		if genres[section.GenreID] {
+			return fmt.Errorf("%w: duplicate genreId %d", ErrInvalidMockExam, section.GenreID)
+		}
+		genres[section.GenreID] = true
+		total += section.Count
+	}
+	if total > maxMockExamQuestions {
+		return fmt.Errorf("%w: at most %d questions", ErrInvalidMockExam, maxMockExamQuestions)
+	}
+	switch r.Difficulty {
+	case "", DifficultyEasy, DifficultyMedium, DifficultyHard:
+	default:
+		return fmt.Errorf("%w: unknown difficulty %q", ErrInvalidMockExam, r.Difficulty)
+	}
+	if r.TimeLimitSeconds < 0 || r.TimeLimitSeconds > maxTimeLimitSeconds {
+		return fmt.Errorf("%w: timeLimitSeconds must be between 0 and %d", ErrInvalidMockExam, maxTimeLimitSeconds)
+	}
+	return nil
+}
+
+// MockExam 模擬試験の条件（アテンプトごとに保存する）
+type MockExam struct {
+	AttemptID  string           `json:"-" gorm:"column:attempt_id;primaryKey"`
+	Seed       int64            `json:"seed" gorm:"column:seed"`
+	Difficulty string           `json:"difficulty" gorm:"column:difficulty"`
+	Sections   mockExamSections `json:"sections" gorm:"column:sections;type:jsonb"`
+	// 出題した問題ID（出題順）
+	QuestionIDs questionIDList `json:"questionIds" gorm:"column:question_ids;type:jsonb"`
+}
+
+// sameConditions は模擬試験がリクエストと同じ条件（難易度・ジャンルごとの出題数）で作られたかを返す
+func (e MockExam) sameConditions(req MockExamRequest) bool {
+	if e.Difficulty != req.Difficulty || len(e.Sections) != len(req.Sections) {
+		return false
+	}
+	for i, section := range req.Sections {
+		if e.Sections[i] != section {
+			return false
+		}
+	}
+	return true
+}
+
+// テーブル名を指定
+func (MockExam) TableName() string {
+	return "online_learning_mock_exams"
+}
+
+// MockExamDelivery StartMockExam で返す構造体
+type MockExamDelivery struct {
+	QuizDelivery
+	Seed int64 `json:"seed"`
+}
+
+// QuestionStat 問題ごとの回答数と正解数（全ユーザーの提出済みの回答）
+type QuestionStat struct {
+	QuestionID    int `gorm:"column:question_id"`
+	AnsweredCount int `gorm:"column:answered_count"`
+	CorrectCount  int `gorm:"column:correct_count"`
+}
+
+// difficulty は正答率から難易度を決める
+func (s QuestionStat) difficulty() string {
+	if s.AnsweredCount < minDifficultySamples {
+		return DifficultyMedium
+	}
+	rate := float64(s.CorrectCount) / float64(s.AnsweredCount)
+	switch {
+	case rate >= easyCorrectRate:
+		return DifficultyEasy
+	case rate < hardCorrectRate:
+		return DifficultyHard
+	default:
+		return DifficultyMedium
+	}
+}
+
+// GenreScore ジャンルごとの得点
+type GenreScore struct {
+	GenreID        int     `json:"genreId" gorm:"column:genre_id"`
+	GenreName      string  `json:"genreName" gorm:"column:genre_name"`
+	TotalQuestions int     `json:"totalQuestions" gorm:"column:total_questions"`
+	CorrectCount   int     `json:"correctCount" gorm:"column:correct_count"`
+	TotalPoints    int     `json:"totalPoints" gorm:"column:total_points"`
+	EarnedPoints   float64 `json:"earnedPoints" gorm:"column:earned_points"`
+	Score          float64 `json:"score" gorm:"-"`
+}
+
+// MockExamReport GetMockExamReport で返す構造体
+type MockExamReport struct {
+	Attempt
+	MockExam
+	GenreScores []GenreScore `json:"genreScores"`
+}
+
+// StartMockExam 模擬試験を作成して回答を開始する
+func (q QuestionService) StartMockExam(userID string, req MockExamRequest) (*MockExamDelivery, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	seed := rand.Int64()
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+
+	// 以前と同じシード・条件の模擬試験があれば、そのとき出題した問題で作り直す
+	var questionIDs []int
+	if req.Seed != nil {
+		ids, err := q.previousMockExamQuestions(userID, req)
+		if err != nil {
+			return nil, err
+		}
+		questionIDs = ids
+	}
+	if questionIDs == nil {
+		ids, err := q.drawMockExamQuestions(userID, req, seed)
+		if err != nil {
+			return nil, err
+		}
+		questionIDs = ids
+	}
+
+	questions, err := q.Repo.GetQuestionsByIds(questionIDs)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]Question, len(questions))
+	for _, question := range questions {
+		byID[question.ID] = question
+	}
+	var ordered []Question
+	for _, id := range questionIDs {
+		if question, ok := byID[id]; ok {
+			ordered = append(ordered, question)
+		}
+	}
+
+	attempt := newAttempt(userID, 0, AttemptKindMockExam)
+	if req.TimeLimitSeconds > 0 {
+		deadline := attempt.StartedAt.Add(time.Duration(req.TimeLimitSeconds) * time.Second)
+		attempt.DeadlineAt = &deadline
+	}
+	exam := &MockExam{
+		AttemptID:  attempt.ID,
+		Seed:       seed,
+		Difficulty: req.Difficulty,
+		Sections:   req.Sections,
+	}
+	for _, question := range ordered {
+		exam.QuestionIDs = append(exam.QuestionIDs, question.ID)
+	}
+	delivery, err := q.createAttemptWith(attempt, ordered, func(repo QuestionRepository) error {
+		return repo.CreateMockExam(exam)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MockExamDelivery{QuizDelivery: *delivery, Seed: seed}, nil
+}
+
+// drawMockExamQuestions ジャンルごとに条件に合う問題を問題ID順に集め、シードでシャッフルして指定数を選ぶ
+func (q QuestionService) drawMockExamQuestions(userID string, req MockExamRequest, seed int64) ([]int, error) {
+	rng := rand.New(rand.NewPCG(uint64(seed), 0))
+	var questionIDs []int
+	for _, section := range req.Sections {
+		stats, err := q.Repo.GetQuestionStatsByGenre(userID, section.GenreID)
+		if err != nil {
+			return nil, err
+		}
+		var candidates []int
+		for _, stat := range stats {
+			if req.Difficulty == "" || stat.difficulty() == req.Difficulty {
+				candidates = append(candidates, stat.QuestionID)
+			}
+		}
+		if len(candidates) < section.Count {
+			return nil, fmt.Errorf("%w: genre %d has %d questions", ErrNotEnoughQuestions, section.GenreID, len(candidates))
+		}
+		rng.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+		questionIDs = append(questionIDs, candidates[:section.Count]...)
+	}
+	return questionIDs, nil
+}
+
+// previousMockExamQuestions ユーザーが以前に同じシード・条件で作った模擬試験の問題IDを返す（ない場合は nil）
+// 削除された問題や回答できなくなった問題がある場合は、同じ試験を作れないので ErrNotEnoughQuestions を返す
+func (q QuestionService) previousMockExamQuestions(userID string, req MockExamRequest) ([]int, error) {
+	exams, err := q.Repo.GetMockExamsBySeed(userID, *req.Seed)
+	if err != nil {
+		return nil, err
+	}
+	var previous *MockExam
+	for i := range exams {
+		if exams[i].sameConditions(req) && len(exams[i].QuestionIDs) > 0 {
+			previous = &exams[i]
+			break
+		}
+	}
+	if previous == nil {
+		return nil, nil
+	}
+
+	// 難易度は回答数で変わるので、回答できるかどうかだけを確認する
+	answerable := make(map[int]bool)
+	for _, section := range req.Sections {
+		stats, err := q.Repo.GetQuestionStatsByGenre(userID, section.GenreID)
+		if err != nil {
+			return nil, err
+		}
+		for _, stat := range stats {
+			answerable[stat.QuestionID] = true
+		}
+	}
+	for _, id := range previous.QuestionIDs {
+		if !answerable[id] {
+			return nil, fmt.Errorf("%w: question %d of the previous exam is no longer available", ErrNotEnoughQuestions, id)
+		}
+	}
+	return previous.QuestionIDs, nil
+}
+
+// GetMockExamReport 模擬試験の結果をジャンル別に集計する（自分のアテンプトのみ）
+func (q QuestionService) GetMockExamReport(userID, attemptID string) (*MockExamReport, error) {
+	attempt, err := q.Repo.GetAttempt(attemptID)
+	if err != nil {
+		return nil, err
+	}
+	if attempt == nil || attempt.UserID != userID || attempt.Kind != AttemptKindMockExam {
+		return nil, ErrAttemptNotFound
+	}
+	exam, err := q.Repo.GetMockExam(attemptID)
+	if err != nil {
+		return nil, err
+	}
+	if exam == nil {
+		return nil, ErrAttemptNotFound
+	}
+	scores, err := q.Repo.GetGenreScores(attemptID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range scores {
+		if scores[i].TotalPoints > 0 {
+			scores[i].Score = scores[i].EarnedPoints / float64(scores[i].TotalPoints) * 100
+		}
+	}
+	return &MockExamReport{Attempt: *attempt, MockExam: *exam, GenreScores: scores}, nil
+}
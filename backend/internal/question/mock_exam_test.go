@@ -0,0 +1,180 @@
+package question
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// mockExamRepository はジャンルごとの問題の回答数と、保存した模擬試験を返す
+type mockExamRepository struct {
+	QuestionRepository
+	stats map[int][]QuestionStat // ジャンルID -> 問題ID順の統計
+	exams []MockExam
+}
+
+func (r *mockExamRepository) GetQuestionStatsByGenre(userID string, genreID int) ([]QuestionStat, error) {
+	return r.stats[genreID], nil
+}
+
+func (r *mockExamRepository) GetMockExamsBySeed(userID string, seed int64) ([]MockExam, error) {
+	var exams []MockExam
+	for _, exam := range r.exams {
+		if exam.Seed == seed {
+			exams = append(exams, exam)
+		}
+	}
+	return exams, nil
+}
+
+// newMockExamRepository はジャンル1に問題1〜20、ジャンル2に問題101〜110を入れる
+// ジャンル1の奇数の問題は正答率が高い（easy）、偶数の問題は低い（hard）
+func newMockExamRepository() *mockExamRepository {
+	repo := &mockExamRepository{stats: map[int][]QuestionStat{}}
+	for id := 1; id <= 20; id++ {
+		correct := 1
+		if id%2 == 1 {
+			correct = 9
+		}
+		repo.stats[1] = append(repo.stats[1], QuestionStat{QuestionID: id, AnsweredCount: 10, CorrectCount: correct})
+	}
+	for id := 101; id <= 110; id++ {
+		repo.stats[2] = append(repo.stats[2], QuestionStat{QuestionID: id})
+	}
+	return repo
+}
+
+func TestQuestionStatDifficulty(t *testing.T) {
+	tests := []struct {
+		stat QuestionStat
+		want string
+	}{
+		{QuestionStat{AnsweredCount: 4, CorrectCount: 4}, DifficultyMedium}, // 回答数が足りない
+		{QuestionStat{AnsweredCount: 10, CorrectCount: 8}, DifficultyEasy},
+		{QuestionStat{AnsweredCount: 10, CorrectCount: 7}, DifficultyMedium},
+		{QuestionStat{AnsweredCount: 10, CorrectCount: 5}, DifficultyMedium},
+		{QuestionStat{AnsweredCount: 10, CorrectCount: 4}, DifficultyHard},
+	}
+	for _, tt := range tests {
+		if got := tt.stat.difficulty(); got != tt.want {
+			t.Errorf("difficulty(%d/%d) = %q, want %q", tt.stat.CorrectCount, tt.stat.AnsweredCount, got, tt.want)
+		}
+	}
+}
+
+func TestDrawMockExamQuestions(t *testing.T) {
+	service := QuestionService{Repo: newMockExamRepository()}
+	req := MockExamRequest{Sections: []MockExamSection{{GenreID: 1, Count: 5}, {GenreID: 2, Count: 3}}}
+
+	first, err := service.drawMockExamQuestions("user-1", req, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 8 {
+		t.Fatalf("drew %d questions, want 8", len(first))
+	}
+	seen := make(map[int]bool)
+	for i, id := range first {
+		// ジャンルごとの出題数と、セクションの順番を守る
+		if wantGenre2 := i >= 5; (id > 100) != wantGenre2 {
+			t.Errorf("question %d at position %d is in the wrong section: %v", id, i, first)
+		}
+		if seen[id] {
+			t.Errorf("question %d was drawn twice: %v", id, first)
+		}
+		seen[id] = true
+	}
+
+	// 同じシードなら同じ問題が同じ順番で出る
+	again, err := service.drawMockExamQuestions("user-1", req, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, again) {
+		t.Errorf("same seed drew %v, then %v", first, again)
+	}
+
+	// シードを変えると別の試験になる
+	other, err := service.drawMockExamQuestions("user-1", req, 43)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(first, other) {
+		t.Errorf("different seeds drew the same questions: %v", first)
+	}
+}
+
+func TestDrawMockExamQuestionsFiltersDifficulty(t *testing.T) {
+	service := QuestionService{Repo: newMockExamRepository()}
+
+	tests := []struct {
+		difficulty string
+		count      int
+		wantOdd    bool
+		wantErr    error
+	}{
+		{DifficultyEasy, 10, true, nil},
+		{DifficultyHard, 10, false, nil},
+		{DifficultyEasy, 11, true, ErrNotEnoughQuestions},
+		{DifficultyMedium, 1, false, ErrNotEnoughQuestions},
+	}
+	for _, tt := range tests {
+		req := MockExamRequest{Difficulty: tt.difficulty, Sections: []MockExamSection{{GenreID: 1, Count: tt.count}}}
+		ids, err := service.drawMockExamQuestions("user-1", req, 7)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s x %d: err = %v, want %v", tt.difficulty, tt.count, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			if (id%2 == 1) != tt.wantOdd {
+				t.Errorf("%s: drew question %d with another difficulty", tt.difficulty, id)
+			}
+		}
+	}
+}
+
+func TestPreviousMockExamQuestions(t *testing.T) {
+	seed := int64(42)
+	sections := mockExamSections{{GenreID: 1, Count: 2}}
+	repo := newMockExamRepository()
+	repo.exams = []MockExam{
+		{Seed: seed, Difficulty: DifficultyHard, Sections: sections, QuestionIDs: questionIDList{2, 4}},
+		{Seed: seed, Sections: sections, QuestionIDs: questionIDList{7, 3}},
+	}
+	service := QuestionService{Repo: repo}
+
+	tests := []struct {
+		name    string
+		req     MockExamRequest
+		want    []int
+		wantErr error
+	}{
+		{"same conditions", MockExamRequest{Seed: &seed, Sections: sections}, []int{7, 3}, nil},
+		{"same conditions with difficulty", MockExamRequest{Seed: &seed, Difficulty: DifficultyHard, Sections: sections}, []int{2, 4}, nil},
+		{"different count", MockExamRequest{Seed: &seed, Sections: []MockExamSection{{GenreID: 1, Count: 3}}}, nil, nil},
+		{"different genre", MockExamRequest{Seed: &seed, Sections: []MockExamSection{{GenreID: 2, Count: 2}}}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.previousMockExamQuestions("user-1", tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// 以前の試験の問題が回答できなくなっている場合は、同じ試験を作れない
+	repo.stats[1] = repo.stats[1][3:] // 問題1〜3を除く
+	_, err := service.previousMockExamQuestions("user-1", MockExamRequest{Seed: &seed, Sections: sections})
+	if !errors.Is(err, ErrNotEnoughQuestions) {
+		t.Errorf("err = %v, want %v", err, ErrNotEnoughQuestions)
+	}
+}
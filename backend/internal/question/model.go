@@ -4,32 +4,49 @@ import "time"
 
 // DBに対応したデータ構造
 
+// SubmissionResult 回答結果（アテンプトの情報と問題ごとの正誤）
 type SubmissionResult struct {
+	Attempt
 	Results  []Result `json:"results"`
 	Progress string   `json:"progress"`
 }
 
 type Result struct {
-	QuestionID int    `json:"questionId"`
-	UserAnswer string `json:"userAnswer"`
-	Correct    bool   `json:"correct"`
+	QuestionID    int         `json:"questionId"`
+	UserAnswer    AnswerValue `json:"userAnswer"`
+	CorrectAnswer AnswerValue `json:"correctAnswer"`
+	Correct       bool        `json:"correct"`
+	// 得点の割合（0〜1。部分点がない問題は 0 か 1）と配点・得点
+	Credit       float64 `json:"credit"`
+	Points       int     `json:"points"`
+	EarnedPoints float64 `json:"earnedPoints"`
+	// 採点に使った正規化後の回答（記述式・数値の問題のみ）
+	NormalizedAnswer string `json:"normalizedAnswer,omitempty"`
+	// 回答にかかった秒数
+	TimeSpentSeconds int `json:"timeSpentSeconds"`
+	// 使ったヒントの数（HintPenalty の割合ずつ得点を減らした）
+	HintsUsed int `json:"hintsUsed"`
+	// 回答の自信度（未指定の場合は空文字）
+	Confidence string `json:"confidence,omitempty"`
+	// 解説・参考リンク・ヒント（採点後の結果でのみ返す）
+	QuestionExplanation
 }
 
 // InsertQuestionsRequest はフロントエンドからのリクエスト構造
 type InsertQuestionsRequest struct {
-	Title     string                `json:"title"`
+	QuestionSetFields
 	Questions []QuestionRequestBody `json:"questions"`
 }
 
 // FixQuestionsRequest
 type FixQuestionsRequest struct {
-	QuestionSetId int                      `json:"questionSetId"`
-	Title         string                   `json:"title"`
-	GenreId       int                      `json:"genreId"`
-	Questions     []FixQuestionRequestBody `json:"questions"`
+	QuestionSetId int `json:"questionSetId"`
+	QuestionSetFields
+	Questions []FixQuestionRequestBody `json:"questions"`
 }
 
 // QuestionRequestBody は問題データの構造
+// Visibility は旧形式のリクエスト用（問題集の visibility が指定されていない場合のみ使う）
 type QuestionRequestBody struct {
 	GenreID    int    `json:"genreId"`
 	Visibility string `json:"visibility"`
@@ -37,9 +54,15 @@ type QuestionRequestBody struct {
 	Answer     string `json:"answer"`
 	Choices1   string `json:"choices1"`
 	Choices2   string `json:"choices2"`
+	// 問題の種類（未指定の場合は single_choice）と種類ごとの設定
+	QuestionType string       `json:"questionType"`
+	Spec         QuestionSpec `json:"spec"`
+	// 解説・参考リンク・ヒント
+	QuestionExplanation
 }
 
 // FixQuestionRequestBody
+// Visibility は旧形式のリクエスト用（問題集の visibility が指定されていない場合のみ使う）
 type FixQuestionRequestBody struct {
 	ID         *int   `json:"id,omitempty"`
 	GenreID    int    `json:"genreId"`
@@ -48,83 +71,94 @@ type FixQuestionRequestBody struct {
 	Answer     string `json:"answer"`
 	Choices1   string `json:"choices1"`
 	Choices2   string `json:"choices2"`
+	// 問題の種類（未指定の場合は single_choice）と種類ごとの設定
+	QuestionType string       `json:"questionType"`
+	Spec         QuestionSpec `json:"spec"`
+	// 解説・参考リンク・ヒント
+	QuestionExplanation
 }
 
-// Question は SELECT用の構造体
+// Question は SELECT用の構造体（タイトル・公開範囲は問題集のもの）
 type Question struct {
-	ID         int       `json:"id" gorm:"AUTO_INCREMENT"`
-	UserID     string    `json:"userId" gorm:"column:user_id"`
-	Title      string    `json:"title" gorm:"column:title"`
-	GenreID    int       `json:"genreId" gorm:"column:genre_id"`
-	GenreName  string    `json:"genreName" gorm:"column:genre_name"`
-	Visibility string    `json:"visibility" gorm:"column:visibility"`
-	Question   string    `json:"question" gorm:"column:question"`
-	Answer     string    `json:"answer" gorm:"column:answer"`
-	Choices1   string    `json:"choices1" gorm:"column:choices1"`
-	Choices2   string    `json:"choices2" gorm:"column:choices2"`
-	CreatedAt  time.Time `json:"createdAt" gorm:"column:created_at"`
-	UpdatedAt  time.Time `json:"updatedAt" gorm:"column:updated_at"`
+	ID           int          `json:"id" gorm:"AUTO_INCREMENT"`
+	UserID       string       `json:"userId" gorm:"column:user_id"`
+	Title        string       `json:"title" gorm:"column:title"`
+	GenreID      int          `json:"genreId" gorm:"column:genre_id"`
+	GenreName    string       `json:"genreName" gorm:"column:genre_name"`
+	Visibility   string       `json:"visibility" gorm:"column:visibility"`
+	Question     string       `json:"question" gorm:"column:question"`
+	Answer       string       `json:"answer" gorm:"column:answer"`
+	Choices1     string       `json:"choices1" gorm:"column:choices1"`
+	Choices2     string       `json:"choices2" gorm:"column:choices2"`
+	QuestionType string       `json:"questionType" gorm:"column:question_type"`
+	Spec         QuestionSpec `json:"spec" gorm:"column:spec;type:jsonb"`
+	// ヒントの数（ヒントの内容は RevealHint で1つずつ返す）
+	HintCount int       `json:"hintCount" gorm:"column:hint_count;->"`
+	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"column:updated_at"`
 }
 
 // InsertQuestion データベースに挿入する用の構造体
 type InsertQuestion struct {
-	ID         int       `json:"id" gorm:"AUTO_INCREMENT"`
-	UserID     string    `json:"userId" gorm:"column:user_id"`
-	Title      string    `json:"title" gorm:"column:title"`
-	GenreID    int       `json:"genreId" gorm:"column:genre_id"`
-	Visibility string    `json:"visibility" gorm:"column:visibility"`
-	Question   string    `json:"question" gorm:"column:question"`
-	Answer     string    `json:"answer" gorm:"column:answer"`
-	Choices1   string    `json:"choices1" gorm:"column:choices1"`
-	Choices2   string    `json:"choices2" gorm:"column:choices2"`
-	CreatedAt  time.Time `json:"createdAt" gorm:"column:created_at"`
-	UpdatedAt  time.Time `json:"updatedAt" gorm:"column:updated_at"`
+	ID           int          `json:"id" gorm:"AUTO_INCREMENT"`
+	UserID       string       `json:"userId" gorm:"column:user_id"`
+	GenreID      int          `json:"genreId" gorm:"column:genre_id"`
+	Question     string       `json:"question" gorm:"column:question"`
+	Answer       string       `json:"answer" gorm:"column:answer"`
+	Choices1     string       `json:"choices1" gorm:"column:choices1"`
+	Choices2     string       `json:"choices2" gorm:"column:choices2"`
+	QuestionType string       `json:"questionType" gorm:"column:question_type"`
+	Spec         QuestionSpec `json:"spec" gorm:"column:spec;type:jsonb"`
+	QuestionExplanation
+	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"column:updated_at"`
 }
 
 // FixQuestion データベースに挿入する用の構造体
 type FixQuestion struct {
-	ID         *int      `json:"id" gorm:"id"`
-	Title      string    `json:"title" gorm:"column:title"`
-	GenreID    int       `json:"genreId" gorm:"column:genre_id"`
-	Visibility string    `json:"visibility" gorm:"column:visibility"`
-	Question   string    `json:"question" gorm:"column:question"`
-	Answer     string    `json:"answer" gorm:"column:answer"`
-	Choices1   string    `json:"choices1" gorm:"column:choices1"`
-	Choices2   string    `json:"choices2" gorm:"column:choices2"`
-	UpdatedAt  time.Time `json:"updatedAt" gorm:"column:updated_at"`
+	ID           *int         `json:"id" gorm:"id"`
+	GenreID      int          `json:"genreId" gorm:"column:genre_id"`
+	Question     string       `json:"question" gorm:"column:question"`
+	Answer       string       `json:"answer" gorm:"column:answer"`
+	Choices1     string       `json:"choices1" gorm:"column:choices1"`
+	Choices2     string       `json:"choices2" gorm:"column:choices2"`
+	QuestionType string       `json:"questionType" gorm:"column:question_type"`
+	Spec         QuestionSpec `json:"spec" gorm:"column:spec;type:jsonb"`
+	QuestionExplanation
+	UpdatedAt time.Time `json:"updatedAt" gorm:"column:updated_at"`
 }
 
 // QuestionSetResponse GetQuestionSetで返すための構造体
+// 正解・選択肢は含めない（回答画面は StartAttempt の DeliveredQuestion を使う）
 type QuestionSetResponse struct {
 	ID           int    `json:"id" gorm:"column:id"`
 	Title        string `json:"title" gorm:"column:title"`
 	Question     string `json:"question" gorm:"column:question"`
-	Answer       string `json:"answer" gorm:"column:answer"`
-	Choices1     string `json:"choices1" gorm:"column:choices1"`
-	Choices2     string `json:"choices2" gorm:"column:choices2"`
 	GenreName    string `json:"genreName" gorm:"column:genre_name"`
 	IsRegistered bool   `json:"isRegistered" gorm:"column:is_registered"`
 	IsEvaluated  bool   `json:"isEvaluated" gorm:"column:is_evaluated"`
 	Evaluate     int    `json:"evaluate"`
 }
 
-// QuestionSetForFixResponse 問題集修正用
+// QuestionSetForFixResponse 問題集修正用（タイトル・公開範囲は問題集のもの）
 type QuestionSetForFixResponse struct {
-	ID         int    `json:"id" gorm:"column:id"`
-	Title      string `json:"title" gorm:"column:title"`
-	Question   string `json:"question" gorm:"column:question"`
-	Answer     string `json:"answer" gorm:"column:answer"`
-	Choices1   string `json:"choices1" gorm:"column:choices1"`
-	Choices2   string `json:"choices2" gorm:"column:choices2"`
-	GenreId    int    `json:"genreId" gorm:"column:genre_id"`
-	Visibility string `json:"visibility" gorm:"column:visibility"`
+	ID           int          `json:"id" gorm:"column:id"`
+	Title        string       `json:"title" gorm:"column:title"`
+	Question     string       `json:"question" gorm:"column:question"`
+	Answer       string       `json:"answer" gorm:"column:answer"`
+	Choices1     string       `json:"choices1" gorm:"column:choices1"`
+	Choices2     string       `json:"choices2" gorm:"column:choices2"`
+	GenreId      int          `json:"genreId" gorm:"column:genre_id"`
+	Visibility   string       `json:"visibility" gorm:"column:visibility"`
+	QuestionType string       `json:"questionType" gorm:"column:question_type"`
+	Spec         QuestionSpec `json:"spec" gorm:"column:spec"`
+	QuestionExplanation
 }
 
-// QuestionSet は問題集テーブルにレコードを挿入する構造体
+// QuestionSet は問題集と問題の対応テーブルにレコードを挿入する構造体
 type QuestionSet struct {
 	SetID      int `gorm:"column:set_id"`
 	QuestionID int `gorm:"column:question_id"`
-	GenreID    int `gorm:"column:genre_id"`
 }
 
 // Star は問題集評価テーブルにレコードを挿入する構造
@@ -144,8 +178,13 @@ func (Star) TableName() string {
 }
 
 type IDAnswer struct {
-	ID     int    `json:"id" gorm:"column:id"`
-	Answer string `json:"answer" gorm:"column:answer"`
+	ID           int          `json:"id" gorm:"column:id"`
+	Answer       string       `json:"answer" gorm:"column:answer"`
+	QuestionType string       `json:"questionType" gorm:"column:question_type"`
+	Spec         QuestionSpec `json:"spec" gorm:"column:spec"`
+	HintPenalty  float64      `json:"hintPenalty" gorm:"column:hint_penalty"`
+	// テンプレート問題で出題した値（採点時に attempt_responses から設定する）
+	Variables templateValues `json:"-" gorm:"-"`
 }
 
 // Genre ジャンルを取得して画面に返す時に使用する構造体
@@ -0,0 +1,110 @@
+package question
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// 回答の正規化
+// 記述式の問題は、全角・半角、前後の空白、ひらがな・カタカナ、大文字・小文字の違いで不正解にならないよう、
+// 正解と回答の両方を同じ手順で正規化してから比較する。手順は問題ごとに QuestionSpec.Normalization で変えられる
+
+// AnswerNormalization 回答の正規化の設定（nil の項目は初期値の true として扱う）
+type AnswerNormalization struct {
+	NFKC       *bool `json:"nfkc,omitempty"`       // Unicode 正規化（NFKC）。全角英数字や半角カナも揃う
+	Width      *bool `json:"width,omitempty"`      // 全角・半角を揃える（NFKC を使わない場合のみ意味がある）
+	Kana       *bool `json:"kana,omitempty"`       // カタカナをひらがなに揃える
+	IgnoreCase *bool `json:"ignoreCase,omitempty"` // 大文字・小文字を区別しない
+	Whitespace *bool `json:"whitespace,omitempty"` // 前後の空白を除き、連続する空白を1つにする
+	// 同じ意味として扱う語のグループ（回答全体がグループの語と一致する場合、グループの先頭の語に置き換えてから比較する）
+	Synonyms [][]string `json:"synonyms,omitempty"`
+}
+
+// enabled は設定が nil（未指定）の場合に true を返す
+func enabled(option *bool) bool {
+	return option == nil || *option
+}
+
+// validate は同義語のグループを検証する
+func (n *AnswerNormalization) validate() error {
+	for _, group := range n.Synonyms {
+		if len(nonEmpty(group...)) < 2 {
+			return fmt.Errorf("%w: each synonym group needs at least 2 terms", ErrInvalidQuestion)
+		}
+	}
+	return nil
+}
+
+// normalizeAnswer は設定に従って回答を正規化する（settings が nil の場合はすべての手順を行う）
+func normalizeAnswer(s string, settings *AnswerNormalization) string {
+	if settings == nil {
+		settings = &AnswerNormalization{}
+	}
+	s = normalizeText(s, settings)
+	if len(settings.Synonyms) > 0 {
+		s = replaceSynonyms(s, settings)
+	}
+	return s
+}
+
+// normalizeText は同義語の置き換え以外の手順を行う
+func normalizeText(s string, settings *AnswerNormalization) string {
+	if enabled(settings.NFKC) {
+		s = norm.NFKC.String(s)
+	} else if enabled(settings.Width) {
+		s = width.Fold.String(s)
+	}
+	if enabled(settings.Whitespace) {
+		s = strings.Join(strings.Fields(s), " ")
+	}
+	if enabled(settings.IgnoreCase) {
+		s = strings.ToLower(s)
+	}
+	if enabled(settings.Kana) {
+		s = foldKana(s)
+	}
+	return s
+}
+
+// replaceSynonyms は回答全体が同義語のいずれかと一致する場合に、グループの先頭の語に置き換える
+// 回答の一部分だけを置き換えると、別の語の一部（「米」→「アメリカ」なら「米国」も変わる）まで変わるので、全体で比較する
+func replaceSynonyms(s string, settings *AnswerNormalization) string {
+	for _, group := range settings.Synonyms {
+		terms := nonEmpty(group...)
+		if len(terms) < 2 {
+			continue
+		}
+		for _, term := range terms {
+			if normalizeText(term, settings) == s {
+				return normalizeText(terms[0], settings)
+			}
+		}
+	}
+	return s
+}
+
+// foldKana はカタカナ（ァ〜ヶ、ヽ・ヾ）をひらがなに置き換える
+func foldKana(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'ァ' && r <= 'ヶ', r == 'ヽ', r == 'ヾ':
+			return r - 0x60
+		default:
+			return r
+		}
+	}, s)
+}
+
+// normalizeNumber は数値の回答を読み取れる形にする（全角数字・全角記号を半角にし、空白を除く）
+func normalizeNumber(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, norm.NFKC.String(s))
+}
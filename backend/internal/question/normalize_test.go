@@ -0,0 +1,82 @@
+package question
+
+import "testing"
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestNormalizeAnswer(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		settings *AnswerNormalization
+		want     string
+	}{
+		{"NFKC full-width alphanumerics", "ＡＢＣ１２３", nil, "abc123"},
+		{"NFKC half-width kana", "ｶﾀｶﾅ", nil, "かたかな"},
+		{"NFKC disabled keeps full width", "ＡＢＣ", &AnswerNormalization{NFKC: boolPtr(false), Width: boolPtr(false)}, "ａｂｃ"},
+		{"width fold without NFKC", "ＡＢＣ", &AnswerNormalization{NFKC: boolPtr(false)}, "abc"},
+		{"kana folding", "カタカナ", nil, "かたかな"},
+		{"kana folding disabled", "カタカナ", &AnswerNormalization{Kana: boolPtr(false)}, "カタカナ"},
+		{"case folding", "Tokyo", nil, "tokyo"},
+		{"case folding disabled", "Tokyo", &AnswerNormalization{IgnoreCase: boolPtr(false)}, "Tokyo"},
+		{"whitespace", "  New \t York  ", nil, "new york"},
+		{"full-width space", "New　York", nil, "new york"},
+		{"whitespace disabled", " a  b ", &AnswerNormalization{Whitespace: boolPtr(false)}, " a  b "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeAnswer(tt.input, tt.settings); got != tt.want {
+				t.Errorf("normalizeAnswer(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAnswerSynonyms(t *testing.T) {
+	settings := &AnswerNormalization{Synonyms: [][]string{
+		{"アメリカ", "米", "USA"},
+		{"car", "automobile"},
+	}}
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"アメリカ", "あめりか"},
+		{"米", "あめりか"},
+		{"ＵＳＡ", "あめりか"},
+		{" usa ", "あめりか"},
+		{"Automobile", "car"},
+		// 回答の一部だけが同義語と一致する場合は置き換えない
+		{"米国", "米国"},
+		{"carpet", "carpet"},
+		{"automobiles", "automobiles"},
+		{"red car", "red car"},
+	}
+	for _, tt := range tests {
+		if got := normalizeAnswer(tt.input, settings); got != tt.want {
+			t.Errorf("normalizeAnswer(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestGradeFreeTextSynonyms(t *testing.T) {
+	question := IDAnswer{
+		Answer: "アメリカ",
+		Spec:   QuestionSpec{Normalization: &AnswerNormalization{Synonyms: [][]string{{"アメリカ", "米", "USA"}}}},
+	}
+	tests := []struct {
+		answer string
+		want   bool
+	}{
+		{"あめりか", true},
+		{"米", true},
+		{"usa", true},
+		{"米国", false},
+		{"USA合衆国", false},
+	}
+	for _, tt := range tests {
+		if got := gradeFreeText(question, AnswerValue{Values: []string{tt.answer}}); got != tt.want {
+			t.Errorf("gradeFreeText(%q) = %v, want %v", tt.answer, got, tt.want)
+		}
+	}
+}
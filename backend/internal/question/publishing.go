@@ -0,0 +1,164 @@
+package question
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+// 問題集の公開の状態（visibility）
+// 下書き（draft）→ 非公開・限定公開・公開予約・公開 → アーカイブ のように変えていく
+// 一度下書きから出した問題集は、学習中のユーザーがいる可能性があるので下書きには戻せない
+// 下書きは AutosaveQuestionSet で何度でも上書き保存でき、リビジョンは作らない
+// 限定公開の問題集は、共有トークンを OpenSharedQuestionSet で開いたユーザーだけが閲覧・回答できる
+// 公開予約の問題集は、PublishAt を過ぎると定期実行（SchedulePublishing）で公開する
+
+// shareTokenBytes 共有トークンのバイト数（base64url で32文字）
+const shareTokenBytes = 24
+
+// newShareToken は限定公開の共有トークンを発行する
+func newShareToken() (string, error) {
+	buf := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// applyPublishingState は問題集の公開範囲を fields.Visibility に変えられるかを確認し、必要な準備をする
+// 限定公開にする場合、共有トークンがまだなければ発行する
+func applyPublishingState(repo QuestionRepository, questionSetID int, fields QuestionSetFields) error {
+	current, err := repo.GetQuestionSetInfo(questionSetID)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return ErrQuestionSetNotFound
+	}
+	if current.Visibility != VisibilityDraft && fields.Visibility == VisibilityDraft {
+		return fmt.Errorf("%w: a question set that has left draft cannot return to draft", ErrInvalidQuestionSet)
+	}
+	if fields.Visibility == VisibilityUnlisted && current.ShareToken == "" {
+		token, err := newShareToken()
+		if err != nil {
+			return err
+		}
+		if err := repo.UpdateShareToken(questionSetID, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AutosaveQuestionSet 下書きの問題集を上書き保存する（作成途中の内容の自動保存）
+// 下書きの問題集のみ保存でき、公開範囲は下書きのままにする。リビジョンは作らない（下書きから出したときに作る）
+// 作成者本人か、canEditAny（モデレーター）の場合のみ保存できる
+func (q QuestionService) AutosaveQuestionSet(questionSetID int, fields QuestionSetFields, questions []FixQuestion, userId string, canEditAny bool) error {
+	fields.Visibility = VisibilityDraft
+	if err := validateFixQuestionSet(&fields, questions); err != nil {
+		return err
+	}
+
+	owner, err := q.authorizeQuestionSetEdit(userId, questionSetID, canEditAny)
+	if err != nil {
+		return err
+	}
+
+	return q.Repo.Transaction(func(repo QuestionRepository) error {
+		info, err := repo.GetQuestionSetInfo(questionSetID)
+		if err != nil {
+			return err
+		}
+		if info == nil {
+			return ErrQuestionSetNotFound
+		}
+		if info.Visibility != VisibilityDraft {
+			return fmt.Errorf("%w: only draft question sets can be autosaved", ErrInvalidQuestionSet)
+		}
+		return applyQuestionSetFix(repo, questionSetID, fields, questions, owner)
+	})
+}
+
+// OpenSharedQuestionSet 共有トークンで限定公開の問題集を開く
+// 開いたユーザーを記録し、以降はそのユーザーも問題集を閲覧・回答できるようにする
+func (q QuestionService) OpenSharedQuestionSet(userID, shareToken string) (*QuestionSetInfo, error) {
+	if shareToken == "" {
+		return nil, ErrQuestionSetNotFound
+	}
+	questionSetID, err := q.Repo.GetUnlistedQuestionSetIDByShareToken(shareToken)
+	if err != nil {
+		return nil, err
+	}
+	if questionSetID == 0 {
+		return nil, ErrQuestionSetNotFound
+	}
+	if err := q.Repo.InsertQuestionSetShare(questionSetID, userID); err != nil {
+		return nil, err
+	}
+	return q.GetQuestionSetInfo(userID, questionSetID)
+}
+
+// PublishScheduledQuestionSets 公開予約の日時を過ぎた問題集を公開し、公開した問題集の数を返す
+// 公開範囲もリビジョンに含めるので、公開した内容を新しいリビジョンとして保存する（作成者が公開したものとして記録する）
+func (q QuestionService) PublishScheduledQuestionSets() (int, error) {
+	now := time.Now()
+	ids, err := q.Repo.GetDueScheduledQuestionSetIDs(now)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, id := range ids {
+		err := q.Repo.Transaction(func(repo QuestionRepository) error {
+			ok, err := repo.PublishScheduledQuestionSet(id, now)
+			if err != nil || !ok {
+				return err
+			}
+			info, err := repo.GetQuestionSetInfo(id)
+			if err != nil {
+				return err
+			}
+			if info == nil {
+				return ErrQuestionSetNotFound
+			}
+			if _, err := saveRevision(repo, id, info.UserID, nil); err != nil {
+				return err
+			}
+			published++
+			return nil
+		})
+		if err != nil {
+			// 1件の失敗で他の問題集の公開を止めない
+			log.Printf("Failed to publish question set %d: %v", id, err)
+		}
+	}
+	return published, nil
+}
+
+// SchedulePublishing 公開予約の問題集を公開する処理を定期実行する
+func SchedulePublishing(db *gorm.DB) {
+	service := &QuestionService{Repo: &GormRepository{DB: db}}
+	c := cron.New()
+
+	_, err := c.AddFunc("* * * * *", func() { // 1分ごと
+		count, err := service.PublishScheduledQuestionSets()
+		if err != nil {
+			log.Println("Failed to publish scheduled question sets:", err)
+			return
+		}
+		if count > 0 {
+			log.Printf("Published %d scheduled question sets", count)
+		}
+	})
+
+	if err != nil {
+		log.Fatal("Failed to schedule publishing:", err)
+	}
+
+	c.Start()
+}
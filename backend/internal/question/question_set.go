@@ -0,0 +1,147 @@
+package question
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 問題集（online_learning_question_sets）
+// タイトル・説明・ジャンル・公開範囲などは問題集の単位で持つ（問題の行には持たない）
+// 問題との対応は online_learning_question_set（set_id → question_id）で管理する
+
+// 公開範囲（公開の状態。状態ごとのアクセス制御は access.go、状態の変更は publishing.go）
+const (
+	// VisibilityDraft 下書き（自動保存される。作成者のみ閲覧でき、誰も回答できない）
+	VisibilityDraft = "draft"
+	// VisibilityPrivate 非公開（作成者のみ）
+	VisibilityPrivate = "private"
+	// VisibilityUnlisted 限定公開（共有トークンを開いたユーザーのみ。検索には出さない）
+	VisibilityUnlisted = "unlisted"
+	// VisibilityScheduled 公開予約（PublishAt になると public になる。それまでは非公開と同じ）
+	VisibilityScheduled = "scheduled"
+	// VisibilityPublic 公開
+	VisibilityPublic = "public"
+	// VisibilityArchived アーカイブ（検索に出さず、マイ学習リストに追加済みのユーザーのみ続けられる）
+	VisibilityArchived = "archived"
+)
+
+const (
+	// defaultLanguage 言語が指定されていない問題集の言語
+	defaultLanguage = "ja"
+	// maxTitleLength 問題集のタイトルの最大文字数
+	maxTitleLength = 255
+	// maxLanguageLength 言語コードの最大文字数（ja, en-US など）
+	maxLanguageLength = 10
+)
+
+// ErrInvalidQuestionSet は問題集のタイトル・公開範囲などが正しくない場合に返す（ハンドラーで400にする）
+var ErrInvalidQuestionSet = errors.New("invalid question set")
+
+// QuestionSetFields 問題集の項目（作成・修正のリクエストと問題集テーブルで共通）
+type QuestionSetFields struct {
+	Title       string `json:"title" gorm:"column:title"`
+	Description string `json:"description" gorm:"column:description"`
+	GenreID     int    `json:"genreId" gorm:"column:genre_id"`
+	Visibility  string `json:"visibility" gorm:"column:visibility"`
+	Language    string `json:"language" gorm:"column:language"`
+	// 作成者が設定する難易度（easy / medium / hard。未設定の場合は空文字）
+	Difficulty    string `json:"difficulty" gorm:"column:difficulty"`
+	CoverImageURL string `json:"coverImageUrl" gorm:"column:cover_image_url"`
+	// 公開予約の日時（visibility が scheduled の場合のみ）
+	PublishAt *time.Time `json:"publishAt,omitempty" gorm:"column:publish_at"`
+}
+
+// applyDefaults は未指定の項目を補う
+// ジャンル・公開範囲が問題集に指定されていない場合は、旧形式のリクエストとして先頭の問題の値を使う
+func (f *QuestionSetFields) applyDefaults(genreID int, visibility string) {
+	f.Title = strings.TrimSpace(f.Title)
+	if f.GenreID == 0 {
+		f.GenreID = genreID
+	}
+	if f.Visibility == "" {
+		f.Visibility = visibility
+	}
+	if f.Visibility == "" {
+		f.Visibility = VisibilityPrivate
+	}
+	if f.Language == "" {
+		f.Language = defaultLanguage
+	}
+}
+
+// validate は問題集の項目を検証する
+// 下書きはタイトルが空でも保存できる。公開予約以外の場合、PublishAt は使わないので空にする
+func (f *QuestionSetFields) validate() error {
+	if (f.Title == "" && f.Visibility != VisibilityDraft) || len([]rune(f.Title)) > maxTitleLength {
+		return fmt.Errorf("%w: title must be 1 to %d characters", ErrInvalidQuestionSet, maxTitleLength)
+	}
+	if f.GenreID <= 0 {
+		return fmt.Errorf("%w: genreId is required", ErrInvalidQuestionSet)
+	}
+	switch f.Visibility {
+	case VisibilityDraft, VisibilityPrivate, VisibilityUnlisted, VisibilityPublic, VisibilityArchived:
+		f.PublishAt = nil
+	case VisibilityScheduled:
+		if f.PublishAt == nil || !f.PublishAt.After(time.Now()) {
+			return fmt.Errorf("%w: publishAt must be in the future for scheduled question sets", ErrInvalidQuestionSet)
+		}
+	default:
+		return fmt.Errorf("%w: unknown visibility %q", ErrInvalidQuestionSet, f.Visibility)
+	}
+	if len(f.Language) > maxLanguageLength {
+		return fmt.Errorf("%w: language must be at most %d characters", ErrInvalidQuestionSet, maxLanguageLength)
+	}
+	switch f.Difficulty {
+	case "", DifficultyEasy, DifficultyMedium, DifficultyHard:
+	default:
+		return fmt.Errorf("%w: unknown difficulty %q", ErrInvalidQuestionSet, f.Difficulty)
+	}
+	if f.CoverImageURL != "" {
+		u, err := url.Parse(f.CoverImageURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: coverImageUrl must be http or https", ErrInvalidQuestionSet)
+		}
+	}
+	return nil
+}
+
+// QuestionSetInfo 問題集テーブルのレコード
+type QuestionSetInfo struct {
+	ID     int    `json:"id" gorm:"column:id;primaryKey"`
+	UserID string `json:"userId" gorm:"column:user_id"`
+	QuestionSetFields
+	// 現在のリビジョン（作成・修正・復元のたびに1ずつ増える）
+	Revision int `json:"revision" gorm:"column:revision"`
+	// 限定公開の共有トークン（作成者にのみ返す。限定公開にしたことがない場合は空文字）
+	ShareToken string `json:"shareToken,omitempty" gorm:"column:share_token"`
+	// ジャンル名（取得時のみ）
+	GenreName string    `json:"genreName" gorm:"column:genre_name;->"`
+	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"column:updated_at"`
+}
+
+// テーブル名を指定
+func (QuestionSetInfo) TableName() string {
+	return "online_learning_question_sets"
+}
+
+// GetQuestionSetInfo 問題集のタイトル・説明などを取得する（閲覧できる問題集のみ）
+func (q QuestionService) GetQuestionSetInfo(userID string, questionSetID int) (*QuestionSetInfo, error) {
+	if err := q.AuthorizeQuestionSet(userID, questionSetID, AccessRead); err != nil {
+		return nil, err
+	}
+	info, err := q.Repo.GetQuestionSetInfo(questionSetID)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, ErrQuestionSetNotFound
+	}
+	if info.UserID != userID {
+		info.ShareToken = ""
+	}
+	return info, nil
+}
@@ -0,0 +1,240 @@
+package question
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// 問題の種類
+const (
+	QuestionTypeSingleChoice = "single_choice" // N択（正解は1つ）
+	QuestionTypeMultiSelect  = "multi_select"  // 複数選択（正解をすべて選ぶ）
+	QuestionTypeTrueFalse    = "true_false"    // ○×
+	QuestionTypeFreeText     = "free_text"     // 記述（許容する回答のいずれかと一致すれば正解）
+	QuestionTypeNumeric      = "numeric"       // 数値（許容誤差の範囲内なら正解）
+	QuestionTypeOrdering     = "ordering"      // 並べ替え（正しい順番に並べる）
+	QuestionTypeTemplate     = "template"      // テンプレート（アテンプトごとに値を変え、計算式の結果と比べる）
+)
+
+// ErrInvalidQuestion は問題の種類に対して正解・選択肢の指定が正しくない場合に返す（ハンドラーで400にする）
+var ErrInvalidQuestion = errors.New("invalid question")
+
+// maxQuestionPoints 1問の配点の上限
+const maxQuestionPoints = 100
+
+// pointsOf は問題の配点を返す（未設定の場合は 1 点）
+func pointsOf(spec QuestionSpec) int {
+	if spec.Points <= 0 {
+		return 1
+	}
+	return spec.Points
+}
+
+// QuestionSpec 問題の種類ごとの設定（questions テーブルの spec 列に JSON で保存する）
+//
+//	single_choice: Options（Answer はその中の1つ）
+//	multi_select:  Options, CorrectOptions
+//	true_false:    なし（Answer は "true" か "false"）
+//	free_text:     AcceptedAnswers（Answer 以外に正解として扱う回答）
+//	numeric:       Tolerance（Answer との差の許容範囲）
+//	ordering:      Options（正しい順番で保存し、出題時にシャッフルする）
+//	template:      Variables, Formula, Tolerance（問題文の {{変数名}} を出題時に値に置き換える）
+type QuestionSpec struct {
+	Options         []string `json:"options,omitempty"`
+	CorrectOptions  []string `json:"correctOptions,omitempty"`
+	AcceptedAnswers []string `json:"acceptedAnswers,omitempty"`
+	Tolerance       float64  `json:"tolerance,omitempty"`
+	// テンプレート問題の変数と正解の計算式
+	Variables []TemplateVariable `json:"variables,omitempty"`
+	Formula   string             `json:"formula,omitempty"`
+	// 配点（0 の場合は 1 点として扱う）
+	Points int `json:"points,omitempty"`
+	// 部分点を与えるか（multi_select は選んだ選択肢、ordering は位置が合っている選択肢の割合で採点する）
+	PartialCredit bool `json:"partialCredit,omitempty"`
+	// 記述式の回答の正規化（nil の場合は初期値の手順ですべて正規化する）
+	Normalization *AnswerNormalization `json:"normalization,omitempty"`
+}
+
+// Value は spec 列に保存する値を返す
+func (s QuestionSpec) Value() (driver.Value, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan は spec 列の値を読み込む（NULL の場合は空の設定）
+func (s *QuestionSpec) Scan(value interface{}) error {
+	*s = QuestionSpec{}
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return fmt.Errorf("unexpected type for question spec: %T", value)
+	}
+}
+
+// AnswerValue ユーザーの回答（文字列、または複数選択・並べ替えの場合は文字列の配列）
+type AnswerValue struct {
+	Values []string
+	IsList bool
+}
+
+// Single は回答を1つの文字列として返す
+func (a AnswerValue) Single() string {
+	if len(a.Values) == 0 {
+		return ""
+	}
+	return a.Values[0]
+}
+
+// UnmarshalJSON は文字列・文字列の配列・数値のいずれも受け付ける
+func (a *AnswerValue) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		a.IsList = true
+		return json.Unmarshal(data, &a.Values)
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		a.Values = []string{s}
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return errors.New("answer must be a string or an array of strings")
+	}
+	a.Values = []string{n.String()}
+	return nil
+}
+
+// MarshalJSON は受け取ったときと同じ形で返す
+func (a AnswerValue) MarshalJSON() ([]byte, error) {
+	if a.IsList {
+		if a.Values == nil {
+			return []byte("[]"), nil
+		}
+		return json.Marshal(a.Values)
+	}
+	return json.Marshal(a.Single())
+}
+
+// normalizeQuestion は問題の種類を補完し、種類に対して正解・選択肢が正しく指定されているかを検証する
+// 種類の指定がない問題は、従来の3択（Answer, Choices1, Choices2）として扱う
+func normalizeQuestion(questionType *string, answer string, choices1, choices2 string, spec *QuestionSpec) error {
+	if *questionType == "" {
+		*questionType = QuestionTypeSingleChoice
+	}
+	if spec.Points < 0 || spec.Points > maxQuestionPoints {
+		return fmt.Errorf("%w: points must be between 0 and %d", ErrInvalidQuestion, maxQuestionPoints)
+	}
+	switch *questionType {
+	case QuestionTypeSingleChoice:
+		if len(spec.Options) == 0 {
+			spec.Options = nonEmpty(answer, choices1, choices2)
+		}
+		if len(spec.Options) < 2 {
+			return fmt.Errorf("%w: single_choice needs at least 2 options", ErrInvalidQuestion)
+		}
+		if !containsString(spec.Options, answer) {
+			return fmt.Errorf("%w: answer must be one of the options", ErrInvalidQuestion)
+		}
+	case QuestionTypeMultiSelect:
+		if len(spec.Options) < 2 {
+			return fmt.Errorf("%w: multi_select needs at least 2 options", ErrInvalidQuestion)
+		}
+		if len(spec.CorrectOptions) == 0 {
+			return fmt.Errorf("%w: multi_select needs correctOptions", ErrInvalidQuestion)
+		}
+		for _, option := range spec.CorrectOptions {
+			if !containsString(spec.Options, option) {
+				return fmt.Errorf("%w: correctOptions must be chosen from options", ErrInvalidQuestion)
+			}
+		}
+	case QuestionTypeTrueFalse:
+		if answer != "true" && answer != "false" {
+			return fmt.Errorf("%w: true_false answer must be \"true\" or \"false\"", ErrInvalidQuestion)
+		}
+	case QuestionTypeFreeText:
+		if answer == "" && len(spec.AcceptedAnswers) == 0 {
+			return fmt.Errorf("%w: free_text needs answer or acceptedAnswers", ErrInvalidQuestion)
+		}
+		if spec.Normalization != nil {
+			if err := spec.Normalization.validate(); err != nil {
+				return err
+			}
+		}
+	case QuestionTypeNumeric:
+		if _, err := strconv.ParseFloat(answer, 64); err != nil {
+			return fmt.Errorf("%w: numeric answer must be a number", ErrInvalidQuestion)
+		}
+		if spec.Tolerance < 0 {
+			return fmt.Errorf("%w: tolerance must not be negative", ErrInvalidQuestion)
+		}
+	case QuestionTypeOrdering:
+		if len(spec.Options) < 2 {
+			return fmt.Errorf("%w: ordering needs at least 2 options", ErrInvalidQuestion)
+		}
+	case QuestionTypeTemplate:
+		if err := validateTemplate(spec); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: unknown question type %q", ErrInvalidQuestion, *questionType)
+	}
+	return nil
+}
+
+// deliveryChoices は回答画面に渡す選択肢を返す（正解がわからないようにシャッフルする）
+func deliveryChoices(question Question) []string {
+	switch question.QuestionType {
+	case QuestionTypeSingleChoice, "":
+		if len(question.Spec.Options) == 0 {
+			return shuffleChoices(question.Answer, question.Choices1, question.Choices2)
+		}
+		return shuffleChoices(question.Spec.Options...)
+	case QuestionTypeMultiSelect, QuestionTypeOrdering:
+		return shuffleChoices(question.Spec.Options...)
+	case QuestionTypeTrueFalse:
+		return []string{"true", "false"}
+	default:
+		return nil
+	}
+}
+
+// publicSpec 回答前のユーザーに見せてもよい設定だけを残した spec を返す
+// 選択肢はシャッフルして返し、正解・許容する回答・テンプレートの変数と計算式・正規化の設定は含めない
+func publicSpec(question Question) QuestionSpec {
+	return QuestionSpec{
+		Options: deliveryChoices(question),
+		Points:  question.Spec.Points,
+	}
+}
+
+func nonEmpty(values ...string) []string {
+	var result []string
+	for _, v := range values {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
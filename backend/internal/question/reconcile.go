@@ -0,0 +1,102 @@
+package question
+
+import (
+	"OnlineLearningWebApp/internal/notification"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 問題集の修正後の進捗の再計算
+// 問題の追加・削除で問題数が変わると、マイ学習リストの進捗率が実態と合わなくなる
+// （新しい問題があるのに completed のまま、削除された問題の正解で100%を超える、など）
+// 修正・復元と同じトランザクションで全ユーザーの進捗を計算し直し、変更内容を通知する
+
+// ProgressChange 再計算の前後のユーザーの進捗
+type ProgressChange struct {
+	UserID         string  `gorm:"column:user_id"`
+	ProgressBefore float64 `gorm:"column:progress_before"`
+	ProgressAfter  float64 `gorm:"column:progress_after"`
+	StatusBefore   string  `gorm:"column:status_before"`
+	StatusAfter    string  `gorm:"column:status_after"`
+}
+
+// reconcileLearners 問題集を修正したリビジョンを保存した後に呼び、学習中のユーザーの進捗を直して通知する
+// 変更内容は直前のリビジョンとの差分から作る
+func reconcileLearners(repo QuestionRepository, revision *QuestionSetRevision) error {
+	changes, err := repo.ReconcileProgress(revision.QuestionSetID)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var added, removed, modified int
+	previous, err := repo.GetQuestionSetRevision(revision.QuestionSetID, revision.Revision-1)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		for _, change := range diffRevisions(previous, revision).Questions {
+			switch change.Change {
+			case ChangeAdded:
+				added++
+			case ChangeRemoved:
+				removed++
+			case ChangeModified:
+				modified++
+			}
+		}
+	}
+	questionsChanged := added+removed+modified > 0
+
+	questionSetID := revision.QuestionSetID
+	now := time.Now()
+	var notifications []notification.WebNotification
+	for _, change := range changes {
+		progressChanged := change.ProgressBefore != change.ProgressAfter || change.StatusBefore != change.StatusAfter
+		// タイトルなどの変更だけで、問題も進捗も変わらない場合は通知しない
+		if !questionsChanged && !progressChanged {
+			continue
+		}
+		notifications = append(notifications, notification.WebNotification{
+			UserID:        change.UserID,
+			Kind:          notification.KindQuestionSetUpdated,
+			QuestionSetID: &questionSetID,
+			Title:         fmt.Sprintf("問題集「%s」が更新されました", revision.Title),
+			Message:       questionSetUpdatedMessage(added, removed, modified, change),
+			CreatedAt:     now,
+		})
+	}
+	return repo.InsertNotifications(notifications)
+}
+
+// questionSetUpdatedMessage 問題集の更新を知らせる通知の本文を作る
+func questionSetUpdatedMessage(added, removed, modified int, change ProgressChange) string {
+	var counts []string
+	if added > 0 {
+		counts = append(counts, fmt.Sprintf("%d問追加", added))
+	}
+	if removed > 0 {
+		counts = append(counts, fmt.Sprintf("%d問削除", removed))
+	}
+	if modified > 0 {
+		counts = append(counts, fmt.Sprintf("%d問修正", modified))
+	}
+
+	var lines []string
+	if len(counts) > 0 {
+		lines = append(lines, "問題が"+strings.Join(counts, "・")+"されました。")
+	}
+	if removed > 0 {
+		lines = append(lines, "削除された問題の正解記録は進捗から除きました。")
+	}
+	if change.ProgressBefore != change.ProgressAfter {
+		lines = append(lines, fmt.Sprintf("進捗率が %.1f%% から %.1f%% になりました。", change.ProgressBefore, change.ProgressAfter))
+	}
+	if change.StatusBefore == "completed" && change.StatusAfter != "completed" {
+		lines = append(lines, "まだ正解していない問題があるため、学習状況を「学習中」に戻しました。")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,62 @@
+package question
+
+import "testing"
+
+func TestQuestionSetUpdatedMessage(t *testing.T) {
+	unchanged := ProgressChange{ProgressBefore: 50, ProgressAfter: 50, StatusBefore: "learning", StatusAfter: "learning"}
+	tests := []struct {
+		name                     string
+		added, removed, modified int
+		change                   ProgressChange
+		want                     string
+	}{
+		{
+			name:   "added questions",
+			added:  2,
+			change: ProgressChange{ProgressBefore: 100, ProgressAfter: 80, StatusBefore: "completed", StatusAfter: "learning"},
+			want: "問題が2問追加されました。\n" +
+				"進捗率が 100.0% から 80.0% になりました。\n" +
+				"まだ正解していない問題があるため、学習状況を「学習中」に戻しました。",
+		},
+		{
+			name:    "removed questions",
+			removed: 1,
+			change:  ProgressChange{ProgressBefore: 50, ProgressAfter: 33.3333, StatusBefore: "learning", StatusAfter: "learning"},
+			want: "問題が1問削除されました。\n" +
+				"削除された問題の正解記録は進捗から除きました。\n" +
+				"進捗率が 50.0% から 33.3% になりました。",
+		},
+		{
+			name:     "all kinds of changes",
+			added:    1,
+			removed:  2,
+			modified: 3,
+			change:   unchanged,
+			want: "問題が1問追加・2問削除・3問修正されました。\n" +
+				"削除された問題の正解記録は進捗から除きました。",
+		},
+		{
+			name:     "modified only",
+			modified: 1,
+			change:   unchanged,
+			want:     "問題が1問修正されました。",
+		},
+		{
+			name:   "progress only",
+			change: ProgressChange{ProgressBefore: 120, ProgressAfter: 100, StatusBefore: "completed", StatusAfter: "completed"},
+			want:   "進捗率が 120.0% から 100.0% になりました。",
+		},
+		{
+			name:   "nothing changed",
+			change: unchanged,
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := questionSetUpdatedMessage(tt.added, tt.removed, tt.modified, tt.change); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package question
 
 import (
+	"OnlineLearningWebApp/internal/notification"
+	"database/sql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"strings"
@@ -13,6 +15,8 @@ type QuestionRepository interface {
 	CountIsRegistered(userId string, questionSetId int) (int64, error)
 	InsertCorrectAnswers([]map[string]interface{}) error
 	UpdateProgress(userId string, questionSetId int) error
+	ReconcileProgress(questionSetID int) ([]ProgressChange, error)
+	InsertNotifications(notifications []notification.WebNotification) error
 	ChangeStatusToInProgress(userId string, questionSetId int) error
 	GetAllGenres() ([]Genre, error)
 	GetQuestionsByQuestionSetId(questionSetId int) ([]QuestionSetResponse, error)
@@ -26,7 +30,20 @@ type QuestionRepository interface {
 	GetQuestionIdsByQuestionSetId(questionSetId int) ([]int, error)
 	GetNextSetID() (int, error)
 	InsertQuestionSet(questionSet []QuestionSet) error
-	FixQuestionSet(questionSet []QuestionSet) error
+	InsertQuestionSetInfo(info *QuestionSetInfo) error
+	UpdateQuestionSetInfo(questionSetID int, fields QuestionSetFields, updatedAt time.Time) error
+	GetQuestionSetInfo(questionSetID int) (*QuestionSetInfo, error)
+	DeleteQuestionSetInfo(questionSetID int) error
+	UpdateShareToken(questionSetID int, token string) error
+	GetUnlistedQuestionSetIDByShareToken(token string) (int, error)
+	InsertQuestionSetShare(questionSetID int, userID string) error
+	GetDueScheduledQuestionSetIDs(now time.Time) ([]int, error)
+	PublishScheduledQuestionSet(questionSetID int, now time.Time) (bool, error)
+	IncrementQuestionSetRevision(questionSetID int) (int, error)
+	GetQuestionsForRevision(questionSetID int) ([]RevisionQuestion, error)
+	InsertQuestionSetRevision(revision *QuestionSetRevision) error
+	GetQuestionSetRevisions(questionSetID int) ([]QuestionSetRevisionSummary, error)
+	GetQuestionSetRevision(questionSetID, revision int) (*QuestionSetRevision, error)
 	DeleteQuestionsByIds(ids []int) error
 	DeleteQuestionSetByIds(ids []int) error
 	InsertStar(star Star) error
@@ -42,14 +59,44 @@ type QuestionRepository interface {
 	InsertFavoriteQuestion(userID string, questionSetID int) error
 	DeleteFavoriteQuestion(userID string, questionSetID int) error
 	IsQuestionWriter(userId string, questionSetId int) (bool, error)
+	GetQuestionSetOwner(questionSetId int) (string, error)
+	GetQuestionSetAccessInfo(questionSetId int, userID string) (*QuestionSetAccessInfo, error)
+	GetQuestionSetIdsByQuestionIds(questionIds []int) (map[int]int, error)
 
 	GetMyQuestionList(userId, title, status string, genreId, offset, limit int) ([]MyQuestionForShow, int64, error)
 	GetMyCreatedQuestionList(userId, title, visibility string, genreId, offset, limit int) ([]MyCreatedQuestionForShow, int64, error)
 	SearchQuestions(title string, visibility string, genreID int, userID string, offset int, limit int) ([]SearchQuestionResponse, int64, error)
 	SearchFavoriteQuestions(title string, visibility string, genreID int, userID string, offset int, limit int) ([]FavoriteQuestionResponse, int64, error)
 
-	// ここでトランザクションを実行するためのメソッドを追加
-	Transaction(fn func(tx *gorm.DB) error) error
+	CreateAttempt(attempt *Attempt, responses []AttemptResponse) error
+	GetAttempt(attemptID string) (*Attempt, error)
+	GetAttemptForUpdate(attemptID string) (*Attempt, error)
+	GetAttemptResponses(attemptID string) ([]AttemptResponse, error)
+	SaveAttemptResponses(responses []AttemptResponse) error
+	SaveDraftResponses(responses []AttemptResponse) error
+	GetActiveAttempt(userID string, questionSetID int, kind string, startedAfter time.Time) (*Attempt, error)
+	ExpireAttempts(startedBefore, deadlineBefore, now time.Time) (int64, error)
+	FinalizeAttempt(attempt *Attempt) error
+	GetAttempts(userID string, questionSetID, offset, limit int) ([]AttemptSummary, int64, error)
+	GetReviewStates(userID string, questionIDs []int) (map[int]ReviewState, error)
+	SaveReviewStates(states []ReviewState) error
+	GetDueReviewQuestionIds(userID string, dueBefore time.Time, limit int) ([]int, error)
+	GetMissedQuestionIds(userID string, scope MistakeScope, limit int) ([]int, error)
+	GetQuestionExplanations(questionIDs []int) (map[int]QuestionExplanation, error)
+	IncrementHintsUsed(attemptID string, questionID int) error
+	GetCalibrationStats(userID string, genreID int) ([]CalibrationStat, error)
+	GetQuestionStatsByGenre(userID string, genreID int) ([]QuestionStat, error)
+	CreateMockExam(exam *MockExam) error
+	GetMockExam(attemptID string) (*MockExam, error)
+	GetMockExamsBySeed(userID string, seed int64) ([]MockExam, error)
+	GetGenreScores(attemptID string) ([]GenreScore, error)
+	GetQuestionSetSettings(questionSetID int) (*QuestionSetSettings, error)
+	SaveQuestionSetSettings(settings *QuestionSetSettings) error
+	DeleteQuestionSetSettings(questionSetID int) error
+
+	// Transaction はトランザクションを開始し、そのトランザクションに紐づいたリポジトリを fn に渡す
+	// fn の中では必ず引数のリポジトリを使うこと（fn がエラーを返すとロールバックされる）
+	Transaction(fn func(repo QuestionRepository) error) error
 }
 
 type GormRepository struct {
@@ -60,7 +107,7 @@ func (r *GormRepository) GetAnswersByIds(ids []int) ([]IDAnswer, error) {
 	// DBから該当する問題の正解を取得
 	var answers []IDAnswer
 	if err := r.DB.Table("online_learning_questions").
-		Select("id, answer").
+		Select("id, answer, question_type, spec, hint_penalty").
 		Where("id IN (?)", ids).
 		Find(&answers).Error; err != nil {
 		return nil, err
@@ -95,28 +142,31 @@ func (r *GormRepository) InsertCorrectAnswers(answers []map[string]interface{})
 	return nil
 }
 
+// progressExpr マイ学習リスト（mq）の進捗率を計算するSQL
+// 進捗率 = 正解した問題数 / 目標の問題数（問題プールの場合は1回に出題する問題数、それ以外は問題集の問題数）
+const progressExpr = `LEAST(
+				(SELECT COUNT(*) FROM online_learning_correct_answers ca
+				 WHERE ca.user_id = mq.user_id AND ca.question_set_id = mq.question_set_id
+				)::float /
+				COALESCE(NULLIF(LEAST(
+					(SELECT s.draw_count FROM online_learning_question_set_settings s
+					 WHERE s.question_set_id = mq.question_set_id),
+					(SELECT COUNT(*) FROM online_learning_question_set qs
+					 WHERE qs.set_id = mq.question_set_id)
+				), 0),
+					(SELECT COUNT(*) FROM online_learning_question_set qs
+					 WHERE qs.set_id = mq.question_set_id)
+				) * 100,
+				100)`
+
 func (r *GormRepository) UpdateProgress(userId string, questionSetId int) error {
 	err := r.DB.Exec(`
 			UPDATE online_learning_my_questions mq
-			SET progress = (
-				(SELECT COUNT(*) FROM online_learning_correct_answers ca 
-				 WHERE ca.user_id = mq.user_id AND ca.question_set_id = mq.question_set_id
-				)::float /
-				(SELECT COUNT(*) FROM online_learning_question_set qs 
-				 WHERE qs.set_id = mq.question_set_id
-				) * 100
-			),
+			SET progress = `+progressExpr+`,
 				attempts = attempts + 1,
 				last_updated_at = now(),
 				status = CASE
-					WHEN (
-						(SELECT COUNT(*) FROM online_learning_correct_answers ca 
-						 WHERE ca.user_id = mq.user_id AND ca.question_set_id = mq.question_set_id
-						)::float /
-						(SELECT COUNT(*) FROM online_learning_question_set qs 
-						 WHERE qs.set_id = mq.question_set_id
-						) * 100
-					) = 100 THEN 'completed'
+					WHEN `+progressExpr+` >= 100 THEN 'completed'
 					ELSE status
 				END
 			WHERE  mq.user_id = ? AND mq.question_set_id = ?
@@ -127,6 +177,52 @@ func (r *GormRepository) UpdateProgress(userId string, questionSetId int) error
 	return nil
 }
 
+// ReconcileProgress は問題集の問題が変わった後に、マイ学習リストに追加しているすべてのユーザーの進捗を計算し直す
+// 問題集から削除された問題の正解記録を削除し、進捗率が100%未満になった completed は in_progress に戻す
+// 回答回数・最終更新日時（学習した日時）は変えない。ユーザーごとの変更前後の進捗を返す
+func (r *GormRepository) ReconcileProgress(questionSetID int) ([]ProgressChange, error) {
+	if err := r.DB.Exec(`
+			DELETE FROM online_learning_correct_answers ca
+			WHERE ca.question_set_id = ?
+			  AND NOT EXISTS (
+				SELECT 1 FROM online_learning_question_set qs
+				WHERE qs.set_id = ca.question_set_id AND qs.question_id = ca.question_id
+			  )
+			`, questionSetID).Error; err != nil {
+		return nil, err
+	}
+
+	var changes []ProgressChange
+	err := r.DB.Raw(`
+			UPDATE online_learning_my_questions mq
+			SET progress = `+progressExpr+`,
+				status = CASE
+					WHEN `+progressExpr+` >= 100 THEN 'completed'
+					WHEN mq.status = 'completed' THEN 'in_progress'
+					ELSE mq.status
+				END
+			FROM (
+				SELECT user_id, progress, status FROM online_learning_my_questions
+				WHERE question_set_id = ?
+			) old
+			WHERE mq.question_set_id = ? AND mq.user_id = old.user_id
+			RETURNING mq.user_id, old.progress AS progress_before, mq.progress AS progress_after,
+				old.status AS status_before, mq.status AS status_after
+			`, questionSetID, questionSetID).Scan(&changes).Error
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// InsertNotifications は通知を登録する
+func (r *GormRepository) InsertNotifications(notifications []notification.WebNotification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	return r.DB.Create(&notifications).Error
+}
+
 func (r *GormRepository) ChangeStatusToInProgress(userId string, questionSetId int) error {
 	err := r.DB.Table("online_learning_my_questions").
 		Where("user_id = ? AND question_set_id = ? AND status = ?", userId, questionSetId, "not_started").
@@ -148,8 +244,9 @@ func (r *GormRepository) GetAllGenres() ([]Genre, error) {
 func (r *GormRepository) GetQuestionsByQuestionSetId(questionSetId int) ([]QuestionSetResponse, error) {
 	var questionSetResponse []QuestionSetResponse
 	err := r.DB.Table("online_learning_questions as q").
-		Select("q.id, q.title, q.question, q.answer, q.choices1, q.choices2, g.name as genre_name").
+		Select("q.id, st.title, q.question, g.name as genre_name").
 		Joins("JOIN online_learning_question_set qs on qs.question_id = q.id").
+		Joins("JOIN online_learning_question_sets st on st.id = qs.set_id").
 		Joins("JOIN online_learning_genres g on g.id = q.genre_id").
 		Where("qs.set_id = ?", questionSetId).
 		Order("q.id ASC").
@@ -163,10 +260,12 @@ func (r *GormRepository) GetQuestionsByQuestionSetId(questionSetId int) ([]Quest
 func (r *GormRepository) GetQuestionsForFixByQuestionSetId(questionSetId int, userId string) ([]QuestionSetForFixResponse, error) {
 	var questionSetForFixResponse []QuestionSetForFixResponse
 	err := r.DB.Table("online_learning_questions as q").
-		Select("q.id, q.title, q.question, q.answer, q.choices1, q.choices2, q.genre_id, q.visibility").
+		Select("q.id, st.title, q.question, q.answer, q.choices1, q.choices2, q.genre_id, st.visibility, q.question_type, q.spec, "+
+			"q.explanation, q.reference_links, q.hints, q.hint_penalty").
 		Joins("JOIN online_learning_question_set qs on qs.question_id = q.id").
+		Joins("JOIN online_learning_question_sets st on st.id = qs.set_id").
 		Where("qs.set_id = ?", questionSetId).
-		Where("q.user_id = ?", userId).
+		Where("st.user_id = ?", userId).
 		Order("q.id ASC").
 		Find(&questionSetForFixResponse).Error
 	if err != nil {
@@ -206,8 +305,10 @@ func (r *GormRepository) InsertMyQuestion(myQuestion MyQuestion) error {
 func (r *GormRepository) GetQuestionsByIds(ids []int) ([]Question, error) {
 	var questions []Question
 	err := r.DB.Table("online_learning_questions as q").
-		Select("q.id, q.title, q.question,g.name as genre_name, q.answer, q.choices1, q.choices2").
+		Select("q.id, q.user_id, st.title, st.visibility, q.question,g.name as genre_name, q.answer, q.choices1, q.choices2, q.question_type, q.spec, jsonb_array_length(q.hints) AS hint_count").
 		Joins("join online_learning_genres g on q.genre_id = g.id").
+		Joins("join online_learning_question_set qs on qs.question_id = q.id").
+		Joins("join online_learning_question_sets st on st.id = qs.set_id").
 		Where("q.id IN ?", ids).Find(&questions).Error
 	if err != nil {
 		return nil, err
@@ -225,8 +326,10 @@ func (r *GormRepository) InsertQuestions(questions []InsertQuestion) error {
 func (r *GormRepository) FixQuestions(questions []FixQuestion) error {
 	return r.DB.Transaction(func(tx *gorm.DB) error {
 		for _, q := range questions {
-			if err := r.DB.Table("online_learning_questions").
+			// 空にした項目（解説など）も反映するため、すべての列を更新する
+			if err := tx.Table("online_learning_questions").
 				Where("id = ?", q.ID).
+				Select("*").Omit("id").
 				Updates(q).Error; err != nil {
 				return err
 			}
@@ -247,15 +350,16 @@ func (r *GormRepository) GetQuestionIdsByQuestionSetId(questionSetId int) ([]int
 	return ids, nil
 }
 
-// `set_id` の取得（同時リクエストでも競合しないようにトランザクション内で管理）
+// `set_id` の取得（シーケンスから採番するので、同時リクエストでも同じIDにならない）
+// 採番したIDはトランザクションがロールバックされても再利用されない（欠番になる）
 func (r *GormRepository) GetNextSetID() (int, error) {
-	var lastSetID int
-	err := r.DB.Raw("SELECT COALESCE(MAX(set_id), 0) + 1 FROM online_learning_question_set").Scan(&lastSetID).Error
+	var nextSetID int
+	err := r.DB.Raw("SELECT nextval('online_learning_question_sets_id_seq')").Scan(&nextSetID).Error
 	if err != nil {
 		return 0, err
 	}
 
-	return lastSetID, nil
+	return nextSetID, nil
 }
 
 func (r *GormRepository) InsertQuestionSet(questionSet []QuestionSet) error {
@@ -265,20 +369,165 @@ func (r *GormRepository) InsertQuestionSet(questionSet []QuestionSet) error {
 	return nil
 }
 
-func (r *GormRepository) FixQuestionSet(questionSet []QuestionSet) error {
-	return r.DB.Transaction(func(tx *gorm.DB) error {
-		for _, qs := range questionSet {
-			if err := r.DB.Table("online_learning_question_set").
-				Where("question_id = ?", qs.QuestionID).
-				Updates(QuestionSet{
-					SetID:   qs.SetID,
-					GenreID: qs.GenreID,
-				}).Error; err != nil {
-				return err
-			}
-		}
-		return nil
-	})
+// InsertQuestionSetInfo は問題集を登録する（id は GetNextSetID で取得したもの）
+func (r *GormRepository) InsertQuestionSetInfo(info *QuestionSetInfo) error {
+	return r.DB.Create(info).Error
+}
+
+// UpdateQuestionSetInfo は問題集のタイトル・説明などを更新する（空にした項目も反映する）
+func (r *GormRepository) UpdateQuestionSetInfo(questionSetID int, fields QuestionSetFields, updatedAt time.Time) error {
+	return r.DB.Model(&QuestionSetInfo{}).
+		Where("id = ?", questionSetID).
+		Updates(map[string]interface{}{
+			"title":           fields.Title,
+			"description":     fields.Description,
+			"genre_id":        fields.GenreID,
+			"visibility":      fields.Visibility,
+			"language":        fields.Language,
+			"difficulty":      fields.Difficulty,
+			"cover_image_url": fields.CoverImageURL,
+			"publish_at":      fields.PublishAt,
+			"updated_at":      updatedAt,
+		}).Error
+}
+
+// UpdateShareToken は限定公開の共有トークンを設定する
+func (r *GormRepository) UpdateShareToken(questionSetID int, token string) error {
+	return r.DB.Model(&QuestionSetInfo{}).
+		Where("id = ?", questionSetID).
+		Update("share_token", token).Error
+}
+
+// GetUnlistedQuestionSetIDByShareToken は共有トークンに対応する限定公開の問題集IDを返す（存在しない場合は 0）
+func (r *GormRepository) GetUnlistedQuestionSetIDByShareToken(token string) (int, error) {
+	var ids []int
+	if err := r.DB.Model(&QuestionSetInfo{}).
+		Where("share_token = ? AND visibility = ?", token, VisibilityUnlisted).
+		Limit(1).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return ids[0], nil
+}
+
+// InsertQuestionSetShare は共有トークンを開いたユーザーを記録する（記録済みの場合は何もしない）
+func (r *GormRepository) InsertQuestionSetShare(questionSetID int, userID string) error {
+	return r.DB.Exec(
+		"INSERT INTO online_learning_question_set_shares (question_set_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+		questionSetID, userID,
+	).Error
+}
+
+// GetDueScheduledQuestionSetIDs は公開予約の日時が now を過ぎた問題集IDを取得する
+func (r *GormRepository) GetDueScheduledQuestionSetIDs(now time.Time) ([]int, error) {
+	var ids []int
+	if err := r.DB.Model(&QuestionSetInfo{}).
+		Where("visibility = ? AND publish_at <= ?", VisibilityScheduled, now).
+		Order("publish_at ASC, id ASC").
+		Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// PublishScheduledQuestionSet は公開予約の日時が now を過ぎた問題集を公開する（公開した場合は true）
+// 公開予約が取り消された・日時が変更された問題集は公開しない
+func (r *GormRepository) PublishScheduledQuestionSet(questionSetID int, now time.Time) (bool, error) {
+	result := r.DB.Model(&QuestionSetInfo{}).
+		Where("id = ? AND visibility = ? AND publish_at <= ?", questionSetID, VisibilityScheduled, now).
+		Updates(map[string]interface{}{
+			"visibility": VisibilityPublic,
+			"publish_at": nil,
+			"updated_at": now,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetQuestionSetInfo は問題集をジャンル名とあわせて取得する（存在しない場合は nil）
+func (r *GormRepository) GetQuestionSetInfo(questionSetID int) (*QuestionSetInfo, error) {
+	var infos []QuestionSetInfo
+	if err := r.DB.Table("online_learning_question_sets st").
+		Select("st.*, g.name AS genre_name").
+		Joins("JOIN online_learning_genres g ON g.id = st.genre_id").
+		Where("st.id = ?", questionSetID).
+		Limit(1).
+		Find(&infos).Error; err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, nil
+	}
+	return &infos[0], nil
+}
+
+// DeleteQuestionSetInfo は問題集を削除する
+func (r *GormRepository) DeleteQuestionSetInfo(questionSetID int) error {
+	return r.DB.Where("id = ?", questionSetID).Delete(&QuestionSetInfo{}).Error
+}
+
+// IncrementQuestionSetRevision は問題集のリビジョン番号を1つ進め、新しい番号を返す
+func (r *GormRepository) IncrementQuestionSetRevision(questionSetID int) (int, error) {
+	var revisions []int
+	if err := r.DB.Raw(
+		"UPDATE online_learning_question_sets SET revision = revision + 1 WHERE id = ? RETURNING revision",
+		questionSetID,
+	).Scan(&revisions).Error; err != nil {
+		return 0, err
+	}
+	if len(revisions) == 0 {
+		return 0, ErrQuestionSetNotFound
+	}
+	return revisions[0], nil
+}
+
+// GetQuestionsForRevision は問題集の問題を、リビジョンに保存する列だけ ID 順に取得する
+func (r *GormRepository) GetQuestionsForRevision(questionSetID int) ([]RevisionQuestion, error) {
+	var questions []RevisionQuestion
+	if err := r.DB.Table("online_learning_questions q").
+		Select("q.id, q.genre_id, q.question, q.answer, q.choices1, q.choices2, q.question_type, q.spec, "+
+			"q.explanation, q.reference_links, q.hints, q.hint_penalty").
+		Joins("JOIN online_learning_question_set qs ON qs.question_id = q.id").
+		Where("qs.set_id = ?", questionSetID).
+		Order("q.id").
+		Find(&questions).Error; err != nil {
+		return nil, err
+	}
+	return questions, nil
+}
+
+// InsertQuestionSetRevision はリビジョンを保存する
+func (r *GormRepository) InsertQuestionSetRevision(revision *QuestionSetRevision) error {
+	return r.DB.Create(revision).Error
+}
+
+// GetQuestionSetRevisions は問題集のリビジョンの一覧を新しい順に取得する
+func (r *GormRepository) GetQuestionSetRevisions(questionSetID int) ([]QuestionSetRevisionSummary, error) {
+	var revisions []QuestionSetRevisionSummary
+	if err := r.DB.Table("online_learning_question_set_revisions").
+		Select("revision, title, jsonb_array_length(questions) AS question_count, created_by, restored_from, created_at").
+		Where("question_set_id = ?", questionSetID).
+		Order("revision DESC").
+		Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// GetQuestionSetRevision はリビジョンを取得する（存在しない場合は nil）
+func (r *GormRepository) GetQuestionSetRevision(questionSetID, revision int) (*QuestionSetRevision, error) {
+	var revisions []QuestionSetRevision
+	if err := r.DB.Where("question_set_id = ? AND revision = ?", questionSetID, revision).
+		Limit(1).
+		Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		return nil, nil
+	}
+	return &revisions[0], nil
 }
 
 func (r *GormRepository) InsertStar(star Star) error {
@@ -299,8 +548,12 @@ func (r *GormRepository) InsertMyStar(userID string, questionSetID, rating int)
 	return nil
 }
 
-func (r *GormRepository) Transaction(fn func(tx *gorm.DB) error) error {
-	return r.DB.Transaction(fn)
+// Transaction は r.DB 上でトランザクションを開始し、tx に紐づいた GormRepository を fn に渡す
+// すでにトランザクション内のリポジトリから呼ばれた場合は、GORM がセーブポイントとして扱う
+func (r *GormRepository) Transaction(fn func(repo QuestionRepository) error) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		return fn(&GormRepository{DB: tx})
+	})
 }
 
 // GetStarForUpdate は、指定の questionSetID のスター評価レコードをロック付きで取得します
@@ -347,35 +600,33 @@ func (r *GormRepository) GetMyQuestionList(userID, title, status string, genreId
 
 	// 基本クエリ：一覧データの取得
 	baseQuery := r.DB.Table("online_learning_my_questions as mq").
-		Select("distinct mq.question_set_id, q.title, g.name as genre_name, (select count(*) from online_learning_question_set where set_id = mq.question_set_id) AS total_questions, mq.progress, mq.deadline, mq.status").
-		Joins("JOIN online_learning_question_set qs on qs.set_id = mq.question_set_id").
-		Joins("JOIN online_learning_questions q on qs.question_id = q.id").
-		Joins("JOIN online_learning_genres g on q.genre_id = g.id").
+		Select("mq.question_set_id, st.title, g.name as genre_name, (select count(*) from online_learning_question_set where set_id = mq.question_set_id) AS total_questions, mq.progress, mq.deadline, mq.status").
+		Joins("JOIN online_learning_question_sets st on st.id = mq.question_set_id").
+		Joins("JOIN online_learning_genres g on st.genre_id = g.id").
 		Where("mq.user_id = ?", userID).
 		Order("mq.status DESC, mq.deadline , mq.progress, mq.question_set_id")
 
 	// totalCount を取得するためのサブクエリ
 	var totalCount int64
 	subQuery := r.DB.Table("online_learning_my_questions as mq").
-		Select("distinct mq.question_set_id, q.title, g.name as genre_name, (select count(*) from online_learning_question_set where set_id = mq.question_set_id) AS total_questions, mq.progress, mq.deadline, mq.status").
-		Joins("JOIN online_learning_question_set qs on qs.set_id = mq.question_set_id").
-		Joins("JOIN online_learning_questions q on qs.question_id = q.id").
-		Joins("JOIN online_learning_genres g on q.genre_id = g.id").
+		Select("mq.question_set_id, st.title, g.name as genre_name, (select count(*) from online_learning_question_set where set_id = mq.question_set_id) AS total_questions, mq.progress, mq.deadline, mq.status").
+		Joins("JOIN online_learning_question_sets st on st.id = mq.question_set_id").
+		Joins("JOIN online_learning_genres g on st.genre_id = g.id").
 		Where("mq.user_id = ?", userID)
 
 	// title,status,genreIdの値によってクエリを変更
 	if strings.Trim(title, "") != "" {
 		likeTitle := "%" + title + "%"
-		baseQuery.Where("q.title LIKE ?", likeTitle)
-		subQuery.Where("q.title LIKE ?", likeTitle)
+		baseQuery.Where("st.title LIKE ?", likeTitle)
+		subQuery.Where("st.title LIKE ?", likeTitle)
 	}
 	if status != "all" {
 		baseQuery.Where("mq.status = ?", status)
 		subQuery.Where("mq.status = ?", status)
 	}
 	if genreId != 0 {
-		baseQuery.Where("q.genre_id = ?", genreId)
-		subQuery.Where("q.genre_id = ?", genreId)
+		baseQuery.Where("st.genre_id = ?", genreId)
+		subQuery.Where("st.genre_id = ?", genreId)
 	}
 
 	countQuery := r.DB.Table("(?) as sub", subQuery).Select("COUNT(*)")
@@ -396,34 +647,31 @@ func (r *GormRepository) GetMyCreatedQuestionList(userID, title, visibility stri
 	var resData []MyCreatedQuestionForShow
 
 	// 基本クエリ：一覧データの取得
-	baseQuery := r.DB.Table("online_learning_questions q").
-		Select("DISTINCT ON (qs.set_id) qs.set_id, q.title, g.name as genre_name, q.visibility ,q.created_at, q.updated_at, COUNT(qs.question_id) OVER(PARTITION BY qs.set_id ORDER BY qs.set_id) AS total_questions").
-		Joins("JOIN online_learning_question_set qs on qs.question_id = q.id").
-		Joins("JOIN online_learning_genres g on q.genre_id = g.id").
-		Where("q.user_id = ?", userID).
-		Order("qs.set_id ASC, q.id ASC")
+	baseQuery := r.DB.Table("online_learning_question_sets st").
+		Select("st.id AS set_id, st.title, g.name as genre_name, st.visibility, st.created_at, st.updated_at, (select count(*) from online_learning_question_set where set_id = st.id) AS total_questions").
+		Joins("JOIN online_learning_genres g on st.genre_id = g.id").
+		Where("st.user_id = ?", userID).
+		Order("st.id ASC")
 
 	// totalCount を取得するためのサブクエリ
 	var totalCount int64
-	subQuery := r.DB.Table("online_learning_questions q").
-		Select("DISTINCT ON (qs.set_id) qs.set_id, q.title, g.name as genre_name, q.visibility ,q.created_at, q.updated_at, COUNT(qs.question_id) OVER(PARTITION BY qs.set_id ORDER BY qs.set_id) AS total_questions").
-		Joins("JOIN online_learning_question_set qs on qs.question_id = q.id").
-		Joins("JOIN online_learning_genres g on q.genre_id = g.id").
-		Where("q.user_id = ?", userID)
+	subQuery := r.DB.Table("online_learning_question_sets st").
+		Select("st.id").
+		Where("st.user_id = ?", userID)
 
 	// title,visibility,genreIdの値によってクエリを変更
 	if strings.Trim(title, "") != "" {
 		likeTitle := "%" + title + "%"
-		baseQuery.Where("q.title LIKE ?", likeTitle)
-		subQuery.Where("q.title LIKE ?", likeTitle)
+		baseQuery.Where("st.title LIKE ?", likeTitle)
+		subQuery.Where("st.title LIKE ?", likeTitle)
 	}
 	if visibility != "all" {
-		baseQuery.Where("q.visibility = ?", visibility)
-		subQuery.Where("q.visibility = ?", visibility)
+		baseQuery.Where("st.visibility = ?", visibility)
+		subQuery.Where("st.visibility = ?", visibility)
 	}
 	if genreId != 0 {
-		baseQuery.Where("q.genre_id = ?", genreId)
-		subQuery.Where("q.genre_id = ?", genreId)
+		baseQuery.Where("st.genre_id = ?", genreId)
+		subQuery.Where("st.genre_id = ?", genreId)
 	}
 
 	countQuery := r.DB.Table("(?) as sub", subQuery).Select("COUNT(*)")
@@ -445,46 +693,39 @@ func (r *GormRepository) SearchQuestions(title string, visibility string, genreI
 
 	// 基本となる検索クエリ（データ取得用）
 	baseQuery := r.DB.Table("online_learning_stars as s").
-		Select(`DISTINCT s.question_set_id, q.title, q.genre_id, g.name as genre_name, 
+		Select(`s.question_set_id, st.title, st.genre_id, g.name as genre_name, 
 		         u.name as user_name, s.total_stars, s.avg_star`).
 		//CASE WHEN s.question_set_id = fq.question_set_id THEN 1 ELSE 0 END as is_favorite
-		Joins("JOIN online_learning_question_set qs ON s.question_set_id = qs.set_id").
-		Joins("JOIN online_learning_genres g ON g.id = qs.genre_id").
-		Joins("JOIN online_learning_questions q ON q.id = qs.question_id").
-		Joins("JOIN online_learning_users u ON u.id = q.user_id").
+		Joins("JOIN online_learning_question_sets st ON st.id = s.question_set_id").
+		Joins("JOIN online_learning_genres g ON g.id = st.genre_id").
+		Joins("JOIN online_learning_users u ON u.id = st.user_id").
 		//Joins("LEFT OUTER JOIN online_learning_favorite_questions fq ON fq.question_set_id = s.question_set_id").
-		Where("q.visibility = ? AND q.genre_id = ?", visibility, genreID).
-		Order("s.total_stars DESC, s.avg_star DESC, q.title, s.question_set_id ASC")
+		Where("st.visibility = ? AND st.genre_id = ?", visibility, genreID).
+		Order("s.total_stars DESC, s.avg_star DESC, st.title, s.question_set_id ASC")
 
 	// Title が指定されている場合の部分一致検索
 	if title != "" {
-		baseQuery = baseQuery.Where("q.title LIKE ?", "%"+title+"%")
+		baseQuery = baseQuery.Where("st.title LIKE ?", "%"+title+"%")
 	}
 
-	// Visibility が "private" の場合は、ユーザーIDでフィルタ
-	if visibility == "private" {
-		baseQuery = baseQuery.Where("q.user_id = ?", userID)
+	// 公開（public）以外の問題集は、自分が作成したものだけを検索する（下書き・限定公開・アーカイブなどは他のユーザーに出さない）
+	if visibility != VisibilityPublic {
+		baseQuery = baseQuery.Where("st.user_id = ?", userID)
 	}
 
 	// totalCount を取得するためのサブクエリ
 	var totalCount int64
 	subQuery := r.DB.Table("online_learning_stars as s").
-		Select(`DISTINCT s.question_set_id, q.title, q.genre_id, g.name as genre_name, 
-		         u.name as user_name, s.total_stars, s.avg_star`).
-		//CASE WHEN s.question_set_id = fq.question_set_id THEN 1 ELSE 0 END as is_favorite
-		Joins("JOIN online_learning_question_set qs ON s.question_set_id = qs.set_id").
-		Joins("JOIN online_learning_genres g ON g.id = qs.genre_id").
-		Joins("JOIN online_learning_questions q ON q.id = qs.question_id").
-		Joins("JOIN online_learning_users u ON u.id = q.user_id").
-		//Joins("LEFT OUTER JOIN online_learning_favorite_questions fq ON fq.question_set_id = s.question_set_id").
-		Where("q.visibility = ? AND q.genre_id = ?", visibility, genreID)
+		Select("s.question_set_id").
+		Joins("JOIN online_learning_question_sets st ON st.id = s.question_set_id").
+		Where("st.visibility = ? AND st.genre_id = ?", visibility, genreID)
 
 	if title != "" {
-		subQuery = subQuery.Where("q.title LIKE ?", "%"+title+"%")
+		subQuery = subQuery.Where("st.title LIKE ?", "%"+title+"%")
 	}
 
-	if visibility == "private" {
-		subQuery = subQuery.Where("q.user_id = ?", userID)
+	if visibility != VisibilityPublic {
+		subQuery = subQuery.Where("st.user_id = ?", userID)
 	}
 
 	countQuery := r.DB.Table("(?) as sub", subQuery).Select("COUNT(*)")
@@ -506,41 +747,39 @@ func (r *GormRepository) SearchFavoriteQuestions(title string, visibility string
 
 	// 基本クエリ（データ取得用）
 	baseQuery := r.DB.Table("online_learning_favorite_questions as fq").
-		Select("DISTINCT s.question_set_id, q.title, q.genre_id, g.name as genre_name, u.name as user_name, s.total_stars, s.avg_star").
+		Select("DISTINCT s.question_set_id, st.title, st.genre_id, g.name as genre_name, u.name as user_name, s.total_stars, s.avg_star").
 		Joins("JOIN online_learning_users u ON u.id = fq.user_id").
-		Joins("JOIN online_learning_question_set qs ON qs.set_id = fq.question_set_id").
+		Joins("JOIN online_learning_question_sets st ON st.id = fq.question_set_id").
 		Joins("JOIN online_learning_stars s ON s.question_set_id = fq.question_set_id").
-		Joins("JOIN online_learning_questions q ON q.id = qs.question_id").
-		Joins("JOIN online_learning_genres g ON g.id = qs.genre_id").
-		Where("q.visibility = ? AND q.genre_id = ?", visibility, genreID).
+		Joins("JOIN online_learning_genres g ON g.id = st.genre_id").
+		Where("st.visibility = ? AND st.genre_id = ?", visibility, genreID).
 		Order("s.total_stars DESC, s.avg_star DESC, fq.question_set_id ASC")
 
 	// Title が指定されている場合は部分一致検索を適用
 	if title != "" {
-		baseQuery = baseQuery.Where("q.title LIKE ?", "%"+title+"%")
+		baseQuery = baseQuery.Where("st.title LIKE ?", "%"+title+"%")
 	}
 
-	// Visibility が private の場合は、ユーザーIDによるフィルタを追加
-	if visibility == "private" {
-		baseQuery = baseQuery.Where("q.user_id = ?", userID)
+	// 公開（public）以外の問題集は、自分が作成したものだけを対象にする
+	if visibility != VisibilityPublic {
+		baseQuery = baseQuery.Where("st.user_id = ?", userID)
 	}
 
 	// totalCount を取得するためのサブクエリ
 	var totalCount int64
 	subQuery := r.DB.Table("online_learning_favorite_questions as fq").
-		Select("DISTINCT s.question_set_id, q.title, q.genre_id, g.name as genre_name, u.name as user_name, s.total_stars, s.avg_star").
+		Select("DISTINCT s.question_set_id, st.title, st.genre_id, g.name as genre_name, u.name as user_name, s.total_stars, s.avg_star").
 		Joins("JOIN online_learning_users u ON u.id = fq.user_id").
-		Joins("JOIN online_learning_question_set qs ON qs.set_id = fq.question_set_id").
+		Joins("JOIN online_learning_question_sets st ON st.id = fq.question_set_id").
 		Joins("JOIN online_learning_stars s ON s.question_set_id = fq.question_set_id").
-		Joins("JOIN online_learning_questions q ON q.id = qs.question_id").
-		Joins("JOIN online_learning_genres g ON g.id = qs.genre_id").
-		Where("q.visibility = ? AND q.genre_id = ?", visibility, genreID)
+		Joins("JOIN online_learning_genres g ON g.id = st.genre_id").
+		Where("st.visibility = ? AND st.genre_id = ?", visibility, genreID)
 
 	if title != "" {
-		subQuery = subQuery.Where("q.title LIKE ?", "%"+title+"%")
+		subQuery = subQuery.Where("st.title LIKE ?", "%"+title+"%")
 	}
-	if visibility == "private" {
-		subQuery = subQuery.Where("q.user_id = ?", userID)
+	if visibility != VisibilityPublic {
+		subQuery = subQuery.Where("st.user_id = ?", userID)
 	}
 
 	countQuery := r.DB.Table("(?) as sub", subQuery).Select("COUNT(*)")
@@ -592,17 +831,68 @@ func (r *GormRepository) GetDateByQuestionIds(questionIds []int) (*time.Time, er
 
 func (r *GormRepository) IsQuestionWriter(userId string, questionSetId int) (bool, error) {
 	var judge bool
-	if err := r.DB.Table("online_learning_question_set qs").
+	if err := r.DB.Table("online_learning_question_sets st").
 		Select("CASE WHEN COUNT(*) > 0 THEN 1 ELSE 0 END").
-		Joins("JOIN online_learning_questions q ON qs.question_id = q.id").
-		Where("qs.set_id = ?", questionSetId).
-		Where("q.user_id = ?", userId).
+		Where("st.id = ?", questionSetId).
+		Where("st.user_id = ?", userId).
 		Scan(&judge).Error; err != nil {
 		return false, err
 	}
 	return judge, nil
 }
 
+// GetQuestionSetOwner は問題集の作成者のユーザーIDを返す（問題集が存在しない場合は空文字）
+func (r *GormRepository) GetQuestionSetOwner(questionSetId int) (string, error) {
+	var owners []string
+	if err := r.DB.Table("online_learning_question_sets st").
+		Where("st.id = ?", questionSetId).
+		Limit(1).
+		Pluck("st.user_id", &owners).Error; err != nil {
+		return "", err
+	}
+	if len(owners) == 0 {
+		return "", nil
+	}
+	return owners[0], nil
+}
+
+// GetQuestionSetAccessInfo は問題集の作成者と公開範囲、ユーザーが共有トークンを開いたか・マイ学習リストに追加しているかを返す
+// （問題集が存在しない場合は nil）
+func (r *GormRepository) GetQuestionSetAccessInfo(questionSetId int, userID string) (*QuestionSetAccessInfo, error) {
+	var infos []QuestionSetAccessInfo
+	if err := r.DB.Table("online_learning_question_sets st").
+		Select(`st.id AS set_id, st.user_id, st.visibility,
+			EXISTS (SELECT 1 FROM online_learning_question_set_shares sh
+				WHERE sh.question_set_id = st.id AND sh.user_id = ?) AS shared,
+			EXISTS (SELECT 1 FROM online_learning_my_questions mq
+				WHERE mq.question_set_id = st.id AND mq.user_id = ?) AS registered`, userID, userID).
+		Where("st.id = ?", questionSetId).
+		Limit(1).
+		Find(&infos).Error; err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, nil
+	}
+	return &infos[0], nil
+}
+
+// GetQuestionSetIdsByQuestionIds は問題IDごとに所属する問題集IDを返す（存在しない問題IDは含まれない）
+func (r *GormRepository) GetQuestionSetIdsByQuestionIds(questionIds []int) (map[int]int, error) {
+	var rows []QuestionSet
+	if err := r.DB.Table("online_learning_question_set").
+		Select("question_id, set_id").
+		Where("question_id IN ?", questionIds).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	setIds := make(map[int]int, len(rows))
+	for _, row := range rows {
+		setIds[row.QuestionID] = row.SetID
+	}
+	return setIds, nil
+}
+
 func (r *GormRepository) DeleteStarsByQuestionSetID(questionSetId int) error {
 	if err := r.DB.Table("online_learning_stars").
 		Where("question_set_id = ?", questionSetId).
@@ -627,3 +917,383 @@ func (r *GormRepository) DeleteMyQuestionsByQuestionSetID(questionSetId int) err
 	}
 	return nil
 }
+
+// CreateAttempt はアテンプトと出題した問題を登録する
+func (r *GormRepository) CreateAttempt(attempt *Attempt, responses []AttemptResponse) error {
+	if err := r.DB.Create(attempt).Error; err != nil {
+		return err
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	return r.DB.Create(&responses).Error
+}
+
+// GetAttempt はアテンプトを取得する（存在しない場合は nil）
+func (r *GormRepository) GetAttempt(attemptID string) (*Attempt, error) {
+	var attempts []Attempt
+	if err := r.DB.Where("id = ?", attemptID).Limit(1).Find(&attempts).Error; err != nil {
+		return nil, err
+	}
+	if len(attempts) == 0 {
+		return nil, nil
+	}
+	return &attempts[0], nil
+}
+
+// GetAttemptForUpdate はアテンプトをロック付きで取得する（同じアテンプトの同時提出を防ぐ）
+func (r *GormRepository) GetAttemptForUpdate(attemptID string) (*Attempt, error) {
+	var attempts []Attempt
+	if err := r.DB.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", attemptID).
+		Limit(1).
+		Find(&attempts).Error; err != nil {
+		return nil, err
+	}
+	if len(attempts) == 0 {
+		return nil, nil
+	}
+	return &attempts[0], nil
+}
+
+// GetAttemptResponses はアテンプトで出題した問題と回答を出題順に取得する
+func (r *GormRepository) GetAttemptResponses(attemptID string) ([]AttemptResponse, error) {
+	var responses []AttemptResponse
+	if err := r.DB.Where("attempt_id = ?", attemptID).Order("position ASC").Find(&responses).Error; err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
+
+// SaveAttemptResponses は問題ごとの回答と正誤を記録する
+func (r *GormRepository) SaveAttemptResponses(responses []AttemptResponse) error {
+	for _, response := range responses {
+		if err := r.DB.Model(&AttemptResponse{}).
+			Where("attempt_id = ? AND question_id = ?", response.AttemptID, response.QuestionID).
+			Updates(map[string]interface{}{
+				"user_answer":        response.UserAnswer,
+				"correct_answer":     response.CorrectAnswer,
+				"correct":            response.Correct,
+				"answered_at":        response.AnsweredAt,
+				"normalized_answer":  response.NormalizedAnswer,
+				"confidence":         response.Confidence,
+				"credit":             response.Credit,
+				"earned_points":      response.EarnedPoints,
+				"time_spent_seconds": response.TimeSpentSeconds,
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveDraftResponses は途中保存した回答を記録する（正誤は提出時に記録する）
+func (r *GormRepository) SaveDraftResponses(responses []AttemptResponse) error {
+	for _, response := range responses {
+		if err := r.DB.Model(&AttemptResponse{}).
+			Where("attempt_id = ? AND question_id = ?", response.AttemptID, response.QuestionID).
+			Updates(map[string]interface{}{
+				"user_answer":        response.UserAnswer,
+				"time_spent_seconds": response.TimeSpentSeconds,
+				"confidence":         response.Confidence,
+				"saved_at":           response.SavedAt,
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetActiveAttempt は回答中のアテンプトのうち最後に開始したものを取得する（存在しない場合は nil）
+// kind が空の場合は種類を問わない。startedAfter より前に開始したアテンプトは対象外
+func (r *GormRepository) GetActiveAttempt(userID string, questionSetID int, kind string, startedAfter time.Time) (*Attempt, error) {
+	var attempts []Attempt
+	query := r.DB.Where("user_id = ? AND question_set_id = ? AND status = ? AND started_at > ?",
+		userID, questionSetID, AttemptStatusInProgress, startedAfter)
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if err := query.Order("started_at DESC").Limit(1).Find(&attempts).Error; err != nil {
+		return nil, err
+	}
+	if len(attempts) == 0 {
+		return nil, nil
+	}
+	return &attempts[0], nil
+}
+
+// ExpireAttempts は startedBefore より前に開始したか、締め切りが deadlineBefore より前の回答中のアテンプトを締め切る
+func (r *GormRepository) ExpireAttempts(startedBefore, deadlineBefore, now time.Time) (int64, error) {
+	result := r.DB.Model(&Attempt{}).
+		Where("status = ?", AttemptStatusInProgress).
+		Where("started_at < ? OR deadline_at < ?", startedBefore, deadlineBefore).
+		Updates(map[string]interface{}{
+			"status":       AttemptStatusExpired,
+			"submitted_at": now,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// FinalizeAttempt はアテンプトの状態と得点を更新する
+func (r *GormRepository) FinalizeAttempt(attempt *Attempt) error {
+	return r.DB.Model(&Attempt{}).
+		Where("id = ?", attempt.ID).
+		Updates(map[string]interface{}{
+			"status":           attempt.Status,
+			"correct_count":    attempt.CorrectCount,
+			"earned_points":    attempt.EarnedPoints,
+			"score":            attempt.Score,
+			"pass_threshold":   attempt.PassThreshold,
+			"passed":           attempt.Passed,
+			"submitted_at":     attempt.SubmittedAt,
+			"duration_seconds": attempt.DurationSeconds,
+		}).Error
+}
+
+// GetAttempts はユーザーのアテンプトを新しい順に取得する（questionSetID が 0 の場合はすべての問題集）
+func (r *GormRepository) GetAttempts(userID string, questionSetID, offset, limit int) ([]AttemptSummary, int64, error) {
+	var attempts []AttemptSummary
+
+	baseQuery := r.DB.Table("online_learning_attempts a").
+		Where("a.user_id = ?", userID)
+	if questionSetID != 0 {
+		baseQuery = baseQuery.Where("a.question_set_id = ?", questionSetID)
+	}
+
+	var totalCount int64
+	if err := baseQuery.Session(&gorm.Session{}).Count(&totalCount).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// 問題集のタイトル（削除された問題集は空文字）
+	err := baseQuery.
+		Select(`a.*, COALESCE((SELECT st.title FROM online_learning_question_sets st
+			WHERE st.id = a.question_set_id), '') AS title`).
+		Order("a.started_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&attempts).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return attempts, totalCount, nil
+}
+
+// GetReviewStates は問題ごとの復習状態を取得する（復習状態がない問題は含まれない）
+func (r *GormRepository) GetReviewStates(userID string, questionIDs []int) (map[int]ReviewState, error) {
+	var rows []ReviewState
+	if err := r.DB.Where("user_id = ? AND question_id IN ?", userID, questionIDs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	states := make(map[int]ReviewState, len(rows))
+	for _, row := range rows {
+		states[row.QuestionID] = row
+	}
+	return states, nil
+}
+
+// SaveReviewStates は復習状態を登録・更新する
+func (r *GormRepository) SaveReviewStates(states []ReviewState) error {
+	if len(states) == 0 {
+		return nil
+	}
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "question_id"}},
+		UpdateAll: true,
+	}).Create(&states).Error
+}
+
+// answerableSetCondition は問題集（st）をユーザー（@user）が回答できる条件（canAccessQuestionSet の AccessAnswer と同じルール）
+const answerableSetCondition = `st.visibility <> 'draft' AND (st.visibility = 'public' OR st.user_id = @user
+	OR (st.visibility = 'unlisted' AND EXISTS (SELECT 1 FROM online_learning_question_set_shares sh
+		WHERE sh.question_set_id = st.id AND sh.user_id = @user))
+	OR (st.visibility = 'archived' AND EXISTS (SELECT 1 FROM online_learning_my_questions m
+		WHERE m.question_set_id = st.id AND m.user_id = @user)))`
+
+// GetDueReviewQuestionIds は復習期限が dueBefore より前の問題IDを期限が古い順に取得する
+// マイ学習リストに追加している問題集の、回答できる問題のみ対象にする
+func (r *GormRepository) GetDueReviewQuestionIds(userID string, dueBefore time.Time, limit int) ([]int, error) {
+	var ids []int
+	if err := r.DB.Table("online_learning_review_states rs").
+		Select("rs.question_id").
+		Joins("JOIN online_learning_question_set qs ON qs.question_id = rs.question_id").
+		Joins("JOIN online_learning_question_sets st ON st.id = qs.set_id").
+		Joins("JOIN online_learning_my_questions mq ON mq.question_set_id = qs.set_id AND mq.user_id = rs.user_id").
+		Where("rs.user_id = ? AND rs.due_at < ?", userID, dueBefore).
+		Where(answerableSetCondition, sql.Named("user", userID)).
+		Order("rs.due_at ASC, rs.question_id ASC").
+		Limit(limit).
+		Pluck("rs.question_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetMissedQuestionIds は最後に回答したときに間違えた問題を、最近間違えた順に取得する
+// 回答できない問題（非公開・アーカイブになった他のユーザーの問題など）は含めない
+func (r *GormRepository) GetMissedQuestionIds(userID string, scope MistakeScope, limit int) ([]int, error) {
+	// 問題ごとの最後の回答
+	latest := r.DB.Table("online_learning_attempt_responses r").
+		Select("DISTINCT ON (r.question_id) r.question_id, r.correct, r.answered_at").
+		Joins("JOIN online_learning_attempts a ON a.id = r.attempt_id").
+		Where("a.user_id = ? AND r.answered_at IS NOT NULL", userID).
+		Order("r.question_id, r.answered_at DESC")
+
+	query := r.DB.Table("(?) AS l", latest).
+		Joins("JOIN online_learning_question_set qs ON qs.question_id = l.question_id").
+		Joins("JOIN online_learning_question_sets st ON st.id = qs.set_id").
+		Joins("JOIN online_learning_questions q ON q.id = l.question_id").
+		Where("NOT l.correct").
+		Where(answerableSetCondition, sql.Named("user", userID))
+	switch {
+	case scope.QuestionSetID != 0:
+		query = query.Where("qs.set_id = ?", scope.QuestionSetID)
+	case scope.GenreID != 0:
+		query = query.Where("q.genre_id = ?", scope.GenreID)
+	default:
+		query = query.Joins("JOIN online_learning_my_questions mq ON mq.question_set_id = qs.set_id AND mq.user_id = ?", userID)
+	}
+
+	var ids []int
+	if err := query.Order("l.answered_at DESC, l.question_id ASC").
+		Limit(limit).
+		Pluck("l.question_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetQuestionStatsByGenre はジャンルの問題（回答できる問題集の問題）ごとに、全ユーザーの回答数と正解数を問題ID順に取得する
+func (r *GormRepository) GetQuestionStatsByGenre(userID string, genreID int) ([]QuestionStat, error) {
+	var stats []QuestionStat
+	if err := r.DB.Table("online_learning_questions q").
+		Select("q.id AS question_id, COUNT(r.answered_at) AS answered_count, COUNT(*) FILTER (WHERE r.answered_at IS NOT NULL AND r.correct) AS correct_count").
+		Joins("JOIN online_learning_question_set qs ON qs.question_id = q.id").
+		Joins("JOIN online_learning_question_sets st ON st.id = qs.set_id").
+		Joins("LEFT JOIN online_learning_attempt_responses r ON r.question_id = q.id").
+		Where("q.genre_id = ?", genreID).
+		Where(answerableSetCondition, sql.Named("user", userID)).
+		Group("q.id").
+		Order("q.id ASC").
+		Scan(&stats).Error; err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// CreateMockExam は模擬試験の条件を登録する
+func (r *GormRepository) CreateMockExam(exam *MockExam) error {
+	return r.DB.Create(exam).Error
+}
+
+// GetMockExam は模擬試験の条件を取得する（存在しない場合は nil）
+func (r *GormRepository) GetMockExam(attemptID string) (*MockExam, error) {
+	var exams []MockExam
+	if err := r.DB.Where("attempt_id = ?", attemptID).Limit(1).Find(&exams).Error; err != nil {
+		return nil, err
+	}
+	if len(exams) == 0 {
+		return nil, nil
+	}
+	return &exams[0], nil
+}
+
+// GetMockExamsBySeed はユーザーが同じシードで作った模擬試験を新しい順に取得する
+func (r *GormRepository) GetMockExamsBySeed(userID string, seed int64) ([]MockExam, error) {
+	var exams []MockExam
+	if err := r.DB.Table("online_learning_mock_exams m").
+		Select("m.*").
+		Joins("JOIN online_learning_attempts a ON a.id = m.attempt_id").
+		Where("a.user_id = ? AND m.seed = ?", userID, seed).
+		Order("a.started_at DESC").
+		Scan(&exams).Error; err != nil {
+		return nil, err
+	}
+	return exams, nil
+}
+
+// GetGenreScores はアテンプトで出題した問題の正解数と得点をジャンルごとに集計する
+func (r *GormRepository) GetGenreScores(attemptID string) ([]GenreScore, error) {
+	var scores []GenreScore
+	if err := r.DB.Table("online_learning_attempt_responses r").
+		Select("g.id AS genre_id, g.name AS genre_name, COUNT(*) AS total_questions, COUNT(*) FILTER (WHERE r.correct) AS correct_count, "+
+			"COALESCE(SUM(r.points), 0) AS total_points, COALESCE(SUM(r.earned_points), 0) AS earned_points").
+		Joins("JOIN online_learning_questions q ON q.id = r.question_id").
+		Joins("JOIN online_learning_genres g ON g.id = q.genre_id").
+		Where("r.attempt_id = ?", attemptID).
+		Group("g.id, g.name").
+		Order("g.id ASC").
+		Scan(&scores).Error; err != nil {
+		return nil, err
+	}
+	return scores, nil
+}
+
+// GetQuestionExplanations は問題の解説・参考リンク・ヒントを取得する（問題ID → 解説）
+func (r *GormRepository) GetQuestionExplanations(questionIDs []int) (map[int]QuestionExplanation, error) {
+	var rows []QuestionExplanationRow
+	if err := r.DB.Table("online_learning_questions").
+		Select("id, explanation, reference_links, hints, hint_penalty").
+		Where("id IN ?", questionIDs).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	explanations := make(map[int]QuestionExplanation, len(rows))
+	for _, row := range rows {
+		explanations[row.ID] = row.QuestionExplanation
+	}
+	return explanations, nil
+}
+
+// IncrementHintsUsed はアテンプトの問題で使ったヒントの数を1つ増やす
+func (r *GormRepository) IncrementHintsUsed(attemptID string, questionID int) error {
+	return r.DB.Model(&AttemptResponse{}).
+		Where("attempt_id = ? AND question_id = ?", attemptID, questionID).
+		UpdateColumn("hints_used", gorm.Expr("hints_used + 1")).Error
+}
+
+// GetCalibrationStats は自信度を付けた提出済みの回答を、ジャンル・自信度ごとに集計する（genreID が 0 の場合はすべてのジャンル）
+func (r *GormRepository) GetCalibrationStats(userID string, genreID int) ([]CalibrationStat, error) {
+	query := r.DB.Table("online_learning_attempt_responses r").
+		Select("g.id AS genre_id, g.name AS genre_name, r.confidence, COUNT(*) AS answered_count, COUNT(*) FILTER (WHERE r.correct) AS correct_count").
+		Joins("JOIN online_learning_attempts a ON a.id = r.attempt_id").
+		Joins("JOIN online_learning_questions q ON q.id = r.question_id").
+		Joins("JOIN online_learning_genres g ON g.id = q.genre_id").
+		Where("a.user_id = ? AND r.answered_at IS NOT NULL AND r.confidence <> ''", userID)
+	if genreID != 0 {
+		query = query.Where("q.genre_id = ?", genreID)
+	}
+
+	var stats []CalibrationStat
+	if err := query.Group("g.id, g.name, r.confidence").
+		Order("g.id ASC").
+		Scan(&stats).Error; err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetQuestionSetSettings は問題集の設定を取得する（レコードがない場合は初期値）
+func (r *GormRepository) GetQuestionSetSettings(questionSetID int) (*QuestionSetSettings, error) {
+	var settings []QuestionSetSettings
+	if err := r.DB.Where("question_set_id = ?", questionSetID).Limit(1).Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	if len(settings) == 0 {
+		return &QuestionSetSettings{QuestionSetID: questionSetID}, nil
+	}
+	return &settings[0], nil
+}
+
+// SaveQuestionSetSettings は問題集の設定を登録・更新する
+func (r *GormRepository) SaveQuestionSetSettings(settings *QuestionSetSettings) error {
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "question_set_id"}},
+		UpdateAll: true,
+	}).Create(settings).Error
+}
+
+// DeleteQuestionSetSettings は問題集の設定を削除する
+func (r *GormRepository) DeleteQuestionSetSettings(questionSetID int) error {
+	return r.DB.Where("question_set_id = ?", questionSetID).Delete(&QuestionSetSettings{}).Error
+}
@@ -0,0 +1,352 @@
+package question
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// 問題集のリビジョン履歴
+// 作成・修正・復元のたびに、問題集の項目とすべての問題をまとめて1つのリビジョンとして保存する（保存したリビジョンは変更しない）
+// アテンプトには回答を開始した時点のリビジョンを記録する
+
+// ErrRevisionNotFound は指定したリビジョンが存在しない場合に返す（ハンドラーで404にする）
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// 差分の種類
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// RevisionQuestion リビジョンに保存する問題（questions テーブルの列と同じ）
+type RevisionQuestion struct {
+	ID           int          `json:"id" gorm:"column:id"`
+	GenreID      int          `json:"genreId" gorm:"column:genre_id"`
+	Question     string       `json:"question" gorm:"column:question"`
+	Answer       string       `json:"answer" gorm:"column:answer"`
+	Choices1     string       `json:"choices1" gorm:"column:choices1"`
+	Choices2     string       `json:"choices2" gorm:"column:choices2"`
+	QuestionType string       `json:"questionType" gorm:"column:question_type"`
+	Spec         QuestionSpec `json:"spec" gorm:"column:spec;type:jsonb"`
+	QuestionExplanation
+}
+
+// revisionQuestions リビジョンの問題を jsonb 列に保存する
+type revisionQuestions []RevisionQuestion
+
+// Value は jsonb 列に保存する値を返す
+func (l revisionQuestions) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]RevisionQuestion(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan は jsonb 列の値を読み込む
+func (l *revisionQuestions) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, (*[]RevisionQuestion)(l))
+	case string:
+		return json.Unmarshal([]byte(v), (*[]RevisionQuestion)(l))
+	default:
+		return fmt.Errorf("unexpected type for revision questions: %T", value)
+	}
+}
+
+// QuestionSetRevision 問題集のリビジョン
+type QuestionSetRevision struct {
+	ID            int `json:"-" gorm:"column:id;primaryKey"`
+	QuestionSetID int `json:"questionSetId" gorm:"column:question_set_id"`
+	Revision      int `json:"revision" gorm:"column:revision"`
+	QuestionSetFields
+	Questions revisionQuestions `json:"questions" gorm:"column:questions;type:jsonb"`
+	CreatedBy string            `json:"createdBy" gorm:"column:created_by"`
+	// 復元で作られたリビジョンの場合は、復元元のリビジョン
+	RestoredFrom *int      `json:"restoredFrom,omitempty" gorm:"column:restored_from"`
+	CreatedAt    time.Time `json:"createdAt" gorm:"column:created_at"`
+}
+
+// テーブル名を指定
+func (QuestionSetRevision) TableName() string {
+	return "online_learning_question_set_revisions"
+}
+
+// QuestionSetRevisionSummary リビジョン一覧の1件（問題の内容は含めない）
+type QuestionSetRevisionSummary struct {
+	Revision      int       `json:"revision" gorm:"column:revision"`
+	Title         string    `json:"title" gorm:"column:title"`
+	QuestionCount int       `json:"questionCount" gorm:"column:question_count"`
+	CreatedBy     string    `json:"createdBy" gorm:"column:created_by"`
+	RestoredFrom  *int      `json:"restoredFrom,omitempty" gorm:"column:restored_from"`
+	CreatedAt     time.Time `json:"createdAt" gorm:"column:created_at"`
+}
+
+// RestoreRevisionRequest RestoreQuestionSetRevision のリクエスト
+type RestoreRevisionRequest struct {
+	QuestionSetID int `json:"questionSetId"`
+	Revision      int `json:"revision"`
+}
+
+// FieldChange 問題集の項目の変更
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// QuestionChange 問題の変更（modified の場合は変更された項目の JSON キー）
+type QuestionChange struct {
+	QuestionID int      `json:"questionId"`
+	Change     string   `json:"change"`
+	Fields     []string `json:"fields,omitempty"`
+}
+
+// RevisionDiff 2つのリビジョンの差分
+type RevisionDiff struct {
+	QuestionSetID int              `json:"questionSetId"`
+	From          int              `json:"from"`
+	To            int              `json:"to"`
+	Fields        []FieldChange    `json:"fields"`
+	Questions     []QuestionChange `json:"questions"`
+}
+
+// saveRevision 問題集の現在の内容を新しいリビジョンとして保存する（問題集の作成・修正と同じトランザクションで呼ぶ）
+func saveRevision(repo QuestionRepository, questionSetID int, userID string, restoredFrom *int) (*QuestionSetRevision, error) {
+	// リビジョン番号は問題集の行を更新して採番する（同時に修正された場合も番号が重ならない）
+	number, err := repo.IncrementQuestionSetRevision(questionSetID)
+	if err != nil {
+		return nil, err
+	}
+	info, err := repo.GetQuestionSetInfo(questionSetID)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, ErrQuestionSetNotFound
+	}
+	questions, err := repo.GetQuestionsForRevision(questionSetID)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := &QuestionSetRevision{
+		QuestionSetID:     questionSetID,
+		Revision:          number,
+		QuestionSetFields: info.QuestionSetFields,
+		Questions:         questions,
+		CreatedBy:         userID,
+		RestoredFrom:      restoredFrom,
+		CreatedAt:         time.Now(),
+	}
+	if err := repo.InsertQuestionSetRevision(revision); err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// GetQuestionSetRevisions 問題集のリビジョンの一覧を新しい順に取得する
+// 作成者本人か、canEditAny（モデレーター）の場合のみ取得できる
+func (q QuestionService) GetQuestionSetRevisions(userID string, questionSetID int, canEditAny bool) ([]QuestionSetRevisionSummary, error) {
+	if _, err := q.authorizeQuestionSetEdit(userID, questionSetID, canEditAny); err != nil {
+		return nil, err
+	}
+	return q.Repo.GetQuestionSetRevisions(questionSetID)
+}
+
+// GetQuestionSetRevisionDiff 2つのリビジョンの差分を取得する（from から to への変更）
+// 作成者本人か、canEditAny（モデレーター）の場合のみ取得できる
+func (q QuestionService) GetQuestionSetRevisionDiff(userID string, questionSetID, from, to int, canEditAny bool) (*RevisionDiff, error) {
+	if _, err := q.authorizeQuestionSetEdit(userID, questionSetID, canEditAny); err != nil {
+		return nil, err
+	}
+	fromRevision, err := q.getRevision(questionSetID, from)
+	if err != nil {
+		return nil, err
+	}
+	toRevision, err := q.getRevision(questionSetID, to)
+	if err != nil {
+		return nil, err
+	}
+	return diffRevisions(fromRevision, toRevision), nil
+}
+
+// RestoreQuestionSetRevision 問題集を指定したリビジョンの内容に戻す
+// 古いリビジョンを書き換えるのではなく、その内容で新しいリビジョンを作る（復元も履歴に残る）
+// 公開範囲は復元しない（公開中の問題集が下書きに戻る、などを防ぐ）
+// 作成者本人か、canEditAny（モデレーター）の場合のみ復元できる
+func (q QuestionService) RestoreQuestionSetRevision(userID string, questionSetID, revision int, canEditAny bool) (*QuestionSetRevision, error) {
+	owner, err := q.authorizeQuestionSetEdit(userID, questionSetID, canEditAny)
+	if err != nil {
+		return nil, err
+	}
+	target, err := q.getRevision(questionSetID, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	var restored *QuestionSetRevision
+	err = q.Repo.Transaction(func(repo QuestionRepository) error {
+		// 今も問題集に残っている問題は修正し、その後削除された問題は新しい問題として作り直す
+		currentIDs, err := repo.GetQuestionIdsByQuestionSetId(questionSetID)
+		if err != nil {
+			return err
+		}
+		current := make(map[int]bool, len(currentIDs))
+		for _, id := range currentIDs {
+			current[id] = true
+		}
+		questions := make([]FixQuestion, 0, len(target.Questions))
+		for _, question := range target.Questions {
+			fix := FixQuestion{
+				GenreID:             question.GenreID,
+				Question:            question.Question,
+				Answer:              question.Answer,
+				Choices1:            question.Choices1,
+				Choices2:            question.Choices2,
+				QuestionType:        question.QuestionType,
+				Spec:                question.Spec,
+				QuestionExplanation: question.QuestionExplanation,
+				UpdatedAt:           time.Now(),
+			}
+			if current[question.ID] {
+				id := question.ID
+				fix.ID = &id
+			}
+			questions = append(questions, fix)
+		}
+
+		// 公開範囲（下書き・公開予約などの状態）は復元せず、今の状態のままにする
+		info, err := repo.GetQuestionSetInfo(questionSetID)
+		if err != nil {
+			return err
+		}
+		if info == nil {
+			return ErrQuestionSetNotFound
+		}
+		fields := target.QuestionSetFields
+		fields.Visibility = info.Visibility
+		fields.PublishAt = info.PublishAt
+
+		if err := applyQuestionSetFix(repo, questionSetID, fields, questions, owner); err != nil {
+			return err
+		}
+		restored, err = saveRevision(repo, questionSetID, userID, &target.Revision)
+		if err != nil {
+			return err
+		}
+		return reconcileLearners(repo, restored)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// getRevision リビジョンを取得する（存在しない場合は ErrRevisionNotFound）
+func (q QuestionService) getRevision(questionSetID, revision int) (*QuestionSetRevision, error) {
+	found, err := q.Repo.GetQuestionSetRevision(questionSetID, revision)
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: revision %d", ErrRevisionNotFound, revision)
+	}
+	return found, nil
+}
+
+// diffRevisions 問題集の項目と問題の差分を作る
+// 問題は ID で対応させる（復元で作り直された問題は、削除と追加として扱う）
+func diffRevisions(from, to *QuestionSetRevision) *RevisionDiff {
+	diff := &RevisionDiff{
+		QuestionSetID: to.QuestionSetID,
+		From:          from.Revision,
+		To:            to.Revision,
+		Fields:        []FieldChange{},
+		Questions:     []QuestionChange{},
+	}
+
+	fields := []struct {
+		name     string
+		from, to string
+	}{
+		{"title", from.Title, to.Title},
+		{"description", from.Description, to.Description},
+		{"genreId", fmt.Sprint(from.GenreID), fmt.Sprint(to.GenreID)},
+		{"visibility", from.Visibility, to.Visibility},
+		{"language", from.Language, to.Language},
+		{"difficulty", from.Difficulty, to.Difficulty},
+		{"coverImageUrl", from.CoverImageURL, to.CoverImageURL},
+		{"publishAt", formatPublishAt(from.PublishAt), formatPublishAt(to.PublishAt)},
+	}
+	for _, field := range fields {
+		if field.from != field.to {
+			diff.Fields = append(diff.Fields, FieldChange{Field: field.name, From: field.from, To: field.to})
+		}
+	}
+
+	before := make(map[int]RevisionQuestion, len(from.Questions))
+	for _, question := range from.Questions {
+		before[question.ID] = question
+	}
+	after := make(map[int]bool, len(to.Questions))
+	for _, question := range to.Questions {
+		after[question.ID] = true
+		old, ok := before[question.ID]
+		if !ok {
+			diff.Questions = append(diff.Questions, QuestionChange{QuestionID: question.ID, Change: ChangeAdded})
+			continue
+		}
+		if changed := changedQuestionFields(old, question); len(changed) > 0 {
+			diff.Questions = append(diff.Questions, QuestionChange{QuestionID: question.ID, Change: ChangeModified, Fields: changed})
+		}
+	}
+	for _, question := range from.Questions {
+		if !after[question.ID] {
+			diff.Questions = append(diff.Questions, QuestionChange{QuestionID: question.ID, Change: ChangeRemoved})
+		}
+	}
+	return diff
+}
+
+// formatPublishAt 差分に表示する公開予約の日時（予約していない場合は空文字）
+func formatPublishAt(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// changedQuestionFields 変更された問題の項目を返す
+func changedQuestionFields(from, to RevisionQuestion) []string {
+	var changed []string
+	add := func(name string, equal bool) {
+		if !equal {
+			changed = append(changed, name)
+		}
+	}
+	add("genreId", from.GenreID == to.GenreID)
+	add("question", from.Question == to.Question)
+	add("answer", from.Answer == to.Answer)
+	add("choices1", from.Choices1 == to.Choices1)
+	add("choices2", from.Choices2 == to.Choices2)
+	add("questionType", from.QuestionType == to.QuestionType)
+	add("spec", reflect.DeepEqual(from.Spec, to.Spec))
+	add("explanation", from.Explanation == to.Explanation)
+	add("references", reflect.DeepEqual(from.References, to.References))
+	add("hints", reflect.DeepEqual(from.Hints, to.Hints))
+	add("hintPenalty", from.HintPenalty == to.HintPenalty)
+	return changed
+}
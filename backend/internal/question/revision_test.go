@@ -0,0 +1,87 @@
+package question
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffRevisions(t *testing.T) {
+	base := func() *QuestionSetRevision {
+		return &QuestionSetRevision{
+			QuestionSetID:     1,
+			Revision:          1,
+			QuestionSetFields: QuestionSetFields{Title: "問題集", GenreID: 1, Visibility: VisibilityPublic},
+			Questions: revisionQuestions{
+				{ID: 10, GenreID: 1, Question: "Q1", Answer: "a", Choices1: "b", Choices2: "c"},
+				{ID: 11, GenreID: 1, Question: "Q2", Answer: "a", Choices1: "b", Choices2: "c"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		edit          func(r *QuestionSetRevision)
+		wantFields    []FieldChange
+		wantQuestions []QuestionChange
+	}{
+		{
+			name:          "no changes",
+			edit:          func(r *QuestionSetRevision) {},
+			wantFields:    []FieldChange{},
+			wantQuestions: []QuestionChange{},
+		},
+		{
+			name: "set fields",
+			edit: func(r *QuestionSetRevision) {
+				r.Title = "新しい問題集"
+				r.GenreID = 2
+			},
+			wantFields: []FieldChange{
+				{Field: "title", From: "問題集", To: "新しい問題集"},
+				{Field: "genreId", From: "1", To: "2"},
+			},
+			wantQuestions: []QuestionChange{},
+		},
+		{
+			name: "modified question",
+			edit: func(r *QuestionSetRevision) {
+				r.Questions[0].Question = "Q1 (fixed)"
+				r.Questions[0].Spec = QuestionSpec{Points: 2}
+				r.Questions[0].Hints = stringList{"hint"}
+			},
+			wantFields: []FieldChange{},
+			wantQuestions: []QuestionChange{
+				{QuestionID: 10, Change: ChangeModified, Fields: []string{"question", "spec", "hints"}},
+			},
+		},
+		{
+			name: "added and removed questions",
+			edit: func(r *QuestionSetRevision) {
+				r.Questions = revisionQuestions{r.Questions[1], {ID: 12, GenreID: 1, Question: "Q3"}}
+			},
+			wantFields: []FieldChange{},
+			wantQuestions: []QuestionChange{
+				{QuestionID: 12, Change: ChangeAdded},
+				{QuestionID: 10, Change: ChangeRemoved},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := base(), base()
+			to.Revision = 2
+			tt.edit(to)
+
+			diff := diffRevisions(from, to)
+			if diff.QuestionSetID != 1 || diff.From != 1 || diff.To != 2 {
+				t.Errorf("diff header = %d %d→%d, want 1 1→2", diff.QuestionSetID, diff.From, diff.To)
+			}
+			if !reflect.DeepEqual(diff.Fields, tt.wantFields) {
+				t.Errorf("fields = %+v, want %+v", diff.Fields, tt.wantFields)
+			}
+			if !reflect.DeepEqual(diff.Questions, tt.wantQuestions) {
+				t.Errorf("questions = %+v, want %+v", diff.Questions, tt.wantQuestions)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package question
 
 import (
 	"OnlineLearningWebApp/pkg/middleware"
+	"OnlineLearningWebApp/pkg/rbac"
 	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
@@ -12,55 +13,110 @@ func QuestionRegisterRoutes(e *echo.Echo, db *gorm.DB, rdb *redis.Client) {
 
 	// 認証が必要なルート
 	protected := e.Group("/api")
-	protected.Use(middleware.JWTMiddleware) // JWT認証ミドルウェアを適用（この処理を抜けないと下にはいけない）
+	protected.Use(middleware.JWTMiddleware(rdb)) // JWT認証ミドルウェアを適用（この処理を抜けないと下にはいけない）
+	// 各ルートには必要な権限（RequirePermission）を指定する
+	// 問題集の修正・削除は作成者のみ（PermQuestionEditAny / PermQuestionDeleteAny を持つモデレーターは他人の問題集も可）
+	// 再送で二重に登録されると困る書き込みには Idempotency を付ける（Idempotency-Key ヘッダーがある場合のみ有効）
 
 	questionHandler := NewQuestionHandler(db, rdb)
+	idempotency := middleware.Idempotency(rdb)
 
 	// ジャンル取得API
-	protected.GET("/AllGenres", questionHandler.GetAllGenres)
+	protected.GET("/AllGenres", questionHandler.GetAllGenres, middleware.RequirePermission(rbac.PermQuestionRead))
 
 	// 問題作成API
-	protected.POST("/InsertQuestion", questionHandler.InsertQuestions)
+	protected.POST("/InsertQuestion", questionHandler.InsertQuestions, middleware.RequirePermission(rbac.PermQuestionCreate), idempotency)
 
 	// 問題修正API
-	protected.POST("/FixMyQuestions", questionHandler.FixQuestions)
+	protected.POST("/FixMyQuestions", questionHandler.FixQuestions, middleware.RequirePermission(rbac.PermQuestionCreate, rbac.PermQuestionEditAny), idempotency)
+
+	// 下書きの問題集の自動保存（リクエストは問題修正APIと同じ）
+	protected.POST("/AutosaveQuestionSet", questionHandler.AutosaveQuestionSet, middleware.RequirePermission(rbac.PermQuestionCreate, rbac.PermQuestionEditAny))
+
+	// 限定公開の問題集を共有トークンで開く
+	protected.POST("/OpenSharedQuestionSet", questionHandler.OpenSharedQuestionSet, middleware.RequirePermission(rbac.PermQuestionRead))
 
 	// 問題集検索
-	protected.GET("/SearchQuestions", questionHandler.SearchQuestions)
+	protected.GET("/SearchQuestions", questionHandler.SearchQuestions, middleware.RequirePermission(rbac.PermQuestionRead))
 
 	// QuestionIdsを元に問題集を取得
-	protected.GET("/GetQuestionsByQuestionIds", questionHandler.GetQuestionsByQuestionIds)
+	protected.GET("/GetQuestionsByQuestionIds", questionHandler.GetQuestionsByQuestionIds, middleware.RequirePermission(rbac.PermQuestionRead))
 
 	// 問題集詳細を取得（問題詳細、問題回答用）
-	protected.GET("/GetQuestionSet", questionHandler.GetQuestionSet)
+	protected.GET("/GetQuestionSet", questionHandler.GetQuestionSet, middleware.RequirePermission(rbac.PermQuestionRead))
+
+	// 問題集のタイトル・説明などを取得
+	protected.GET("/GetQuestionSetInfo", questionHandler.GetQuestionSetInfo, middleware.RequirePermission(rbac.PermQuestionRead))
+
+	// 問題集のリビジョン履歴（一覧・差分・復元。作成者のみ）
+	protected.GET("/GetQuestionSetRevisions", questionHandler.GetQuestionSetRevisions, middleware.RequirePermission(rbac.PermQuestionCreate, rbac.PermQuestionEditAny))
+	protected.GET("/GetQuestionSetRevisionDiff", questionHandler.GetQuestionSetRevisionDiff, middleware.RequirePermission(rbac.PermQuestionCreate, rbac.PermQuestionEditAny))
+	protected.POST("/RestoreQuestionSetRevision", questionHandler.RestoreQuestionSetRevision, middleware.RequirePermission(rbac.PermQuestionCreate, rbac.PermQuestionEditAny), idempotency)
 
 	// 問題集詳細を取得（問題集修正用）
-	protected.GET("/GetQuestionSetForFix", questionHandler.GetQuestionSetForFix)
+	protected.GET("/GetQuestionSetForFix", questionHandler.GetQuestionSetForFix, middleware.RequirePermission(rbac.PermQuestionCreate, rbac.PermQuestionEditAny))
+
+	// 問題集回答の開始（正解を含まない問題とアテンプトトークンを返す）
+	protected.POST("/StartAttempt", questionHandler.StartAttempt, middleware.RequirePermission(rbac.PermQuestionAnswer))
+
+	// 復習の開始（今日が復習期限の問題を出題する。提出は SubmitQuestions で question_set_id を省略する）
+	protected.POST("/StartReviewSession", questionHandler.StartReviewSession, middleware.RequirePermission(rbac.PermQuestionAnswer))
+
+	// 試験モードの開始（制限時間を過ぎた提出は受け付けない）
+	protected.POST("/StartExam", questionHandler.StartExam, middleware.RequirePermission(rbac.PermQuestionAnswer))
+
+	// 間違えた問題の練習の開始（question_set_id / genre_id で範囲を指定。省略した場合はマイ学習リスト全体）
+	protected.POST("/StartMistakePractice", questionHandler.StartMistakePractice, middleware.RequirePermission(rbac.PermQuestionAnswer))
+
+	// 模擬試験の開始（ジャンルごとの問題数と難易度を指定する。提出は SubmitQuestions で question_set_id を省略する）
+	protected.POST("/StartMockExam", questionHandler.StartMockExam, middleware.RequirePermission(rbac.PermQuestionAnswer))
+
+	// 模擬試験のジャンル別の得点
+	protected.GET("/GetMockExamReport", questionHandler.GetMockExamReport, middleware.RequirePermission(rbac.PermQuestionAnswer))
+
+	// 問題集の設定（制限時間など）
+	protected.GET("/GetQuestionSetSettings", questionHandler.GetQuestionSetSettings, middleware.RequirePermission(rbac.PermQuestionRead))
+	protected.POST("/UpdateQuestionSetSettings", questionHandler.UpdateQuestionSetSettings, middleware.RequirePermission(rbac.PermQuestionCreate, rbac.PermQuestionEditAny))
+
+	// 回答中のアテンプトの再開（途中保存した回答も返す）
+	protected.GET("/GetActiveAttempt", questionHandler.GetActiveAttempt, middleware.RequirePermission(rbac.PermQuestionAnswer))
+
+	// 回答の途中保存（提出は SubmitQuestions で行う）
+	protected.POST("/SaveDraftAnswers", questionHandler.SaveDraftAnswers, middleware.RequirePermission(rbac.PermQuestionAnswer))
+
+	// 回答中の問題のヒントを1つ表示（使ったヒントの数だけ得点を減らす）
+	protected.POST("/RevealHint", questionHandler.RevealHint, middleware.RequirePermission(rbac.PermQuestionAnswer))
 
 	// 問題集回答の提出
-	protected.POST("/SubmitQuestions", questionHandler.SubmitQuestions)
+	protected.POST("/SubmitQuestions", questionHandler.SubmitQuestions, middleware.RequirePermission(rbac.PermQuestionAnswer), idempotency)
+
+	// 回答結果の取得（過去のアテンプトも取得できる）
+	protected.GET("/GetSubmittedQuestions", questionHandler.GetSubmissionResult, middleware.RequirePermission(rbac.PermQuestionAnswer))
+
+	// 回答履歴の一覧
+	protected.GET("/GetMyAttempts", questionHandler.GetMyAttempts, middleware.RequirePermission(rbac.PermQuestionAnswer))
 
-	// 回答結果の取得（24時間だけ保持）
-	protected.GET("/GetSubmittedQuestions", questionHandler.GetSubmissionResult)
+	// 自信度ごとの正答率（キャリブレーション）
+	protected.GET("/GetCalibrationReport", questionHandler.GetCalibrationReport, middleware.RequirePermission(rbac.PermQuestionAnswer))
 
 	// マイ学習リストに追加
-	protected.POST("/RegisterMyQuestions", questionHandler.RegisterMyQuestions)
+	protected.POST("/RegisterMyQuestions", questionHandler.RegisterMyQuestions, middleware.RequirePermission(rbac.PermQuestionAnswer), idempotency)
 
 	// 問題集削除API
-	protected.POST("/DeleteQuestionSet", questionHandler.DeleteQuestionSet)
+	protected.POST("/DeleteQuestionSet", questionHandler.DeleteQuestionSet, middleware.RequirePermission(rbac.PermQuestionCreate, rbac.PermQuestionDeleteAny))
 
 	// マイ学習リスト表示
-	protected.GET("/GetMyQuestionList", questionHandler.GetMyQuestionList)
+	protected.GET("/GetMyQuestionList", questionHandler.GetMyQuestionList, middleware.RequirePermission(rbac.PermQuestionAnswer))
 
 	// 問題集修正-検索表示
-	protected.GET("/GetMyCreatedQuestionList", questionHandler.GetMyCreatedQuestionList)
+	protected.GET("/GetMyCreatedQuestionList", questionHandler.GetMyCreatedQuestionList, middleware.RequirePermission(rbac.PermQuestionCreate))
 
 	// マイ学習リストに追加している問題を対象に、問題集を評価する
-	protected.POST("/RatingQuestionSet", questionHandler.RatingQuestionSet)
+	protected.POST("/RatingQuestionSet", questionHandler.RatingQuestionSet, middleware.RequirePermission(rbac.PermQuestionAnswer))
 
 	// お気に入り登録
-	protected.POST("/AddToFavorite", questionHandler.AddToFavorite)
+	protected.POST("/AddToFavorite", questionHandler.AddToFavorite, middleware.RequirePermission(rbac.PermQuestionAnswer))
 
 	// お気に入り問題集検索
-	protected.GET("/SearchFavoriteQuestions", questionHandler.SearchFavoriteQuestions)
+	protected.GET("/SearchFavoriteQuestions", questionHandler.SearchFavoriteQuestions, middleware.RequirePermission(rbac.PermQuestionRead))
 }
@@ -2,10 +2,18 @@ package question
 
 import (
 	"errors"
+	"fmt"
 	"gorm.io/gorm"
 	"time"
 )
 
+var (
+	// ErrQuestionSetNotFound は問題集が存在しない場合に返す（ハンドラーで404にする）
+	ErrQuestionSetNotFound = errors.New("question set not found")
+	// ErrNotQuestionWriter は作成者（またはモデレーター）以外が問題集を修正・削除しようとした場合に返す（ハンドラーで403にする）
+	ErrNotQuestionWriter = errors.New("作成者ではないユーザーが問題集を修正・削除しようとしています。")
+)
+
 type QuestionServiceInterface interface {
 	GetAnswersByIds(ids []int) ([]IDAnswer, error)
 	CountCorrectAnswers(userId string, questionId int) (int64, error)
@@ -14,18 +22,40 @@ type QuestionServiceInterface interface {
 	UpdateProgress(userId string, questionSetId int) error
 	ChangeStatusToInProgress(userId string, questionSetId int) error
 	GetAllGenres() ([]Genre, error)
-	GetQuestionsByQuestionSetId(questionSetId int) ([]QuestionSetResponse, error)
-	GetQuestionsForFixByQuestionSetId(questionSetId int, userId string) ([]QuestionSetForFixResponse, error)
+	AuthorizeQuestionSet(userID string, questionSetID int, action AccessAction) error
+	StartAttempt(userID string, questionSetID int) (*QuizDelivery, error)
+	SubmitAttempt(userID string, questionSetID int, req SubmitQuestionsRequest) (*Attempt, error)
+	GetAttemptResult(userID, attemptID string) (*SubmissionResult, error)
+	GetMyAttempts(userID string, questionSetID, page, limit int) ([]AttemptSummary, int64, error)
+	StartReviewSession(userID string, limit int) (*QuizDelivery, error)
+	StartExam(userID string, questionSetID int) (*QuizDelivery, error)
+	StartMistakePractice(userID string, scope MistakeScope, limit int) (*QuizDelivery, error)
+	StartMockExam(userID string, req MockExamRequest) (*MockExamDelivery, error)
+	GetMockExamReport(userID, attemptID string) (*MockExamReport, error)
+	ResumeAttempt(userID string, questionSetID int) (*QuizDelivery, error)
+	SaveDraftAnswers(userID string, req SubmitQuestionsRequest) (*time.Time, error)
+	RevealHint(userID string, req RevealHintRequest) (*HintResponse, error)
+	GetCalibrationReport(userID string, genreID int) (*CalibrationReport, error)
+	GetQuestionSetSettings(userID string, questionSetID int) (*QuestionSetSettings, error)
+	UpdateQuestionSetSettings(userID string, settings QuestionSetSettings, canEditAny bool) (*QuestionSetSettings, error)
+	GetQuestionsByQuestionSetId(userID string, questionSetId int) ([]QuestionSetResponse, error)
+	GetQuestionsForFixByQuestionSetId(questionSetId int, userId string, canEditAny bool) ([]QuestionSetForFixResponse, error)
 	CountMyQuestions(userId string, questionSetId int) (int64, error)
 	CountAndEvaluateByUser(userId string, questionSetId int) (MyStar, error)
 	InsertMyQuestion(MyQuestion) error
-	GetQuestionsByIds(ids []int) ([]Question, error)
+	GetQuestionsByIds(userID string, ids []int) ([]Question, error)
 	InsertQuestions(questions []InsertQuestion) error
 	GetNextSetID() (int, error)
 	InsertQuestionSet(questionSet []QuestionSet) error
 	InsertStar(star Star) error
-	CreateQuestionSet(questions []InsertQuestion) error
-	FixQuestionSet(questionSetID int, questions []FixQuestion, genreID int, title, userId string) error
+	CreateQuestionSet(userID string, fields QuestionSetFields, questions []InsertQuestion) (*QuestionSetInfo, error)
+	FixQuestionSet(questionSetID int, fields QuestionSetFields, questions []FixQuestion, userId string, canEditAny bool) error
+	AutosaveQuestionSet(questionSetID int, fields QuestionSetFields, questions []FixQuestion, userId string, canEditAny bool) error
+	OpenSharedQuestionSet(userID, shareToken string) (*QuestionSetInfo, error)
+	GetQuestionSetInfo(userID string, questionSetID int) (*QuestionSetInfo, error)
+	GetQuestionSetRevisions(userID string, questionSetID int, canEditAny bool) ([]QuestionSetRevisionSummary, error)
+	GetQuestionSetRevisionDiff(userID string, questionSetID, from, to int, canEditAny bool) (*RevisionDiff, error)
+	RestoreQuestionSetRevision(userID string, questionSetID, revision int, canEditAny bool) (*QuestionSetRevision, error)
 	InsertMyStar(userID string, questionSetID, rating int) error
 	InsertOrUpdateStarRating(questionSetID int, rating int) (float64, error)
 	InsertFavoriteQuestion(userID string, questionSetID int) error
@@ -34,7 +64,7 @@ type QuestionServiceInterface interface {
 	GetMyCreatedQuestionList(userID, title, visibility string, genreId, page, limit int) ([]MyCreatedQuestionForShow, int64, error)
 	SearchQuestions(title string, visibility string, genreID int, userID string, page int, limit int) ([]SearchQuestionResponse, int64, error)
 	SearchFavoriteQuestions(title string, visibility string, genreID int, userID string, page int, limit int) ([]FavoriteQuestionResponse, int64, error)
-	DeleteQuestionSet(userID string, questionSetID int) error
+	DeleteQuestionSet(userID string, questionSetID int, canDeleteAny bool) error
 }
 
 type QuestionService struct {
@@ -97,7 +127,11 @@ func (q QuestionService) GetAllGenres() ([]Genre, error) {
 	return genres, nil
 }
 
-func (q QuestionService) GetQuestionsByQuestionSetId(questionSetId int) ([]QuestionSetResponse, error) {
+// GetQuestionsByQuestionSetId 問題集の問題を取得する（閲覧できない問題集はエラーを返す）
+func (q QuestionService) GetQuestionsByQuestionSetId(userID string, questionSetId int) ([]QuestionSetResponse, error) {
+	if err := q.AuthorizeQuestionSet(userID, questionSetId, AccessRead); err != nil {
+		return nil, err
+	}
 	questionSetResponse, err := q.Repo.GetQuestionsByQuestionSetId(questionSetId)
 	if err != nil {
 		return nil, err
@@ -105,7 +139,18 @@ func (q QuestionService) GetQuestionsByQuestionSetId(questionSetId int) ([]Quest
 	return questionSetResponse, nil
 }
 
-func (q QuestionService) GetQuestionsForFixByQuestionSetId(questionSetId int, userId string) ([]QuestionSetForFixResponse, error) {
+// GetQuestionsForFixByQuestionSetId 問題集修正用のデータを取得する
+// canEditAny（モデレーター）の場合は、作成者以外でも取得できる
+func (q QuestionService) GetQuestionsForFixByQuestionSetId(questionSetId int, userId string, canEditAny bool) ([]QuestionSetForFixResponse, error) {
+	if canEditAny {
+		owner, err := q.Repo.GetQuestionSetOwner(questionSetId)
+		if err != nil {
+			return nil, err
+		}
+		if owner != "" {
+			userId = owner
+		}
+	}
 	questionSetForFixResponse, err := q.Repo.GetQuestionsForFixByQuestionSetId(questionSetId, userId)
 	if err != nil {
 		return nil, err
@@ -141,11 +186,42 @@ func (q QuestionService) InsertMyQuestion(myQuestion MyQuestion) error {
 	return nil
 }
 
-func (q QuestionService) GetQuestionsByIds(ids []int) ([]Question, error) {
+// GetQuestionsByIds 問題IDを指定して問題を取得する
+// 存在しない問題IDが含まれる場合や、閲覧できない問題集の問題が含まれる場合はエラーを返す
+// 自分が作成した問題以外は、正解と選択肢を返さない（正解は回答結果でのみ確認できる）
+func (q QuestionService) GetQuestionsByIds(userID string, ids []int) ([]Question, error) {
+	setIds, err := q.Repo.GetQuestionSetIdsByQuestionIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	checked := make(map[int]bool)
+	for _, id := range ids {
+		setId, ok := setIds[id]
+		if !ok {
+			return nil, ErrQuestionSetNotFound
+		}
+		if checked[setId] {
+			continue
+		}
+		if err := q.AuthorizeQuestionSet(userID, setId, AccessRead); err != nil {
+			return nil, err
+		}
+		checked[setId] = true
+	}
+
 	questions, err := q.Repo.GetQuestionsByIds(ids)
 	if err != nil {
 		return nil, err
 	}
+	// 作成者以外には正解がわかる項目（正解・選択肢の並び・正解の計算式など）を返さない
+	for i := range questions {
+		if questions[i].UserID != userID {
+			questions[i].Spec = publicSpec(questions[i])
+			questions[i].Answer = ""
+			questions[i].Choices1 = ""
+			questions[i].Choices2 = ""
+		}
+	}
 	return questions, nil
 }
 
@@ -173,7 +249,7 @@ func (q QuestionService) InsertQuestionSet(questionSet []QuestionSet) error {
 }
 
 func (q QuestionService) InsertStar(star Star) error {
-	if err := q.InsertStar(star); err != nil {
+	if err := q.Repo.InsertStar(star); err != nil {
 		return err
 	}
 	return nil
@@ -181,29 +257,65 @@ func (q QuestionService) InsertStar(star Star) error {
 
 // ★ 新規追加：複数の操作を1トランザクション内で実行するメソッド ★
 // 　　※質問群の登録、次の set_id の取得、問題集テーブルへの登録、評価テーブルへの登録を一括で行う
-func (q QuestionService) CreateQuestionSet(questions []InsertQuestion) error {
-	return q.Repo.Transaction(func(tx *gorm.DB) error {
+// 　　※コールバック内では q.Repo ではなく、トランザクションに紐づいた repo を使うこと
+func (q QuestionService) CreateQuestionSet(userID string, fields QuestionSetFields, questions []InsertQuestion) (*QuestionSetInfo, error) {
+	if len(questions) == 0 {
+		return nil, fmt.Errorf("%w: questions is required", ErrInvalidQuestionSet)
+	}
+	if err := fields.validate(); err != nil {
+		return nil, err
+	}
+	// 問題の種類に対して正解・選択肢が正しく指定されているかを検証する
+	for i := range questions {
+		question := &questions[i]
+		if err := normalizeQuestion(&question.QuestionType, question.Answer, question.Choices1, question.Choices2, &question.Spec); err != nil {
+			return nil, err
+		}
+		if err := question.QuestionExplanation.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	info := &QuestionSetInfo{
+		UserID:            userID,
+		QuestionSetFields: fields,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	// 限定公開で作成する場合は、共有トークンを発行しておく
+	if fields.Visibility == VisibilityUnlisted {
+		token, err := newShareToken()
+		if err != nil {
+			return nil, err
+		}
+		info.ShareToken = token
+	}
+	err := q.Repo.Transaction(func(repo QuestionRepository) error {
 		// 1. 問題テーブルへバルクインサート（トランザクション対応版）
-		if err := q.Repo.InsertQuestions(questions); err != nil {
+		if err := repo.InsertQuestions(questions); err != nil {
 			return err
 		}
 
-		// 2. 次の set_id の取得
-		setID, err := q.Repo.GetNextSetID()
+		// 2. 次の set_id を取得して問題集を登録
+		setID, err := repo.GetNextSetID()
 		if err != nil {
 			return err
 		}
+		info.ID = setID
+		if err := repo.InsertQuestionSetInfo(info); err != nil {
+			return err
+		}
 
-		// 3. 問題集テーブルに set_id を設定して登録
+		// 3. 問題集と問題の対応テーブルに set_id を設定して登録
 		var questionSets []QuestionSet
 		for _, question := range questions {
 			questionSets = append(questionSets, QuestionSet{
 				SetID:      setID,
 				QuestionID: question.ID,
-				GenreID:    question.GenreID,
 			})
 		}
-		if err := q.Repo.InsertQuestionSet(questionSets); err != nil {
+		if err := repo.InsertQuestionSet(questionSets); err != nil {
 			return err
 		}
 
@@ -218,131 +330,177 @@ func (q QuestionService) CreateQuestionSet(questions []InsertQuestion) error {
 			Star5:         0,
 			AvgStar:       0,
 		}
-		if err := q.Repo.InsertStar(star); err != nil {
+		if err := repo.InsertStar(star); err != nil {
 			return err
 		}
 
+		// 5. 最初のリビジョンを保存
+		revision, err := saveRevision(repo, setID, userID, nil)
+		if err != nil {
+			return err
+		}
+		info.Revision = revision.Revision
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
 }
 
-func (q QuestionService) FixQuestionSet(questionSetID int, questions []FixQuestion, genreID int, title, userId string) error {
-	if len(questions) == 0 {
-		return errors.New("no questions")
+// FixQuestionSet 問題集を修正する（タイトル・説明などの問題集の項目も更新する）
+// 作成者本人か、canEditAny（モデレーター）の場合のみ修正できる。修正後の内容は新しいリビジョンとして保存する
+func (q QuestionService) FixQuestionSet(questionSetID int, fields QuestionSetFields, questions []FixQuestion, userId string, canEditAny bool) error {
+	if err := validateFixQuestionSet(&fields, questions); err != nil {
+		return err
 	}
 
-	return q.Repo.Transaction(func(tx *gorm.DB) error {
-		// 1. question_setテーブルから、既存のquestions_idを取得（削除されるデータと突き合わせるため）
-		existingQuestionIDs, err := q.Repo.GetQuestionIdsByQuestionSetId(questionSetID)
-		if err != nil {
+	owner, err := q.authorizeQuestionSetEdit(userId, questionSetID, canEditAny)
+	if err != nil {
+		return err
+	}
+
+	return q.Repo.Transaction(func(repo QuestionRepository) error {
+		// 追加する問題の作成者は、修正した人ではなく問題集の作成者にする
+		if err := applyQuestionSetFix(repo, questionSetID, fields, questions, owner); err != nil {
 			return err
 		}
-		// 削除対象のidが問題集の中で一番若い場合、修正もしくは作成のレコードに含める
-		// 既存の問題が全部削除されてガッツリ作り直される場合は、新規作成のレコードに過去の作成日を入れる
-		minExistingCreatedAt, err := q.Repo.GetDateByQuestionIds(existingQuestionIDs)
+		revision, err := saveRevision(repo, questionSetID, userId, nil)
 		if err != nil {
 			return err
 		}
+		// 問題が増減した場合は、学習中のユーザーの進捗を計算し直して通知する
+		return reconcileLearners(repo, revision)
+	})
+}
 
-		// 2.更新前のquestion_idと更新対象のquestion_idを突き合わせ
-		// まず既存のIDをマップに入れて0で初期化
-		existingQuestionIDsMap := make(map[int]int)
-		for i := 0; i < len(existingQuestionIDs); i++ {
-			existingQuestionIDsMap[existingQuestionIDs[i]]++
+// validateFixQuestionSet は修正する問題集の項目と問題を検証する（問題の種類に合わせて正解・選択肢を正規化する）
+func validateFixQuestionSet(fields *QuestionSetFields, questions []FixQuestion) error {
+	if len(questions) == 0 {
+		return fmt.Errorf("%w: questions is required", ErrInvalidQuestionSet)
+	}
+	if err := fields.validate(); err != nil {
+		return err
+	}
+	for i := range questions {
+		question := &questions[i]
+		if err := normalizeQuestion(&question.QuestionType, question.Answer, question.Choices1, question.Choices2, &question.Spec); err != nil {
+			return err
 		}
-		// 更新対象のquestion_idでマップをインクリメント
-		var createQuestions []InsertQuestion
-		var fixQuestions []FixQuestion
-		var deleteQuestionIds []int
-		for _, question := range questions {
-			if question.ID == nil {
-				// 作成対象のquestions（idは自動連番）
-				createQuestions = append(createQuestions, InsertQuestion{
-					UserID:     userId,
-					Title:      title,
-					GenreID:    genreID,
-					Visibility: question.Visibility,
-					Question:   question.Question,
-					Answer:     question.Answer,
-					Choices1:   question.Choices1,
-					Choices2:   question.Choices2,
-					CreatedAt:  *minExistingCreatedAt,
-					UpdatedAt:  time.Now(),
-				})
-				continue // ここで以降の処理をスキップする
-			}
+		if err := question.QuestionExplanation.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			// 修正対象
-			if existingQuestionIDsMap[*question.ID] > 0 {
-				// 修正対象のquestions
-				fixQuestions = append(fixQuestions, question)
-				existingQuestionIDsMap[*question.ID]-- // 削除対象の洗い出しに1以上のやつを使うため、デクリメント
-			}
+// applyQuestionSetFix は問題集の項目を更新し、questions に合わせて問題を追加・修正・削除する
+// ID が nil の問題は追加し、問題集にない問題は削除する（ownerID は追加する問題の作成者）
+func applyQuestionSetFix(repo QuestionRepository, questionSetID int, fields QuestionSetFields, questions []FixQuestion, ownerID string) error {
+	// 0. 問題集のタイトル・ジャンル・公開範囲などを更新（公開範囲を変えられるかも確認する）
+	if err := applyPublishingState(repo, questionSetID, fields); err != nil {
+		return err
+	}
+	if err := repo.UpdateQuestionSetInfo(questionSetID, fields, time.Now()); err != nil {
+		return err
+	}
 
+	// 1. question_setテーブルから、既存のquestions_idを取得（削除されるデータと突き合わせるため）
+	existingQuestionIDs, err := repo.GetQuestionIdsByQuestionSetId(questionSetID)
+	if err != nil {
+		return err
+	}
+	// 削除対象のidが問題集の中で一番若い場合、修正もしくは作成のレコードに含める
+	// 既存の問題が全部削除されてガッツリ作り直される場合は、新規作成のレコードに過去の作成日を入れる
+	minExistingCreatedAt, err := repo.GetDateByQuestionIds(existingQuestionIDs)
+	if err != nil {
+		return err
+	}
+
+	// 2.更新前のquestion_idと更新対象のquestion_idを突き合わせ
+	// まず既存のIDをマップに入れて0で初期化
+	existingQuestionIDsMap := make(map[int]int)
+	for i := 0; i < len(existingQuestionIDs); i++ {
+		existingQuestionIDsMap[existingQuestionIDs[i]]++
+	}
+	// 更新対象のquestion_idでマップをインクリメント
+	var createQuestions []InsertQuestion
+	var fixQuestions []FixQuestion
+	var deleteQuestionIds []int
+	for _, question := range questions {
+		if question.ID == nil {
+			// 作成対象のquestions（idは自動連番）
+			createQuestions = append(createQuestions, InsertQuestion{
+				UserID:              ownerID,
+				GenreID:             fields.GenreID,
+				Question:            question.Question,
+				Answer:              question.Answer,
+				Choices1:            question.Choices1,
+				Choices2:            question.Choices2,
+				QuestionType:        question.QuestionType,
+				Spec:                question.Spec,
+				QuestionExplanation: question.QuestionExplanation,
+				CreatedAt:           *minExistingCreatedAt,
+				UpdatedAt:           time.Now(),
+			})
+			continue // ここで以降の処理をスキップする
 		}
 
-		// 削除対象のquestion_idたち
-		for questionId, count := range existingQuestionIDsMap {
-			if count > 0 {
-				deleteQuestionIds = append(deleteQuestionIds, questionId)
-			}
+		// 修正対象
+		if existingQuestionIDsMap[*question.ID] > 0 {
+			// 修正対象のquestions
+			fixQuestions = append(fixQuestions, question)
+			existingQuestionIDsMap[*question.ID]-- // 削除対象の洗い出しに1以上のやつを使うため、デクリメント
 		}
 
-		// 3-1.追加対象の問題をquestionsテーブルに追加
-		if len(createQuestions) > 0 {
-			if err := q.Repo.InsertQuestions(createQuestions); err != nil {
-				return err
-			}
-			// 3-2.追加対象の問題を構造体に追加したい（question_set_idは修正対象のものと同じにする必要あり）。
-			var questionSets []QuestionSet
-			for _, question := range createQuestions {
-				questionSets = append(questionSets, QuestionSet{
-					SetID:      questionSetID,
-					QuestionID: question.ID,
-					GenreID:    genreID,
-				})
-			}
-			// questionsテーブルに追加したidをもとに、question_setテーブルにレコードを紐付け
-			if err := q.Repo.InsertQuestionSet(questionSets); err != nil {
-				return err
-			}
+	}
+
+	// 削除対象のquestion_idたち
+	for questionId, count := range existingQuestionIDsMap {
+		if count > 0 {
+			deleteQuestionIds = append(deleteQuestionIds, questionId)
 		}
+	}
 
-		// 4.リクエストに含まれていなかった問題を削除
-		// questionsテーブルからidを指定して削除
-		if len(deleteQuestionIds) > 0 {
-			if err := q.Repo.DeleteQuestionsByIds(deleteQuestionIds); err != nil {
-				return err
-			}
-			// question_setテーブルからquestion_idを指定して削除
-			if err := q.Repo.DeleteQuestionSetByIds(deleteQuestionIds); err != nil {
-				return err
-			}
+	// 3-1.追加対象の問題をquestionsテーブルに追加
+	if len(createQuestions) > 0 {
+		if err := repo.InsertQuestions(createQuestions); err != nil {
+			return err
+		}
+		// 3-2.追加対象の問題を構造体に追加したい（question_set_idは修正対象のものと同じにする必要あり）。
+		var questionSets []QuestionSet
+		for _, question := range createQuestions {
+			questionSets = append(questionSets, QuestionSet{
+				SetID:      questionSetID,
+				QuestionID: question.ID,
+			})
 		}
+		// questionsテーブルに追加したidをもとに、question_setテーブルにレコードを紐付け
+		if err := repo.InsertQuestionSet(questionSets); err != nil {
+			return err
+		}
+	}
 
-		// 5.修正対象のレコードをquestionsテーブルに更新
-		// ジャンルが変わってる可能性があるので、questionsテーブルとquestion_setテーブルを更新しておく
-		// 5-1.questionsテーブルを更新
-		if len(fixQuestions) > 0 {
-			if err := q.Repo.FixQuestions(fixQuestions); err != nil {
-				return err
-			}
-			// 5-2.question_setテーブルを更新
-			var fixQuestionSets []QuestionSet
-			for _, question := range fixQuestions {
-				fixQuestionSets = append(fixQuestionSets, QuestionSet{
-					SetID:      questionSetID,
-					QuestionID: *question.ID,
-					GenreID:    genreID,
-				})
-			}
-			if err := q.Repo.FixQuestionSet(fixQuestionSets); err != nil {
-				return err
-			}
+	// 4.リクエストに含まれていなかった問題を削除
+	// questionsテーブルからidを指定して削除
+	if len(deleteQuestionIds) > 0 {
+		if err := repo.DeleteQuestionsByIds(deleteQuestionIds); err != nil {
+			return err
 		}
+		// question_setテーブルからquestion_idを指定して削除
+		if err := repo.DeleteQuestionSetByIds(deleteQuestionIds); err != nil {
+			return err
+		}
+	}
 
-		return nil
-	})
+	// 5.修正対象のレコードをquestionsテーブルに更新
+	if len(fixQuestions) > 0 {
+		if err := repo.FixQuestions(fixQuestions); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (q QuestionService) InsertMyStar(userID string, questionSetID, rating int) error {
@@ -355,9 +513,9 @@ func (q QuestionService) InsertMyStar(userID string, questionSetID, rating int)
 func (q QuestionService) InsertOrUpdateStarRating(questionSetID int, rating int) (float64, error) {
 	var avgStar float64
 
-	err := q.Repo.Transaction(func(tx *gorm.DB) error {
+	err := q.Repo.Transaction(func(repo QuestionRepository) error {
 		// ロック付きでスター評価レコードの取得
-		starRecord, err := q.Repo.GetStarForUpdate(questionSetID)
+		starRecord, err := repo.GetStarForUpdate(questionSetID)
 		if err != nil {
 			// レコードが存在しない場合は新規作成
 			if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -371,8 +529,8 @@ func (q QuestionService) InsertOrUpdateStarRating(questionSetID int, rating int)
 					Star5:         0,
 					AvgStar:       0,
 				}
-				// 新規レコードの作成（※ InsertStar でも良いですが、トランザクション内で直接作成しても問題ありません）
-				if err := tx.Table("online_learning_stars").Create(starRecord).Error; err != nil {
+				// 新規レコードの作成（トランザクションに紐づいたリポジトリ経由で作成する）
+				if err := repo.InsertStar(*starRecord); err != nil {
 					return err
 				}
 			} else {
@@ -400,7 +558,7 @@ func (q QuestionService) InsertOrUpdateStarRating(questionSetID int, rating int)
 		starRecord.AvgStar = float64(sum) / float64(starRecord.TotalStars)
 
 		// レコードの更新保存
-		if err := q.Repo.SaveStar(starRecord); err != nil {
+		if err := repo.SaveStar(starRecord); err != nil {
 			return err
 		}
 
@@ -479,47 +637,56 @@ func (q QuestionService) SearchFavoriteQuestions(title string, visibility string
 	return q.Repo.SearchFavoriteQuestions(title, visibility, genreID, userID, offset, limit)
 }
 
-func (q QuestionService) DeleteQuestionSet(userID string, questionSetID int) error {
+func (q QuestionService) DeleteQuestionSet(userID string, questionSetID int, canDeleteAny bool) error {
 	// questionSetIDから削除しようとしている問題集の作成者を取得して、そいつとuserIDが一致したら削除を実行する
-	judge, err := q.Repo.IsQuestionWriter(userID, questionSetID)
+	// canDeleteAny（モデレーター）の場合は作成者でなくても削除できる
+	owner, err := q.Repo.GetQuestionSetOwner(questionSetID)
 	if err != nil {
 		return err
 	}
-	if !judge {
-		return errors.New("作成者ではないユーザーが問題を削除しようとしています。")
+	if owner == "" {
+		return ErrQuestionSetNotFound
 	}
-
-	// 問題の削除を実行
-	deleteQuestionIds, err := q.Repo.GetQuestionIdsByQuestionSetId(questionSetID)
-	if err != nil {
-		return err
+	if owner != userID && !canDeleteAny {
+		return ErrNotQuestionWriter
 	}
-	if len(deleteQuestionIds) > 0 {
-		// questionsテーブルから問題を物理削除
-		err := q.Repo.DeleteQuestionsByIds(deleteQuestionIds)
+
+	// 問題の削除を実行（途中で失敗した場合に中途半端なレコードが残らないよう、1トランザクションで行う）
+	return q.Repo.Transaction(func(repo QuestionRepository) error {
+		deleteQuestionIds, err := repo.GetQuestionIdsByQuestionSetId(questionSetID)
 		if err != nil {
 			return err
 		}
-		// question_setテーブルから問題を物理削除
-		err2 := q.Repo.DeleteQuestionSetByIds(deleteQuestionIds)
-		if err2 != nil {
-			return err2
+		if len(deleteQuestionIds) > 0 {
+			// questionsテーブルから問題を物理削除
+			if err := repo.DeleteQuestionsByIds(deleteQuestionIds); err != nil {
+				return err
+			}
+			// question_setテーブルから問題を物理削除
+			if err := repo.DeleteQuestionSetByIds(deleteQuestionIds); err != nil {
+				return err
+			}
 		}
 		// stars（みんながつけた評価テーブル）からquestionSetIDをもとにレコードを削除
-		err3 := q.Repo.DeleteStarsByQuestionSetID(questionSetID)
-		if err3 != nil {
-			return err3
+		if err := repo.DeleteStarsByQuestionSetID(questionSetID); err != nil {
+			return err
 		}
 		// my_stars（自分がつけた評価テーブル）からquestionSetIDをもとにレコードを削除
-		err4 := q.Repo.DeleteMyStarsByQuestionSetID(questionSetID)
-		if err4 != nil {
-			return err4
+		if err := repo.DeleteMyStarsByQuestionSetID(questionSetID); err != nil {
+			return err
 		}
 		// my_questions（マイ学習リストに追加した問題集）からquestionSetIDをもとにレコードを削除
-		err5 := q.Repo.DeleteMyQuestionsByQuestionSetID(questionSetID)
-		if err5 != nil {
-			return err5
+		if err := repo.DeleteMyQuestionsByQuestionSetID(questionSetID); err != nil {
+			return err
 		}
-	}
-	return nil
+		// 問題集の設定を削除
+		if err := repo.DeleteQuestionSetSettings(questionSetID); err != nil {
+			return err
+		}
+		// 問題集を削除
+		if err := repo.DeleteQuestionSetInfo(questionSetID); err != nil {
+			return err
+		}
+		return nil
+	})
 }
@@ -0,0 +1,114 @@
+package question
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 問題集の設定（試験モードの制限時間・問題プール・合格点など）
+
+// maxTimeLimitSeconds 制限時間の上限（24時間）
+const maxTimeLimitSeconds = 24 * 60 * 60
+
+var (
+	// ErrInvalidSettings は問題集の設定値が正しくない場合に返す（ハンドラーで400にする）
+	ErrInvalidSettings = errors.New("invalid question set settings")
+	// ErrNoTimeLimit は制限時間が設定されていない問題集で試験モードを開始しようとした場合に返す（ハンドラーで400にする）
+	ErrNoTimeLimit = errors.New("this question set has no time limit")
+)
+
+// QuestionSetSettings 問題集の設定（レコードがない問題集は初期値として扱う）
+type QuestionSetSettings struct {
+	QuestionSetID int `json:"questionSetId" gorm:"column:question_set_id;primaryKey"`
+	// 試験モードの制限時間（秒）。0 の場合は試験モードを使えない
+	TimeLimitSeconds int `json:"timeLimitSeconds" gorm:"column:time_limit_seconds"`
+	// 問題プール：1回の回答で出題する問題数（0 の場合はすべての問題を出題する）
+	DrawCount int `json:"drawCount" gorm:"column:draw_count"`
+	// 出題順をアテンプトごとにシャッフルするか（問題プールの場合は常にシャッフルする）
+	ShuffleQuestions bool `json:"shuffleQuestions" gorm:"column:shuffle_questions"`
+	// 合格点（得点の割合。0〜100）。0 の場合は合否を判定しない
+	PassThreshold float64   `json:"passThreshold" gorm:"column:pass_threshold"`
+	UpdatedAt     time.Time `json:"updatedAt" gorm:"column:updated_at"`
+}
+
+// テーブル名を指定
+func (QuestionSetSettings) TableName() string {
+	return "online_learning_question_set_settings"
+}
+
+// validate は設定値の範囲を検証する
+func (s *QuestionSetSettings) validate() error {
+	if s.TimeLimitSeconds < 0 || s.TimeLimitSeconds > maxTimeLimitSeconds {
+		return fmt.Errorf("%w: timeLimitSeconds must be between 0 and %d", ErrInvalidSettings, maxTimeLimitSeconds)
+	}
+	if s.DrawCount < 0 {
+		return fmt.Errorf("%w: drawCount must not be negative", ErrInvalidSettings)
+	}
+	if s.PassThreshold < 0 || s.PassThreshold > 100 {
+		return fmt.Errorf("%w: passThreshold must be between 0 and 100", ErrInvalidSettings)
+	}
+	return nil
+}
+
+// GetQuestionSetSettings 問題集の設定を取得する（閲覧できる問題集のみ）
+func (q QuestionService) GetQuestionSetSettings(userID string, questionSetID int) (*QuestionSetSettings, error) {
+	if err := q.AuthorizeQuestionSet(userID, questionSetID, AccessRead); err != nil {
+		return nil, err
+	}
+	return q.Repo.GetQuestionSetSettings(questionSetID)
+}
+
+// UpdateQuestionSetSettings 問題集の設定を更新する
+// 作成者本人か、canEditAny（モデレーター）の場合のみ更新できる
+func (q QuestionService) UpdateQuestionSetSettings(userID string, settings QuestionSetSettings, canEditAny bool) (*QuestionSetSettings, error) {
+	owner, err := q.Repo.GetQuestionSetOwner(settings.QuestionSetID)
+	if err != nil {
+		return nil, err
+	}
+	if owner == "" {
+		return nil, ErrQuestionSetNotFound
+	}
+	if owner != userID && !canEditAny {
+		return nil, ErrNotQuestionWriter
+	}
+	if err := settings.validate(); err != nil {
+		return nil, err
+	}
+
+	settings.UpdatedAt = time.Now()
+	if err := q.Repo.SaveQuestionSetSettings(&settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// StartExam 試験モードで回答を開始する
+// 問題集に設定された制限時間から締め切り（deadline_at）を決め、提出時にサーバー側で判定する
+// 回答中の試験がある場合は、締め切りを延ばさずにそのアテンプトを再開する
+func (q QuestionService) StartExam(userID string, questionSetID int) (*QuizDelivery, error) {
+	if err := q.AuthorizeQuestionSet(userID, questionSetID, AccessAnswer); err != nil {
+		return nil, err
+	}
+	settings, err := q.Repo.GetQuestionSetSettings(questionSetID)
+	if err != nil {
+		return nil, err
+	}
+	if settings.TimeLimitSeconds <= 0 {
+		return nil, ErrNoTimeLimit
+	}
+	if delivery, err := q.resumeAttempt(userID, questionSetID, AttemptKindExam); err != nil || delivery != nil {
+		return delivery, err
+	}
+
+	questions, err := q.questionsOfSet(questionSetID)
+	if err != nil {
+		return nil, err
+	}
+	questions = drawQuestions(questions, settings)
+
+	attempt := newAttempt(userID, questionSetID, AttemptKindExam)
+	deadline := attempt.StartedAt.Add(time.Duration(settings.TimeLimitSeconds) * time.Second)
+	attempt.DeadlineAt = &deadline
+	return q.createAttempt(attempt, questions)
+}
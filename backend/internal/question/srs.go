@@ -0,0 +1,175 @@
+package question
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// 復習スケジュール（SM-2）
+// 復習期限が来た問題（初めて答えた問題を含む）の回答を提出するとユーザー・問題ごとの復習状態を更新し、復習期限が来た問題から復習セッションを作る
+
+const (
+	// defaultEaseFactor 初めて回答した問題の難易度係数
+	defaultEaseFactor = 2.5
+	// minEaseFactor 難易度係数の下限
+	minEaseFactor = 1.3
+	// defaultReviewLimit 1回の復習セッションで出題する問題数
+	defaultReviewLimit = 20
+)
+
+// 回答の質（SM-2 の quality。0〜5、3以上を正解として扱う）
+// 自信度を付けた回答は、自信があった正解ほど質を高く、自信を持って間違えた回答ほど質を低くする
+const (
+	reviewQualityConfidentMiss = 0 // 自信があったのに不正解
+	reviewQualityIncorrect     = 1
+	reviewQualityGuessed       = 2 // 勘で正解（不正解と同じく翌日に復習する）
+	reviewQualityUnsure        = 3 // 自信がないまま正解（間隔はあまり伸ばさない）
+	reviewQualityCorrect       = 4
+	reviewQualitySure          = 5
+)
+
+// ErrNoDueReviews は復習期限が来た問題がない場合に返す（ハンドラーで404にする）
+var ErrNoDueReviews = errors.New("no questions are due for review")
+
+// ReviewState ユーザー・問題ごとの復習状態
+type ReviewState struct {
+	UserID         string     `json:"-" gorm:"column:user_id;primaryKey"`
+	QuestionID     int        `json:"questionId" gorm:"column:question_id;primaryKey"`
+	Repetitions    int        `json:"repetitions" gorm:"column:repetitions"`
+	EaseFactor     float64    `json:"easeFactor" gorm:"column:ease_factor"`
+	IntervalDays   int        `json:"intervalDays" gorm:"column:interval_days"`
+	Lapses         int        `json:"lapses" gorm:"column:lapses"`
+	DueAt          time.Time  `json:"dueAt" gorm:"column:due_at"`
+	LastReviewedAt *time.Time `json:"lastReviewedAt" gorm:"column:last_reviewed_at"`
+}
+
+// テーブル名を指定
+func (ReviewState) TableName() string {
+	return "online_learning_review_states"
+}
+
+// applySM2 は回答の質（0〜5）から次の復習間隔と難易度係数を計算する
+func applySM2(state *ReviewState, quality int, now time.Time) {
+	if state.EaseFactor == 0 {
+		state.EaseFactor = defaultEaseFactor
+	}
+	if quality >= 3 {
+		switch state.Repetitions {
+		case 0:
+			state.IntervalDays = 1
+		case 1:
+			state.IntervalDays = 6
+		default:
+			state.IntervalDays = int(math.Round(float64(state.IntervalDays) * state.EaseFactor))
+		}
+		state.Repetitions++
+	} else {
+		// 間違えた場合は最初からやり直す
+		state.Repetitions = 0
+		state.IntervalDays = 1
+		state.Lapses++
+	}
+
+	diff := float64(5 - quality)
+	state.EaseFactor += 0.1 - diff*(0.08+diff*0.02)
+	if state.EaseFactor < minEaseFactor {
+		state.EaseFactor = minEaseFactor
+	}
+
+	state.DueAt = now.AddDate(0, 0, state.IntervalDays)
+	state.LastReviewedAt = &now
+}
+
+// reviewQuality は採点結果と自信度から回答の質を決める
+func reviewQuality(result Result) int {
+	if !result.Correct {
+		if result.Confidence == ConfidenceSure {
+			return reviewQualityConfidentMiss
+		}
+		return reviewQualityIncorrect
+	}
+	switch result.Confidence {
+	case ConfidenceSure:
+		return reviewQualitySure
+	case ConfidenceUnsure:
+		return reviewQualityUnsure
+	case ConfidenceGuess:
+		return reviewQualityGuessed
+	default:
+		return reviewQualityCorrect
+	}
+}
+
+// isReviewDue は回答で復習状態を更新するか（復習期限が来ているか）を返す
+func isReviewDue(state ReviewState, now time.Time, reviewSession bool) bool {
+	return reviewSession || !state.DueAt.After(now)
+}
+
+// updateReviewStates は採点結果をもとに復習状態を更新する
+// 復習期限前の問題に答えても間隔は変えない（期限前に何度も解くと間隔が伸び続けるため）
+// 復習セッション（reviewSession）では、今日が期限の問題を出題するので、期限前でも更新する
+func updateReviewStates(repo QuestionRepository, userID string, results []Result, now time.Time, reviewSession bool) error {
+	if len(results) == 0 {
+		return nil
+	}
+	var questionIDs []int
+	for _, result := range results {
+		questionIDs = append(questionIDs, result.QuestionID)
+	}
+	states, err := repo.GetReviewStates(userID, questionIDs)
+	if err != nil {
+		return err
+	}
+
+	var updated []ReviewState
+	for _, result := range results {
+		state, ok := states[result.QuestionID]
+		if !ok {
+			state = ReviewState{UserID: userID, QuestionID: result.QuestionID}
+		} else if !isReviewDue(state, now, reviewSession) {
+			continue
+		}
+		applySM2(&state, reviewQuality(result), now)
+		updated = append(updated, state)
+	}
+	if len(updated) == 0 {
+		return nil
+	}
+	return repo.SaveReviewStates(updated)
+}
+
+// StartReviewSession 今日が復習期限の問題で復習セッションを開始する
+// 対象はマイ学習リストに追加している問題集の問題（期限が古い順に limit 問まで）
+func (q QuestionService) StartReviewSession(userID string, limit int) (*QuizDelivery, error) {
+	if limit <= 0 {
+		limit = defaultReviewLimit
+	}
+	now := time.Now()
+	endOfToday := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+
+	questionIDs, err := q.Repo.GetDueReviewQuestionIds(userID, endOfToday, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(questionIDs) == 0 {
+		return nil, ErrNoDueReviews
+	}
+	questions, err := q.Repo.GetQuestionsByIds(questionIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// 期限が古い順に出題する
+	byID := make(map[int]Question, len(questions))
+	for _, question := range questions {
+		byID[question.ID] = question
+	}
+	var ordered []Question
+	for _, id := range questionIDs {
+		if question, ok := byID[id]; ok {
+			ordered = append(ordered, question)
+		}
+	}
+	return q.createAttempt(newAttempt(userID, 0, AttemptKindReview), ordered)
+}
@@ -0,0 +1,129 @@
+package question
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+
+func TestReviewQuality(t *testing.T) {
+	tests := []struct {
+		correct    bool
+		confidence string
+		want       int
+	}{
+		{false, ConfidenceSure, reviewQualityConfidentMiss},
+		{false, ConfidenceUnsure, reviewQualityIncorrect},
+		{false, "", reviewQualityIncorrect},
+		{true, ConfidenceGuess, reviewQualityGuessed},
+		{true, ConfidenceUnsure, reviewQualityUnsure},
+		{true, "", reviewQualityCorrect},
+		{true, ConfidenceSure, reviewQualitySure},
+	}
+	for _, tt := range tests {
+		if got := reviewQuality(Result{Correct: tt.correct, Confidence: tt.confidence}); got != tt.want {
+			t.Errorf("reviewQuality(correct=%v, confidence=%q) = %d, want %d", tt.correct, tt.confidence, got, tt.want)
+		}
+	}
+}
+
+func TestApplySM2(t *testing.T) {
+	tests := []struct {
+		name             string
+		state            ReviewState
+		quality          int
+		wantRepetitions  int
+		wantIntervalDays int
+		wantEaseFactor   float64
+		wantLapses       int
+	}{
+		{"first correct answer", ReviewState{}, reviewQualityCorrect, 1, 1, 2.5, 0},
+		{"second correct answer", ReviewState{Repetitions: 1, IntervalDays: 1, EaseFactor: 2.5}, reviewQualityCorrect, 2, 6, 2.5, 0},
+		{"third correct answer", ReviewState{Repetitions: 2, IntervalDays: 6, EaseFactor: 2.5}, reviewQualityCorrect, 3, 15, 2.5, 0},
+		{"sure answer raises ease", ReviewState{Repetitions: 2, IntervalDays: 6, EaseFactor: 2.5}, reviewQualitySure, 3, 15, 2.6, 0},
+		{"unsure answer lowers ease", ReviewState{Repetitions: 1, IntervalDays: 1, EaseFactor: 2.5}, reviewQualityUnsure, 2, 6, 2.36, 0},
+		{"miss resets repetitions", ReviewState{Repetitions: 3, IntervalDays: 15, EaseFactor: 2.5}, reviewQualityIncorrect, 0, 1, 1.96, 1},
+		{"guess counts as a miss", ReviewState{Repetitions: 3, IntervalDays: 15, EaseFactor: 2.5}, reviewQualityGuessed, 0, 1, 2.18, 1},
+		{"ease floor", ReviewState{Repetitions: 3, IntervalDays: 15, EaseFactor: 1.4, Lapses: 2}, reviewQualityConfidentMiss, 0, 1, minEaseFactor, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := tt.state
+			applySM2(&state, tt.quality, testNow)
+			if state.Repetitions != tt.wantRepetitions || state.IntervalDays != tt.wantIntervalDays || state.Lapses != tt.wantLapses {
+				t.Errorf("repetitions, interval, lapses = %d, %d, %d; want %d, %d, %d",
+					state.Repetitions, state.IntervalDays, state.Lapses, tt.wantRepetitions, tt.wantIntervalDays, tt.wantLapses)
+			}
+			if math.Abs(state.EaseFactor-tt.wantEaseFactor) > 1e-9 {
+				t.Errorf("ease factor = %v, want %v", state.EaseFactor, tt.wantEaseFactor)
+			}
+			if want := testNow.AddDate(0, 0, tt.wantIntervalDays); !state.DueAt.Equal(want) {
+				t.Errorf("due at = %v, want %v", state.DueAt, want)
+			}
+			if state.LastReviewedAt == nil || !state.LastReviewedAt.Equal(testNow) {
+				t.Errorf("last reviewed at = %v, want %v", state.LastReviewedAt, testNow)
+			}
+		})
+	}
+}
+
+// reviewStateRepository は復習状態をメモリ上に保持する
+type reviewStateRepository struct {
+	QuestionRepository
+	states map[int]ReviewState
+}
+
+func (r *reviewStateRepository) GetReviewStates(userID string, questionIDs []int) (map[int]ReviewState, error) {
+	states := make(map[int]ReviewState)
+	for _, id := range questionIDs {
+		if state, ok := r.states[id]; ok {
+			states[id] = state
+		}
+	}
+	return states, nil
+}
+
+func (r *reviewStateRepository) SaveReviewStates(states []ReviewState) error {
+	for _, state := range states {
+		r.states[state.QuestionID] = state
+	}
+	return nil
+}
+
+func TestUpdateReviewStatesOnlyWhenDue(t *testing.T) {
+	due := ReviewState{UserID: "user-1", QuestionID: 1, Repetitions: 1, IntervalDays: 1, EaseFactor: 2.5, DueAt: testNow.Add(-time.Hour)}
+	notDue := ReviewState{UserID: "user-1", QuestionID: 2, Repetitions: 1, IntervalDays: 1, EaseFactor: 2.5, DueAt: testNow.Add(time.Hour)}
+	results := []Result{
+		{QuestionID: 1, Correct: true},
+		{QuestionID: 2, Correct: false},
+		{QuestionID: 3, Correct: true}, // 初めて答えた問題
+	}
+
+	tests := []struct {
+		name          string
+		reviewSession bool
+		wantUpdated   map[int]bool
+	}{
+		{"standard attempt", false, map[int]bool{1: true, 2: false, 3: true}},
+		{"review session", true, map[int]bool{1: true, 2: true, 3: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &reviewStateRepository{states: map[int]ReviewState{1: due, 2: notDue}}
+			if err := updateReviewStates(repo, "user-1", results, testNow, tt.reviewSession); err != nil {
+				t.Fatal(err)
+			}
+			before := map[int]ReviewState{1: due, 2: notDue}
+			for id, wantUpdated := range tt.wantUpdated {
+				state, ok := repo.states[id]
+				updated := ok && !reflect.DeepEqual(state, before[id])
+				if updated != wantUpdated {
+					t.Errorf("question %d updated = %v, want %v (%+v)", id, updated, wantUpdated, state)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package question
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// テンプレート問題
+// 問題文の {{変数名}} をアテンプトごとに範囲内のランダムな値に置き換え、正解は計算式（Spec.Formula）から求める
+// 出題した値は attempt_responses.variables に保存し、採点のときに同じ値で正解を計算する（Spec.Tolerance 以内なら正解）
+
+const (
+	// maxTemplateTries 計算結果が数値にならない（0 で割るなど）場合に値を選び直す回数
+	maxTemplateTries = 20
+	// maxTemplateSteps 1つの変数で選べる値の数の上限（(Max-Min)/Step がこれを超える範囲は指定できない）
+	maxTemplateSteps = 1000000
+)
+
+// TemplateVariable テンプレート問題の変数
+// Min〜Max の範囲で Step 刻みの値を選ぶ（Step が 0 の場合は 1 刻み）
+type TemplateVariable struct {
+	Name string  `json:"name"`
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Step float64 `json:"step,omitempty"`
+}
+
+// templateValues アテンプトで選んだ変数の値（変数名 → 値）
+type templateValues map[string]float64
+
+// Value は jsonb 列に保存する値を返す
+func (v templateValues) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(map[string]float64(v))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan は jsonb 列の値を読み込む
+func (v *templateValues) Scan(value interface{}) error {
+	switch s := value.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(s, (*map[string]float64)(v))
+	case string:
+		return json.Unmarshal([]byte(s), (*map[string]float64)(v))
+	default:
+		return fmt.Errorf("unexpected type for template values: %T", value)
+	}
+}
+
+// validateTemplate はテンプレート問題の変数と計算式を検証する
+func validateTemplate(spec *QuestionSpec) error {
+	if len(spec.Variables) == 0 {
+		return fmt.Errorf("%w: template needs variables", ErrInvalidQuestion)
+	}
+	if spec.Tolerance < 0 {
+		return fmt.Errorf("%w: tolerance must not be negative", ErrInvalidQuestion)
+	}
+	names := make(map[string]bool)
+	minValues := make(map[string]float64)
+	for _, variable := range spec.Variables {
+		if !isIdentifier(variable.Name) {
+			return fmt.Errorf("%w: invalid variable name %q", ErrInvalidQuestion, variable.Name)
+		}
+		if _, ok := formulaFuncs[variable.Name]; ok || names[variable.Name] {
+			return fmt.Errorf("%w: variable name %q is reserved or duplicated", ErrInvalidQuestion, variable.Name)
+		}
+		if variable.Min > variable.Max || variable.Step < 0 {
+			return fmt.Errorf("%w: variable %q needs min <= max and step >= 0", ErrInvalidQuestion, variable.Name)
+		}
+		if _, ok := templateSteps(variable); !ok {
+			return fmt.Errorf("%w: variable %q allows at most %d values", ErrInvalidQuestion, variable.Name, maxTemplateSteps)
+		}
+		names[variable.Name] = true
+		minValues[variable.Name] = variable.Min
+	}
+	formula, err := parseFormula(spec.Formula)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidQuestion, err)
+	}
+	// 未定義の変数や関数の引数の数の誤りを見つけるため、一度計算してみる
+	if _, err := formula.eval(minValues); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidQuestion, err)
+	}
+	return nil
+}
+
+func isIdentifier(s string) bool {
+	if s == "" || !isIdentStart(rune(s[0])) {
+		return false
+	}
+	for _, c := range s {
+		if !isIdentPart(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// templateSteps は変数の Min から何 Step 先まで選べるかを返す
+// 範囲が広すぎる（値の数が maxTemplateSteps を超える）・数値でない場合は false を返す
+func templateSteps(variable TemplateVariable) (int, bool) {
+	step := variable.Step
+	if step == 0 {
+		step = 1
+	}
+	steps := math.Floor((variable.Max-variable.Min)/step + 1e-9)
+	if math.IsNaN(steps) || steps < 0 || steps > maxTemplateSteps {
+		return 0, false
+	}
+	return int(steps), true
+}
+
+// generateTemplateValues は変数の値を選ぶ（計算結果が有限の数値になる値が見つかるまで選び直す）
+func generateTemplateValues(spec QuestionSpec) (templateValues, error) {
+	for i := 0; i < maxTemplateTries; i++ {
+		values := make(templateValues, len(spec.Variables))
+		for _, variable := range spec.Variables {
+			// 上限を設ける前に保存された問題でも panic しないよう、ここでも範囲を確認する
+			n, ok := templateSteps(variable)
+			if !ok {
+				return nil, fmt.Errorf("%w: variable %q has too wide a range", ErrInvalidQuestion, variable.Name)
+			}
+			step := variable.Step
+			if step == 0 {
+				step = 1
+			}
+			values[variable.Name] = roundValue(variable.Min + float64(rand.IntN(n+1))*step)
+		}
+		if _, err := templateAnswer(spec, values); err == nil {
+			return values, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: could not generate values for the formula", ErrInvalidQuestion)
+}
+
+// templateAnswer は変数の値から正解を計算する
+func templateAnswer(spec QuestionSpec, values templateValues) (float64, error) {
+	formula, err := parseFormula(spec.Formula)
+	if err != nil {
+		return 0, err
+	}
+	v, err := formula.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("%w: result is not a finite number", ErrInvalidFormula)
+	}
+	return v, nil
+}
+
+// renderTemplate は問題文の {{変数名}} を値に置き換える
+func renderTemplate(text string, values templateValues) string {
+	var pairs []string
+	for name, value := range values {
+		pairs = append(pairs, "{{"+name+"}}", formatNumber(value))
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// instantiateTemplate はテンプレート問題の値を選び、問題文を置き換える（テンプレート問題以外は何もしない）
+func instantiateTemplate(question *Question) (templateValues, error) {
+	if question.QuestionType != QuestionTypeTemplate {
+		return nil, nil
+	}
+	values, err := generateTemplateValues(question.Spec)
+	if err != nil {
+		return nil, err
+	}
+	question.Question = renderTemplate(question.Question, values)
+	return values, nil
+}
+
+// roundValue は Step の加算で生じる誤差を丸める
+func roundValue(v float64) float64 {
+	return math.Round(v*1e9) / 1e9
+}
+
+// formatNumber は数値を問題文・正解に表示する形にする
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(roundValue(v), 'f', -1, 64)
+}
@@ -0,0 +1,95 @@
+package question
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestValidateTemplate(t *testing.T) {
+	variable := func(name string, min, max, step float64) TemplateVariable {
+		return TemplateVariable{Name: name, Min: min, Max: max, Step: step}
+	}
+	tests := []struct {
+		name    string
+		spec    QuestionSpec
+		wantErr bool
+	}{
+		{"valid", QuestionSpec{Variables: []TemplateVariable{variable("a", 1, 10, 1), variable("b", 0.5, 2, 0.5)}, Formula: "a * b"}, false},
+		{"step defaults to 1", QuestionSpec{Variables: []TemplateVariable{variable("a", 1, 10, 0)}, Formula: "a + 1"}, false},
+		{"no variables", QuestionSpec{Formula: "1 + 1"}, true},
+		{"negative tolerance", QuestionSpec{Variables: []TemplateVariable{variable("a", 1, 2, 1)}, Formula: "a", Tolerance: -1}, true},
+		{"invalid name", QuestionSpec{Variables: []TemplateVariable{variable("1a", 1, 2, 1)}, Formula: "1"}, true},
+		{"function name", QuestionSpec{Variables: []TemplateVariable{variable("sqrt", 1, 2, 1)}, Formula: "1"}, true},
+		{"duplicated name", QuestionSpec{Variables: []TemplateVariable{variable("a", 1, 2, 1), variable("a", 3, 4, 1)}, Formula: "a"}, true},
+		{"min above max", QuestionSpec{Variables: []TemplateVariable{variable("a", 5, 1, 1)}, Formula: "a"}, true},
+		{"negative step", QuestionSpec{Variables: []TemplateVariable{variable("a", 1, 5, -1)}, Formula: "a"}, true},
+		{"too many values", QuestionSpec{Variables: []TemplateVariable{variable("a", 0, 1e9, 1)}, Formula: "a"}, true},
+		{"syntax error", QuestionSpec{Variables: []TemplateVariable{variable("a", 1, 2, 1)}, Formula: "a +"}, true},
+		{"undefined variable", QuestionSpec{Variables: []TemplateVariable{variable("a", 1, 2, 1)}, Formula: "a + b"}, true},
+		{"wrong argument count", QuestionSpec{Variables: []TemplateVariable{variable("a", 1, 2, 1)}, Formula: "max(a)"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTemplate(&tt.spec)
+			if tt.wantErr && !errors.Is(err, ErrInvalidQuestion) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidQuestion)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGenerateTemplateValues(t *testing.T) {
+	spec := QuestionSpec{
+		Variables: []TemplateVariable{{Name: "a", Min: 0, Max: 1, Step: 0.1}, {Name: "b", Min: 0, Max: 3}},
+		Formula:   "a / b", // b = 0 の値は選び直す
+	}
+	for i := 0; i < 100; i++ {
+		values, err := generateTemplateValues(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a := values["a"]; a < 0 || a > 1 || math.Abs(a*10-math.Round(a*10)) > 1e-9 {
+			t.Fatalf("a = %v, want a multiple of 0.1 in [0, 1]", a)
+		}
+		if b := values["b"]; b < 1 || b > 3 || b != math.Round(b) {
+			t.Fatalf("b = %v, want an integer in [1, 3]", b)
+		}
+	}
+}
+
+func TestGradeTemplate(t *testing.T) {
+	question := IDAnswer{
+		QuestionType: QuestionTypeTemplate,
+		Spec:         QuestionSpec{Formula: "a / b", Tolerance: 0.01},
+		Variables:    templateValues{"a": 1, "b": 3},
+	}
+	tests := []struct {
+		answer AnswerValue
+		want   bool
+	}{
+		{single("0.333"), true},
+		{single("０．３３"), true},
+		{single("0.3"), false},
+		{single("x"), false},
+		{list("0.333"), false},
+	}
+	for _, tt := range tests {
+		if got := gradeAnswer(question, tt.answer); got != tt.want {
+			t.Errorf("gradeAnswer(%v) = %v, want %v", tt.answer.Values, got, tt.want)
+		}
+	}
+	if got := correctAnswerOf(question).Single(); got != "0.333333333" {
+		t.Errorf("correct answer = %q, want %q", got, "0.333333333")
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	got := renderTemplate("{{a}} × {{b}} = ? ({{c}})", templateValues{"a": 1.5, "b": 2})
+	if want := "1.5 × 2 = ? ({{c}})"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,356 @@
+package question
+
+import (
+	"errors"
+	"maps"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// errInjected はテスト用のリポジトリが途中で返すエラー
+var errInjected = errors.New("injected failure")
+
+// memState はテスト用のリポジトリが保持するテーブルの内容
+type memState struct {
+	nextQuestionID int
+	questions      map[int]string // 問題ID -> 問題文
+	links          map[int]int    // 問題ID -> 問題集ID
+	sets           map[int]QuestionSetInfo
+	stars          map[int]bool
+	myStars        map[int]bool
+	myQuestions    map[int]bool
+	settings       map[int]bool
+	revisions      map[int]int // 問題集ID -> 保存したリビジョンの数
+}
+
+func newMemState() *memState {
+	return &memState{
+		questions:   map[int]string{},
+		links:       map[int]int{},
+		sets:        map[int]QuestionSetInfo{},
+		stars:       map[int]bool{},
+		myStars:     map[int]bool{},
+		myQuestions: map[int]bool{},
+		settings:    map[int]bool{},
+		revisions:   map[int]int{},
+	}
+}
+
+func (s *memState) clone() *memState {
+	return &memState{
+		nextQuestionID: s.nextQuestionID,
+		questions:      maps.Clone(s.questions),
+		links:          maps.Clone(s.links),
+		sets:           maps.Clone(s.sets),
+		stars:          maps.Clone(s.stars),
+		myStars:        maps.Clone(s.myStars),
+		myQuestions:    maps.Clone(s.myQuestions),
+		settings:       maps.Clone(s.settings),
+		revisions:      maps.Clone(s.revisions),
+	}
+}
+
+// memRepository は問題集の作成・修正・削除で使うメソッドだけを実装したメモリ上のリポジトリ
+// Transaction は状態のコピーに対して fn を実行し、エラーがなければコピーを反映する（エラーの場合は捨てる）
+// failOn に指定したメソッドは errInjected を返す
+type memRepository struct {
+	QuestionRepository // 実装していないメソッドを呼ぶと panic する
+	state              *memState
+	failOn             string
+}
+
+func (r *memRepository) fail(method string) error {
+	if r.failOn == method {
+		return errInjected
+	}
+	return nil
+}
+
+func (r *memRepository) Transaction(fn func(repo QuestionRepository) error) error {
+	tx := &memRepository{state: r.state.clone(), failOn: r.failOn}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	r.state = tx.state
+	return nil
+}
+
+func (r *memRepository) InsertQuestions(questions []InsertQuestion) error {
+	if err := r.fail("InsertQuestions"); err != nil {
+		return err
+	}
+	for i := range questions {
+		r.state.nextQuestionID++
+		questions[i].ID = r.state.nextQuestionID
+		r.state.questions[questions[i].ID] = questions[i].Question
+	}
+	return nil
+}
+
+func (r *memRepository) FixQuestions(questions []FixQuestion) error {
+	if err := r.fail("FixQuestions"); err != nil {
+		return err
+	}
+	for _, question := range questions {
+		r.state.questions[*question.ID] = question.Question
+	}
+	return nil
+}
+
+func (r *memRepository) GetQuestionIdsByQuestionSetId(questionSetID int) ([]int, error) {
+	var ids []int
+	for questionID, setID := range r.state.links {
+		if setID == questionSetID {
+			ids = append(ids, questionID)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (r *memRepository) GetNextSetID() (int, error) {
+	next := 1
+	for id := range r.state.sets {
+		if id >= next {
+			next = id + 1
+		}
+	}
+	return next, nil
+}
+
+func (r *memRepository) InsertQuestionSet(questionSets []QuestionSet) error {
+	if err := r.fail("InsertQuestionSet"); err != nil {
+		return err
+	}
+	for _, qs := range questionSets {
+		r.state.links[qs.QuestionID] = qs.SetID
+	}
+	return nil
+}
+
+func (r *memRepository) InsertQuestionSetInfo(info *QuestionSetInfo) error {
+	if err := r.fail("InsertQuestionSetInfo"); err != nil {
+		return err
+	}
+	r.state.sets[info.ID] = *info
+	return nil
+}
+
+func (r *memRepository) UpdateQuestionSetInfo(questionSetID int, fields QuestionSetFields, updatedAt time.Time) error {
+	if err := r.fail("UpdateQuestionSetInfo"); err != nil {
+		return err
+	}
+	info := r.state.sets[questionSetID]
+	info.QuestionSetFields = fields
+	info.UpdatedAt = updatedAt
+	r.state.sets[questionSetID] = info
+	return nil
+}
+
+func (r *memRepository) GetQuestionSetInfo(questionSetID int) (*QuestionSetInfo, error) {
+	info, ok := r.state.sets[questionSetID]
+	if !ok {
+		return nil, nil
+	}
+	return &info, nil
+}
+
+func (r *memRepository) GetQuestionSetOwner(questionSetID int) (string, error) {
+	return r.state.sets[questionSetID].UserID, nil
+}
+
+func (r *memRepository) DeleteQuestionSetInfo(questionSetID int) error {
+	if err := r.fail("DeleteQuestionSetInfo"); err != nil {
+		return err
+	}
+	delete(r.state.sets, questionSetID)
+	return nil
+}
+
+func (r *memRepository) IncrementQuestionSetRevision(questionSetID int) (int, error) {
+	info := r.state.sets[questionSetID]
+	info.Revision++
+	r.state.sets[questionSetID] = info
+	return info.Revision, nil
+}
+
+func (r *memRepository) GetQuestionsForRevision(questionSetID int) ([]RevisionQuestion, error) {
+	return nil, nil
+}
+
+func (r *memRepository) InsertQuestionSetRevision(revision *QuestionSetRevision) error {
+	if err := r.fail("InsertQuestionSetRevision"); err != nil {
+		return err
+	}
+	r.state.revisions[revision.QuestionSetID]++
+	return nil
+}
+
+func (r *memRepository) GetQuestionSetRevision(questionSetID, revision int) (*QuestionSetRevision, error) {
+	return nil, nil
+}
+
+func (r *memRepository) DeleteQuestionsByIds(ids []int) error {
+	if err := r.fail("DeleteQuestionsByIds"); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(r.state.questions, id)
+	}
+	return nil
+}
+
+func (r *memRepository) DeleteQuestionSetByIds(ids []int) error {
+	if err := r.fail("DeleteQuestionSetByIds"); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(r.state.links, id)
+	}
+	return nil
+}
+
+func (r *memRepository) GetDateByQuestionIds(questionIds []int) (*time.Time, error) {
+	return &time.Time{}, nil
+}
+
+func (r *memRepository) InsertStar(star Star) error {
+	if err := r.fail("InsertStar"); err != nil {
+		return err
+	}
+	r.state.stars[star.QuestionSetID] = true
+	return nil
+}
+
+func (r *memRepository) DeleteStarsByQuestionSetID(questionSetID int) error {
+	if err := r.fail("DeleteStarsByQuestionSetID"); err != nil {
+		return err
+	}
+	delete(r.state.stars, questionSetID)
+	return nil
+}
+
+func (r *memRepository) DeleteMyStarsByQuestionSetID(questionSetID int) error {
+	if err := r.fail("DeleteMyStarsByQuestionSetID"); err != nil {
+		return err
+	}
+	delete(r.state.myStars, questionSetID)
+	return nil
+}
+
+func (r *memRepository) DeleteMyQuestionsByQuestionSetID(questionSetID int) error {
+	if err := r.fail("DeleteMyQuestionsByQuestionSetID"); err != nil {
+		return err
+	}
+	delete(r.state.myQuestions, questionSetID)
+	return nil
+}
+
+func (r *memRepository) DeleteQuestionSetSettings(questionSetID int) error {
+	if err := r.fail("DeleteQuestionSetSettings"); err != nil {
+		return err
+	}
+	delete(r.state.settings, questionSetID)
+	return nil
+}
+
+const testOwner = "owner-1"
+
+func testFields() QuestionSetFields {
+	return QuestionSetFields{Title: "問題集", GenreID: 1, Visibility: VisibilityPublic}
+}
+
+func testInsertQuestions() []InsertQuestion {
+	return []InsertQuestion{
+		{UserID: testOwner, GenreID: 1, Question: "Q1", Answer: "a", Choices1: "b", Choices2: "c"},
+		{UserID: testOwner, GenreID: 1, Question: "Q2", Answer: "a", Choices1: "b", Choices2: "c"},
+	}
+}
+
+// seedQuestionSet は問題集を1つ作成したリポジトリを返す（マイ学習リストなどの関連する行も入れておく）
+func seedQuestionSet(t *testing.T) (*memRepository, QuestionService, int) {
+	t.Helper()
+	repo := &memRepository{state: newMemState()}
+	service := QuestionService{Repo: repo}
+	info, err := service.CreateQuestionSet(testOwner, testFields(), testInsertQuestions())
+	if err != nil {
+		t.Fatalf("CreateQuestionSet: %v", err)
+	}
+	repo.state.myStars[info.ID] = true
+	repo.state.myQuestions[info.ID] = true
+	repo.state.settings[info.ID] = true
+	return repo, service, info.ID
+}
+
+func assertUnchanged(t *testing.T, before, after *memState) {
+	t.Helper()
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("state changed after a failed transaction\nbefore: %+v\nafter:  %+v", before, after)
+	}
+}
+
+func TestCreateQuestionSetRollsBackOnFailure(t *testing.T) {
+	for _, method := range []string{"InsertQuestionSetInfo", "InsertQuestionSet", "InsertStar", "InsertQuestionSetRevision"} {
+		t.Run(method, func(t *testing.T) {
+			repo := &memRepository{state: newMemState(), failOn: method}
+			before := repo.state.clone()
+
+			_, err := QuestionService{Repo: repo}.CreateQuestionSet(testOwner, testFields(), testInsertQuestions())
+			if !errors.Is(err, errInjected) {
+				t.Fatalf("err = %v, want %v", err, errInjected)
+			}
+			assertUnchanged(t, before, repo.state)
+		})
+	}
+}
+
+func TestCreateQuestionSetCommits(t *testing.T) {
+	repo, _, setID := seedQuestionSet(t)
+
+	ids, _ := repo.GetQuestionIdsByQuestionSetId(setID)
+	if len(ids) != 2 || !repo.state.stars[setID] || repo.state.revisions[setID] != 1 {
+		t.Errorf("question set was not fully created: %+v", repo.state)
+	}
+}
+
+func TestFixQuestionSetRollsBackOnFailure(t *testing.T) {
+	for _, method := range []string{"UpdateQuestionSetInfo", "InsertQuestionSet", "DeleteQuestionSetByIds", "FixQuestions", "InsertQuestionSetRevision"} {
+		t.Run(method, func(t *testing.T) {
+			repo, service, setID := seedQuestionSet(t)
+			ids, _ := repo.GetQuestionIdsByQuestionSetId(setID)
+			repo.failOn = method
+			before := repo.state.clone()
+
+			// 1問目を修正し、2問目を削除して、新しい問題を追加する
+			fields := testFields()
+			fields.Title = "修正後の問題集"
+			questions := []FixQuestion{
+				{ID: &ids[0], GenreID: 1, Question: "Q1 (fixed)", Answer: "a", Choices1: "b", Choices2: "c"},
+				{GenreID: 1, Question: "Q3", Answer: "a", Choices1: "b", Choices2: "c"},
+			}
+			err := service.FixQuestionSet(setID, fields, questions, testOwner, false)
+			if !errors.Is(err, errInjected) {
+				t.Fatalf("err = %v, want %v", err, errInjected)
+			}
+			assertUnchanged(t, before, repo.state)
+		})
+	}
+}
+
+func TestDeleteQuestionSetRollsBackOnFailure(t *testing.T) {
+	for _, method := range []string{"DeleteQuestionSetByIds", "DeleteStarsByQuestionSetID", "DeleteMyQuestionsByQuestionSetID", "DeleteQuestionSetSettings", "DeleteQuestionSetInfo"} {
+		t.Run(method, func(t *testing.T) {
+			repo, service, setID := seedQuestionSet(t)
+			repo.failOn = method
+			before := repo.state.clone()
+
+			err := service.DeleteQuestionSet(testOwner, setID, false)
+			if !errors.Is(err, errInjected) {
+				t.Fatalf("err = %v, want %v", err, errInjected)
+			}
+			assertUnchanged(t, before, repo.state)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package user
+
+import (
+	"OnlineLearningWebApp/pkg/rbac"
+	"OnlineLearningWebApp/pkg/utils"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+)
+
+// ErrLastAdmin 最後の管理者から admin ロールを外そうとした場合に返す
+var ErrLastAdmin = errors.New("cannot revoke the last admin")
+
+// GetUserRoles ユーザーのロール一覧を取得（管理者用）
+func (u *UserHandler) GetUserRoles(c echo.Context) error {
+	targetUserID := c.QueryParam("user_id")
+	if targetUserID == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "user_id is required"})
+	}
+
+	roles, err := rbac.LoadUserRoles(u.DB, targetUserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"userId": targetUserID,
+		"roles":  roles,
+	})
+}
+
+// GrantRole ユーザーにロールを付与する（管理者用）
+// 反映されるのは、対象ユーザーが次にトークンをリフレッシュしたとき
+func (u *UserHandler) GrantRole(c echo.Context) error {
+	adminID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+	targetUserID := c.QueryParam("user_id")
+	role := c.QueryParam("role")
+	if targetUserID == "" || !rbac.IsValidRole(role) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid user_id or role"})
+	}
+
+	err = u.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Table("online_learning_users").Where("id = ?", targetUserID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		// ロールが未登録のユーザーは DefaultRoles 扱いなので、付与するロールと一緒に明示的に登録する
+		roles, err := rbac.LoadUserRoles(tx, targetUserID)
+		if err != nil {
+			return err
+		}
+		if err := rbac.MarkRolesManaged(tx, targetUserID); err != nil {
+			return err
+		}
+		var records []rbac.UserRole
+		for _, r := range append(roles, role) {
+			records = append(records, rbac.UserRole{UserID: targetUserID, Role: r, GrantedBy: adminID})
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&records).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "user not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	return u.GetUserRoles(c)
+}
+
+// RevokeRole ユーザーからロールを剥奪する（管理者用）
+func (u *UserHandler) RevokeRole(c echo.Context) error {
+	adminID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+	}
+	targetUserID := c.QueryParam("user_id")
+	role := c.QueryParam("role")
+	if targetUserID == "" || !rbac.IsValidRole(role) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid user_id or role"})
+	}
+
+	err = u.DB.Transaction(func(tx *gorm.DB) error {
+		// 管理者がいなくならないようにする
+		// 同時に別の管理者から剥奪された場合に備え、admin の行をロックしてから数える（FOR UPDATE は COUNT と併用できない）
+		if role == rbac.RoleAdmin {
+			var adminIDs []string
+			if err := tx.Model(&rbac.UserRole{}).
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("role = ?", rbac.RoleAdmin).
+				Pluck("user_id", &adminIDs).Error; err != nil {
+				return err
+			}
+			isAdmin := false
+			for _, id := range adminIDs {
+				if id == targetUserID {
+					isAdmin = true
+					break
+				}
+			}
+			// 対象ユーザーが admin でなければ剥奪しても管理者は減らない
+			if isAdmin && len(adminIDs) <= 1 {
+				return ErrLastAdmin
+			}
+		}
+
+		// ロールが未登録のユーザーは DefaultRoles 扱いなので、残すロールを明示的に登録する
+		// すべてのロールを剥奪した場合も DefaultRoles に戻らないよう、ロールを管理済みにする
+		roles, err := rbac.LoadUserRoles(tx, targetUserID)
+		if err != nil {
+			return err
+		}
+		if err := rbac.MarkRolesManaged(tx, targetUserID); err != nil {
+			return err
+		}
+		var records []rbac.UserRole
+		for _, r := range roles {
+			if r != role {
+				records = append(records, rbac.UserRole{UserID: targetUserID, Role: r, GrantedBy: adminID})
+			}
+		}
+		if len(records) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&records).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("user_id = ? AND role = ?", targetUserID, role).Delete(&rbac.UserRole{}).Error
+	})
+	if errors.Is(err, ErrLastAdmin) {
+		return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	return u.GetUserRoles(c)
+}
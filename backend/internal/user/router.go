@@ -2,6 +2,7 @@ package user
 
 import (
 	"OnlineLearningWebApp/pkg/middleware"
+	"OnlineLearningWebApp/pkg/rbac"
 	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
@@ -12,13 +13,27 @@ func UserRegisterRoutes(e *echo.Echo, db *gorm.DB, rdb *redis.Client) {
 
 	// 認証が必要なルート
 	protected := e.Group("/api")
-	protected.Use(middleware.JWTMiddleware) // JWT認証ミドルウェアを適用（この処理を抜けないと下にはいけない）
+	protected.Use(middleware.JWTMiddleware(rdb)) // JWT認証ミドルウェアを適用（この処理を抜けないと下にはいけない）
 
 	userHandler := NewUserHandler(db, rdb)
 
 	// ユーザー情報編集に対応した情報の取得
-	protected.GET("/GetUserInfo", userHandler.GetUserInfo)
+	protected.GET("/GetUserInfo", userHandler.GetUserInfo, middleware.RequirePermission(rbac.PermUserProfile))
 
 	// ユーザー情報編集の更新処理
-	protected.POST("/EditUserInfo", userHandler.EditUserInfo)
+	protected.POST("/EditUserInfo", userHandler.EditUserInfo, middleware.RequirePermission(rbac.PermUserProfile))
+
+	// 管理者用のルート（ロールの付与・剥奪）
+	admin := e.Group("/api/admin")
+	admin.Use(middleware.JWTMiddleware(rdb))
+	admin.Use(middleware.RequirePermission(rbac.PermRoleManage))
+
+	// ユーザーのロール一覧
+	admin.GET("/GetUserRoles", userHandler.GetUserRoles)
+
+	// ロールの付与
+	admin.POST("/GrantRole", userHandler.GrantRole)
+
+	// ロールの剥奪
+	admin.POST("/RevokeRole", userHandler.RevokeRole)
 }
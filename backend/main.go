@@ -18,10 +18,12 @@ func main() {
 
 	// CORSの設定
 	// AllowCredentials: true を設定することで、ブラウザが withCredentials: true のリクエストを許可できるようになる
+	// Idempotency-Key は書き込みAPIの再送対策、Idempotent-Replayed は保存済みのレスポンスを返したかを示す
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:     []string{"http://localhost:3000"}, // フロントエンドのURLを指定
 		AllowMethods:     []string{echo.GET, echo.POST, echo.PUT, echo.DELETE, echo.OPTIONS},
-		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
+		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, "Idempotency-Key"},
+		ExposeHeaders:    []string{"Idempotent-Replayed"},
 		AllowCredentials: true, // クッキーや認証情報を許可
 	}))
 
@@ -43,6 +45,10 @@ func main() {
 	notificationService := &notification.NotificationService{DB: db}
 	// 通知スケジューラを起動
 	notificationService.ScheduleNotifications()
+	// 期限切れのアテンプトを締め切るスケジューラを起動
+	question.ScheduleAttemptCleanup(db)
+	// 公開予約の問題集を公開するスケジューラを起動
+	question.SchedulePublishing(db)
 
 	// サーバー起動
 	log.Println("Server started on :8080")
@@ -0,0 +1,18 @@
+-- 外部プロバイダ（Google / GitHub / Microsoft / 汎用OIDC）のアカウントとユーザーの紐付け
+-- 1ユーザーに複数のプロバイダを紐付けられるようにする
+CREATE TABLE IF NOT EXISTS online_learning_user_identities (
+    provider   VARCHAR(50)  NOT NULL,
+    subject    VARCHAR(255) NOT NULL,
+    user_id    VARCHAR(255) NOT NULL REFERENCES online_learning_users (id) ON DELETE CASCADE,
+    email      TEXT,
+    created_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON online_learning_user_identities (user_id);
+
+-- 既存ユーザーはすべて Google ログインで作成されており、id が Google の sub になっている
+INSERT INTO online_learning_user_identities (provider, subject, user_id, email)
+SELECT 'google', u.id, u.id, u.email
+FROM online_learning_users u
+ON CONFLICT (provider, subject) DO NOTHING;
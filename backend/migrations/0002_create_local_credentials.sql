@@ -0,0 +1,9 @@
+-- メールアドレス・パスワードでログインするユーザーの認証情報
+-- ユーザー本体（online_learning_users）は Google 等でログインするユーザーと共通
+CREATE TABLE IF NOT EXISTS online_learning_local_credentials (
+    user_id             VARCHAR(255) PRIMARY KEY REFERENCES online_learning_users (id) ON DELETE CASCADE,
+    password_hash       TEXT         NOT NULL,
+    email_verified_at   TIMESTAMP,
+    password_updated_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at          TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
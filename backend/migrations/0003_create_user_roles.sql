@@ -0,0 +1,14 @@
+-- ユーザーごとのロール（learner / creator / moderator / admin）
+-- ロールが1件も登録されていないユーザーは learner + creator として扱う（pkg/rbac.DefaultRoles）
+CREATE TABLE IF NOT EXISTS online_learning_user_roles (
+    user_id    VARCHAR(255) NOT NULL REFERENCES online_learning_users (id) ON DELETE CASCADE,
+    role       VARCHAR(50)  NOT NULL CHECK (role IN ('learner', 'creator', 'moderator', 'admin')),
+    granted_by VARCHAR(255),
+    created_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_roles_role ON online_learning_user_roles (role);
+
+-- 最初の管理者は手動で登録する
+-- INSERT INTO online_learning_user_roles (user_id, role) VALUES ('<user_id>', 'admin'), ('<user_id>', 'learner'), ('<user_id>', 'creator');
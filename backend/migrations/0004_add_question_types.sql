@@ -0,0 +1,14 @@
+-- 問題の種類と種類ごとの設定（選択肢・複数正解・許容する回答・許容誤差など）
+-- 既存の問題は従来の3択（answer, choices1, choices2）として single_choice にする
+ALTER TABLE online_learning_questions
+    ADD COLUMN IF NOT EXISTS question_type VARCHAR(30) NOT NULL DEFAULT 'single_choice'
+        CHECK (question_type IN ('single_choice', 'multi_select', 'true_false', 'free_text', 'numeric', 'ordering')),
+    ADD COLUMN IF NOT EXISTS spec JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+UPDATE online_learning_questions
+SET spec = jsonb_build_object(
+        'options',
+        (SELECT COALESCE(jsonb_agg(c), '[]'::jsonb)
+         FROM unnest(ARRAY[answer, choices1, choices2]) AS c
+         WHERE c IS NOT NULL AND c <> ''))
+WHERE question_type = 'single_choice' AND spec = '{}'::jsonb;
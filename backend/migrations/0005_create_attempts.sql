@@ -0,0 +1,30 @@
+-- 回答履歴（アテンプト）
+-- 回答開始時に作成し、提出時に得点と提出日時を記録する（id はアテンプトトークンとしてフロントに渡す）
+-- 問題集を削除しても回答履歴は残す
+CREATE TABLE IF NOT EXISTS online_learning_attempts (
+    id              VARCHAR(36)  PRIMARY KEY,
+    user_id         VARCHAR(255) NOT NULL REFERENCES online_learning_users (id) ON DELETE CASCADE,
+    question_set_id INTEGER      NOT NULL,
+    kind            VARCHAR(30)  NOT NULL DEFAULT 'standard',
+    status          VARCHAR(30)  NOT NULL DEFAULT 'in_progress' CHECK (status IN ('in_progress', 'submitted')),
+    total_questions INTEGER      NOT NULL DEFAULT 0,
+    correct_count   INTEGER      NOT NULL DEFAULT 0,
+    score           DOUBLE PRECISION NOT NULL DEFAULT 0,
+    started_at      TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    submitted_at    TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_attempts_user_set ON online_learning_attempts (user_id, question_set_id, started_at DESC);
+
+-- アテンプトで出題した問題と、問題ごとの回答
+-- 出題時に作成し、回答した問題だけ user_answer / correct_answer / answered_at を記録する
+CREATE TABLE IF NOT EXISTS online_learning_attempt_responses (
+    attempt_id     VARCHAR(36) NOT NULL REFERENCES online_learning_attempts (id) ON DELETE CASCADE,
+    question_id    INTEGER     NOT NULL,
+    position       INTEGER     NOT NULL,
+    user_answer    JSONB,
+    correct_answer JSONB,
+    correct        BOOLEAN     NOT NULL DEFAULT FALSE,
+    answered_at    TIMESTAMP,
+    PRIMARY KEY (attempt_id, question_id)
+);
@@ -0,0 +1,20 @@
+-- ユーザー・問題ごとの復習状態（SM-2）
+-- 回答を提出するたびに更新し、due_at が来た問題を復習セッションで出題する
+CREATE TABLE IF NOT EXISTS online_learning_review_states (
+    user_id          VARCHAR(255)     NOT NULL REFERENCES online_learning_users (id) ON DELETE CASCADE,
+    question_id      INTEGER          NOT NULL REFERENCES online_learning_questions (id) ON DELETE CASCADE,
+    repetitions      INTEGER          NOT NULL DEFAULT 0,
+    ease_factor      DOUBLE PRECISION NOT NULL DEFAULT 2.5,
+    interval_days    INTEGER          NOT NULL DEFAULT 0,
+    lapses           INTEGER          NOT NULL DEFAULT 0,
+    due_at           TIMESTAMP        NOT NULL,
+    last_reviewed_at TIMESTAMP,
+    PRIMARY KEY (user_id, question_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_states_due ON online_learning_review_states (user_id, due_at);
+
+-- 復習のアテンプトは複数の問題集をまたぐため question_set_id を 0 にする
+ALTER TABLE online_learning_attempts DROP CONSTRAINT IF EXISTS online_learning_attempts_kind_check;
+ALTER TABLE online_learning_attempts
+    ADD CONSTRAINT online_learning_attempts_kind_check CHECK (kind IN ('standard', 'review'));
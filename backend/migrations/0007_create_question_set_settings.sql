@@ -0,0 +1,24 @@
+-- 問題集の設定（試験モードの制限時間など）
+-- レコードがない問題集は初期値（制限時間なし）として扱う
+CREATE TABLE IF NOT EXISTS online_learning_question_set_settings (
+    question_set_id    INTEGER   PRIMARY KEY,
+    time_limit_seconds INTEGER   NOT NULL DEFAULT 0 CHECK (time_limit_seconds >= 0),
+    updated_at         TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 試験モードの締め切りと所要時間
+ALTER TABLE online_learning_attempts
+    ADD COLUMN IF NOT EXISTS deadline_at      TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS duration_seconds INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE online_learning_attempts DROP CONSTRAINT IF EXISTS online_learning_attempts_kind_check;
+ALTER TABLE online_learning_attempts
+    ADD CONSTRAINT online_learning_attempts_kind_check CHECK (kind IN ('standard', 'review', 'exam'));
+
+ALTER TABLE online_learning_attempts DROP CONSTRAINT IF EXISTS online_learning_attempts_status_check;
+ALTER TABLE online_learning_attempts
+    ADD CONSTRAINT online_learning_attempts_status_check CHECK (status IN ('in_progress', 'submitted', 'expired'));
+
+-- 問題ごとに回答にかかった秒数
+ALTER TABLE online_learning_attempt_responses
+    ADD COLUMN IF NOT EXISTS time_spent_seconds INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+-- 回答の途中保存と再開
+-- 出題した選択肢の並び順（別の端末で再開しても同じ順番で表示する）と、途中保存した日時
+ALTER TABLE online_learning_attempt_responses
+    ADD COLUMN IF NOT EXISTS choices  JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS saved_at TIMESTAMP;
+
+-- 回答中のアテンプトの検索用（再開・期限切れの締め切り）
+CREATE INDEX IF NOT EXISTS idx_online_learning_attempts_active
+    ON online_learning_attempts (user_id, question_set_id, status, started_at DESC);
@@ -0,0 +1,8 @@
+-- 間違えた問題の練習
+ALTER TABLE online_learning_attempts DROP CONSTRAINT IF EXISTS online_learning_attempts_kind_check;
+ALTER TABLE online_learning_attempts
+    ADD CONSTRAINT online_learning_attempts_kind_check CHECK (kind IN ('standard', 'review', 'exam', 'practice'));
+
+-- 問題ごとの最後の回答の検索用
+CREATE INDEX IF NOT EXISTS idx_online_learning_attempt_responses_question
+    ON online_learning_attempt_responses (question_id, answered_at DESC);
@@ -0,0 +1,11 @@
+-- 模擬試験の条件（同じシード・条件で作り直せるようにアテンプトごとに保存する）
+CREATE TABLE IF NOT EXISTS online_learning_mock_exams (
+    attempt_id VARCHAR(36) PRIMARY KEY REFERENCES online_learning_attempts (id) ON DELETE CASCADE,
+    seed       BIGINT      NOT NULL,
+    difficulty VARCHAR(16) NOT NULL DEFAULT '' CHECK (difficulty IN ('', 'easy', 'medium', 'hard')),
+    sections   JSONB       NOT NULL DEFAULT '[]'
+);
+
+ALTER TABLE online_learning_attempts DROP CONSTRAINT IF EXISTS online_learning_attempts_kind_check;
+ALTER TABLE online_learning_attempts
+    ADD CONSTRAINT online_learning_attempts_kind_check CHECK (kind IN ('standard', 'review', 'exam', 'practice', 'mock_exam'));
@@ -0,0 +1,3 @@
+-- 採点に使った正規化後の回答（記述式・数値の問題のみ。結果画面に表示する）
+ALTER TABLE online_learning_attempt_responses
+    ADD COLUMN IF NOT EXISTS normalized_answer TEXT NOT NULL DEFAULT '';
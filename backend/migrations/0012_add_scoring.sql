@@ -0,0 +1,21 @@
+-- 配点・部分点と合否
+-- 問題ごとの配点（questions.spec の points）は出題時に attempt_responses.points に保存する
+ALTER TABLE online_learning_attempt_responses
+    ADD COLUMN IF NOT EXISTS points        INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS earned_points NUMERIC NOT NULL DEFAULT 0;
+
+ALTER TABLE online_learning_attempts
+    ADD COLUMN IF NOT EXISTS total_points   INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS earned_points  NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS pass_threshold NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS passed         BOOLEAN;
+
+-- 既存のアテンプトは1問1点として得点を埋める
+UPDATE online_learning_attempt_responses SET earned_points = 1 WHERE correct;
+UPDATE online_learning_attempts
+    SET total_points = total_questions, earned_points = correct_count
+    WHERE total_points = 0;
+
+-- 合格点（得点の割合。0 の場合は合否を判定しない）
+ALTER TABLE online_learning_question_set_settings
+    ADD COLUMN IF NOT EXISTS pass_threshold NUMERIC NOT NULL DEFAULT 0 CHECK (pass_threshold >= 0 AND pass_threshold <= 100);
@@ -0,0 +1,4 @@
+-- 問題プール（1回の回答で出題する問題数）と出題順のシャッフル
+ALTER TABLE online_learning_question_set_settings
+    ADD COLUMN IF NOT EXISTS draw_count        INTEGER NOT NULL DEFAULT 0 CHECK (draw_count >= 0),
+    ADD COLUMN IF NOT EXISTS shuffle_questions BOOLEAN NOT NULL DEFAULT FALSE;
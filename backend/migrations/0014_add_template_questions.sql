@@ -0,0 +1,9 @@
+-- テンプレート問題（変数と計算式は questions.spec に保存する）
+ALTER TABLE online_learning_questions DROP CONSTRAINT IF EXISTS online_learning_questions_question_type_check;
+ALTER TABLE online_learning_questions
+    ADD CONSTRAINT online_learning_questions_question_type_check
+        CHECK (question_type IN ('single_choice', 'multi_select', 'true_false', 'free_text', 'numeric', 'ordering', 'template'));
+
+-- アテンプトごとに選んだ変数の値（採点のときに同じ値で正解を計算する）
+ALTER TABLE online_learning_attempt_responses
+    ADD COLUMN IF NOT EXISTS variables JSONB;
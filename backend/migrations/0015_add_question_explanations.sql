@@ -0,0 +1,13 @@
+-- 問題の解説・参考リンク・ヒント
+ALTER TABLE online_learning_questions
+    ADD COLUMN IF NOT EXISTS explanation     TEXT    NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS reference_links JSONB   NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS hints           JSONB   NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS hint_penalty    NUMERIC NOT NULL DEFAULT 0 CHECK (hint_penalty >= 0 AND hint_penalty <= 1);
+
+-- 回答中に表示したヒントの数と、得点の割合（部分点。ヒントによる減点は含まない）
+ALTER TABLE online_learning_attempt_responses
+    ADD COLUMN IF NOT EXISTS hints_used INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS credit     NUMERIC NOT NULL DEFAULT 0;
+
+UPDATE online_learning_attempt_responses SET credit = 1 WHERE correct;
@@ -0,0 +1,4 @@
+-- 回答の自信度（未指定の場合は空文字）
+ALTER TABLE online_learning_attempt_responses
+    ADD COLUMN IF NOT EXISTS confidence VARCHAR(10) NOT NULL DEFAULT ''
+        CHECK (confidence IN ('', 'sure', 'unsure', 'guess'));
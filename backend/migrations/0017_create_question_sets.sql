@@ -0,0 +1,48 @@
+-- 問題集
+-- これまでは問題の行ごとにタイトル・公開範囲を持ち、online_learning_question_set の set_id で問題をまとめていた
+CREATE TABLE IF NOT EXISTS online_learning_question_sets (
+    id              INTEGER      PRIMARY KEY,
+    user_id         VARCHAR(255) NOT NULL REFERENCES online_learning_users (id) ON DELETE CASCADE,
+    title           VARCHAR(255) NOT NULL,
+    description     TEXT         NOT NULL DEFAULT '',
+    genre_id        INTEGER      NOT NULL REFERENCES online_learning_genres (id),
+    visibility      VARCHAR(20)  NOT NULL DEFAULT 'private' CHECK (visibility IN ('public', 'private')),
+    language        VARCHAR(10)  NOT NULL DEFAULT 'ja',
+    difficulty      VARCHAR(10)  NOT NULL DEFAULT '' CHECK (difficulty IN ('', 'easy', 'medium', 'hard')),
+    cover_image_url TEXT         NOT NULL DEFAULT '',
+    created_at      TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_question_sets_user ON online_learning_question_sets (user_id);
+CREATE INDEX IF NOT EXISTS idx_question_sets_genre_visibility ON online_learning_question_sets (genre_id, visibility);
+
+-- 既存の問題集を移行する
+-- 作成者・タイトル・ジャンルは先頭の問題から、公開範囲はすべての問題が public の場合のみ public にする
+INSERT INTO online_learning_question_sets (id, user_id, title, genre_id, visibility, created_at, updated_at)
+SELECT qs.set_id,
+       (ARRAY_AGG(q.user_id ORDER BY q.id))[1],
+       (ARRAY_AGG(q.title ORDER BY q.id))[1],
+       (ARRAY_AGG(qs.genre_id ORDER BY q.id))[1],
+       CASE WHEN BOOL_AND(q.visibility = 'public') THEN 'public' ELSE 'private' END,
+       MIN(q.created_at),
+       MAX(q.updated_at)
+FROM online_learning_question_set qs
+JOIN online_learning_questions q ON q.id = qs.question_id
+GROUP BY qs.set_id
+ON CONFLICT (id) DO NOTHING;
+
+-- 問題が残っていない問題集の対応を削除してから、外部キーを張る
+DELETE FROM online_learning_question_set qs
+WHERE NOT EXISTS (SELECT 1 FROM online_learning_question_sets s WHERE s.id = qs.set_id);
+
+ALTER TABLE online_learning_question_set DROP CONSTRAINT IF EXISTS online_learning_question_set_set_id_fkey;
+ALTER TABLE online_learning_question_set
+    ADD CONSTRAINT online_learning_question_set_set_id_fkey
+        FOREIGN KEY (set_id) REFERENCES online_learning_question_sets (id) ON DELETE CASCADE;
+
+-- 問題集の単位で持つようにした列を削除する
+ALTER TABLE online_learning_question_set DROP COLUMN IF EXISTS genre_id;
+ALTER TABLE online_learning_questions
+    DROP COLUMN IF EXISTS title,
+    DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,8 @@
+-- 問題集IDをシーケンスから採番する（MAX + 1 では同時に作成したときに同じIDになる）
+CREATE SEQUENCE IF NOT EXISTS online_learning_question_sets_id_seq OWNED BY online_learning_question_sets.id;
+
+SELECT setval('online_learning_question_sets_id_seq', COALESCE(MAX(id), 0) + 1, false)
+FROM online_learning_question_sets;
+
+ALTER TABLE online_learning_question_sets
+    ALTER COLUMN id SET DEFAULT nextval('online_learning_question_sets_id_seq');
@@ -0,0 +1,59 @@
+-- 問題集のリビジョン履歴
+-- 作成・修正・復元のたびに、問題集の項目とすべての問題をまとめて1つのリビジョンとして保存する
+ALTER TABLE online_learning_question_sets
+    ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS online_learning_question_set_revisions (
+    id              SERIAL       PRIMARY KEY,
+    question_set_id INTEGER      NOT NULL REFERENCES online_learning_question_sets (id) ON DELETE CASCADE,
+    revision        INTEGER      NOT NULL,
+    title           VARCHAR(255) NOT NULL,
+    description     TEXT         NOT NULL DEFAULT '',
+    genre_id        INTEGER      NOT NULL,
+    visibility      VARCHAR(20)  NOT NULL,
+    language        VARCHAR(10)  NOT NULL DEFAULT 'ja',
+    difficulty      VARCHAR(10)  NOT NULL DEFAULT '',
+    cover_image_url TEXT         NOT NULL DEFAULT '',
+    -- 問題（id, genreId, question, answer, choices1, choices2, questionType, spec, explanation, references, hints, hintPenalty）
+    questions       JSONB        NOT NULL DEFAULT '[]',
+    created_by      VARCHAR(255) NOT NULL,
+    -- 復元で作られたリビジョンの場合は、復元元のリビジョン
+    restored_from   INTEGER,
+    created_at      TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (question_set_id, revision)
+);
+
+-- 既存の問題集は、現在の内容をリビジョン1として保存する
+INSERT INTO online_learning_question_set_revisions
+    (question_set_id, revision, title, description, genre_id, visibility, language, difficulty, cover_image_url,
+     questions, created_by, created_at)
+SELECT st.id, 1, st.title, st.description, st.genre_id, st.visibility, st.language, st.difficulty, st.cover_image_url,
+       COALESCE((
+           SELECT jsonb_agg(jsonb_build_object(
+                      'id', q.id,
+                      'genreId', q.genre_id,
+                      'question', q.question,
+                      'answer', q.answer,
+                      'choices1', q.choices1,
+                      'choices2', q.choices2,
+                      'questionType', q.question_type,
+                      'spec', q.spec,
+                      'explanation', q.explanation,
+                      'references', q.reference_links,
+                      'hints', q.hints,
+                      'hintPenalty', q.hint_penalty
+                  ) ORDER BY q.id)
+           FROM online_learning_question_set qs
+           JOIN online_learning_questions q ON q.id = qs.question_id
+           WHERE qs.set_id = st.id
+       ), '[]'),
+       st.user_id, st.updated_at
+FROM online_learning_question_sets st
+WHERE st.revision = 0
+ON CONFLICT (question_set_id, revision) DO NOTHING;
+
+UPDATE online_learning_question_sets SET revision = 1 WHERE revision = 0;
+
+-- アテンプトには回答を開始した時点の問題集のリビジョンを記録する（問題集をまたぐアテンプトは 0）
+ALTER TABLE online_learning_attempts
+    ADD COLUMN IF NOT EXISTS revision INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,41 @@
+-- Web通知（画面の通知一覧に表示する。既読にするまで未読として残る）
+CREATE TABLE IF NOT EXISTS online_learning_notifications (
+    id              SERIAL       PRIMARY KEY,
+    user_id         VARCHAR(255) NOT NULL REFERENCES online_learning_users (id) ON DELETE CASCADE,
+    kind            VARCHAR(50)  NOT NULL,
+    question_set_id INTEGER      REFERENCES online_learning_question_sets (id) ON DELETE CASCADE,
+    title           VARCHAR(255) NOT NULL,
+    message         TEXT         NOT NULL DEFAULT '',
+    read_at         TIMESTAMP,
+    created_at      TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON online_learning_notifications (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_unread ON online_learning_notifications (user_id) WHERE read_at IS NULL;
+
+-- 問題集から削除された問題の正解記録を削除し、進捗率を計算し直す（これまでの修正で残っていたもの）
+DELETE FROM online_learning_correct_answers ca
+WHERE NOT EXISTS (
+    SELECT 1 FROM online_learning_question_set qs
+    WHERE qs.set_id = ca.question_set_id AND qs.question_id = ca.question_id
+);
+
+UPDATE online_learning_my_questions mq
+SET progress = LEAST(
+        (SELECT COUNT(*) FROM online_learning_correct_answers ca
+         WHERE ca.user_id = mq.user_id AND ca.question_set_id = mq.question_set_id)::float /
+        COALESCE(NULLIF(LEAST(
+            (SELECT s.draw_count FROM online_learning_question_set_settings s
+             WHERE s.question_set_id = mq.question_set_id),
+            (SELECT COUNT(*) FROM online_learning_question_set qs
+             WHERE qs.set_id = mq.question_set_id)
+        ), 0),
+            (SELECT COUNT(*) FROM online_learning_question_set qs
+             WHERE qs.set_id = mq.question_set_id)
+        ) * 100,
+        100)
+WHERE EXISTS (SELECT 1 FROM online_learning_question_set qs WHERE qs.set_id = mq.question_set_id);
+
+UPDATE online_learning_my_questions
+SET status = 'in_progress'
+WHERE status = 'completed' AND progress < 100;
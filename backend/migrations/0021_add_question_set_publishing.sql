@@ -0,0 +1,33 @@
+-- 問題集の公開の状態
+-- draft（下書き）/ private（非公開）/ unlisted（限定公開）/ scheduled（公開予約）/ public（公開）/ archived（アーカイブ）
+ALTER TABLE online_learning_question_sets DROP CONSTRAINT IF EXISTS online_learning_question_sets_visibility_check;
+ALTER TABLE online_learning_question_sets
+    ADD CONSTRAINT online_learning_question_sets_visibility_check
+        CHECK (visibility IN ('draft', 'private', 'unlisted', 'scheduled', 'public', 'archived'));
+
+-- 公開予約の日時（scheduled の場合は必須）と、限定公開の共有トークン（発行していない場合は空文字）
+ALTER TABLE online_learning_question_sets
+    ADD COLUMN IF NOT EXISTS publish_at  TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS share_token VARCHAR(64) NOT NULL DEFAULT '';
+
+ALTER TABLE online_learning_question_sets DROP CONSTRAINT IF EXISTS online_learning_question_sets_publish_at_check;
+ALTER TABLE online_learning_question_sets
+    ADD CONSTRAINT online_learning_question_sets_publish_at_check
+        CHECK (visibility <> 'scheduled' OR publish_at IS NOT NULL);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_question_sets_share_token
+    ON online_learning_question_sets (share_token) WHERE share_token <> '';
+CREATE INDEX IF NOT EXISTS idx_question_sets_scheduled
+    ON online_learning_question_sets (publish_at) WHERE visibility = 'scheduled';
+
+-- リビジョンにも公開予約の日時を保存する
+ALTER TABLE online_learning_question_set_revisions
+    ADD COLUMN IF NOT EXISTS publish_at TIMESTAMP;
+
+-- 限定公開の問題集の共有トークンを開いたユーザー（開いたユーザーは閲覧・回答できる）
+CREATE TABLE IF NOT EXISTS online_learning_question_set_shares (
+    question_set_id INTEGER      NOT NULL REFERENCES online_learning_question_sets (id) ON DELETE CASCADE,
+    user_id         VARCHAR(255) NOT NULL REFERENCES online_learning_users (id) ON DELETE CASCADE,
+    created_at      TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (question_set_id, user_id)
+);
@@ -0,0 +1,13 @@
+-- 模擬試験で出題した問題ID（出題順）
+-- 回答数や公開範囲が変わると同じシードでも候補の問題が変わるので、同じ試験を作り直すときはこの問題IDを使う
+ALTER TABLE online_learning_mock_exams
+    ADD COLUMN IF NOT EXISTS question_ids JSONB NOT NULL DEFAULT '[]';
+
+-- 作成済みの模擬試験は、出題した問題（アテンプトの回答）から埋める
+UPDATE online_learning_mock_exams m
+SET question_ids = COALESCE((SELECT jsonb_agg(r.question_id ORDER BY r.position)
+                             FROM online_learning_attempt_responses r
+                             WHERE r.attempt_id = m.attempt_id), '[]')
+WHERE m.question_ids = '[]';
+
+CREATE INDEX IF NOT EXISTS idx_mock_exams_seed ON online_learning_mock_exams (seed);
@@ -0,0 +1,9 @@
+-- ロールを管理者が付与・剥奪したユーザー
+-- 管理済みのユーザーはロールが1件もなくても DefaultRoles（learner + creator）に戻さず、ロールなしとして扱う
+ALTER TABLE online_learning_users
+    ADD COLUMN IF NOT EXISTS roles_managed BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- ロールを登録済みのユーザーは管理済みにする
+UPDATE online_learning_users u
+SET roles_managed = TRUE
+WHERE EXISTS (SELECT 1 FROM online_learning_user_roles r WHERE r.user_id = u.id);
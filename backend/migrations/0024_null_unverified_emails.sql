@@ -0,0 +1,9 @@
+-- 確認済みのメールアドレスがないユーザーは email を NULL にする
+-- 空文字のままだと users.email の一意制約で2人目以降が作成できない
+UPDATE online_learning_users
+SET email = NULL
+WHERE email = '';
+
+UPDATE online_learning_user_identities
+SET email = NULL
+WHERE email = '';
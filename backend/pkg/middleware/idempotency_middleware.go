@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"OnlineLearningWebApp/pkg/utils"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// IdempotencyKeyHeader クライアントがリクエストごとに付ける一意なキー
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader 保存したレスポンスを返した場合に付けるヘッダー
+	idempotentReplayedHeader = "Idempotent-Replayed"
+
+	// idempotencyTTL レスポンスを保存しておく期間
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyLockTTL 処理中のリクエストのロックの有効期間（処理中に落ちた場合でも再送できるようにする）
+	idempotencyLockTTL = time.Minute
+	// maxIdempotencyKeyLength キーの最大文字数
+	maxIdempotencyKeyLength = 255
+)
+
+// idempotencyRecord Redisに保存するリクエストの状態とレスポンス
+// idempotency:<user_id>:<method>:<path>:<key> -> idempotencyRecord
+type idempotencyRecord struct {
+	// 処理中の場合は true（レスポンスはまだない）
+	Processing  bool   `json:"processing"`
+	RequestHash string `json:"requestHash"`
+	StatusCode  int    `json:"statusCode,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+func idempotencyKey(userID, method, path, key string) string {
+	return "idempotency:" + userID + ":" + method + ":" + path + ":" + key
+}
+
+// Idempotency
+// Idempotency-Key ヘッダー付きのリクエストを1回だけ処理するミドルウェア（JWTMiddleware の後に使う）
+// 同じキーで再送されたリクエストは、ハンドラーを呼ばずに最初のレスポンスをそのまま返す
+// 同じキーで内容が違うリクエストは 422、最初のリクエストがまだ処理中の場合は 409 を返す
+// ヘッダーがないリクエストは通常どおり処理する。5xx のレスポンスは保存せず、同じキーで再試行できる
+func Idempotency(rdb *redis.Client) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": "Idempotency-Key is too long"})
+			}
+			userID, err := utils.GetUserIDFromContext(c)
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found"})
+			}
+
+			// リクエストの内容（クエリ文字列とボディ）のハッシュ。ボディはハンドラーで読めるように戻しておく
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": "failed to read request body"})
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+			sum := sha256.Sum256(append([]byte(c.Request().URL.RawQuery+"\n"), body...))
+			requestHash := hex.EncodeToString(sum[:])
+
+			ctx := c.Request().Context()
+			redisKey := idempotencyKey(userID, c.Request().Method, c.Path(), key)
+
+			// ① 処理中のロックを取る（すでにキーがある場合は、保存したレスポンスを確認する）
+			lock, err := json.Marshal(idempotencyRecord{Processing: true, RequestHash: requestHash})
+			if err != nil {
+				return err
+			}
+			acquired, err := rdb.SetNX(ctx, redisKey, lock, idempotencyLockTTL).Result()
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to check idempotency key"})
+			}
+			if !acquired {
+				return replayIdempotentResponse(c, rdb, redisKey, requestHash)
+			}
+
+			// ② ハンドラーを実行し、レスポンスを記録する
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			handlerErr := next(c)
+			if handlerErr != nil {
+				// エラーを Echo のエラーハンドラーに任せる場合は、レスポンスが確定しないので保存しない
+				rdb.Del(ctx, redisKey)
+				return handlerErr
+			}
+
+			// ③ 5xx 以外のレスポンスを保存する（5xx の場合はロックを外して再試行できるようにする）
+			status := c.Response().Status
+			if status >= http.StatusInternalServerError {
+				rdb.Del(ctx, redisKey)
+				return nil
+			}
+			record, err := json.Marshal(idempotencyRecord{
+				RequestHash: requestHash,
+				StatusCode:  status,
+				ContentType: c.Response().Header().Get(echo.HeaderContentType),
+				Body:        recorder.body.Bytes(),
+			})
+			if err == nil {
+				err = rdb.Set(ctx, redisKey, record, idempotencyTTL).Err()
+			}
+			if err != nil {
+				// レスポンスは返しているので、保存できなかった場合はロックを外すだけにする
+				rdb.Del(ctx, redisKey)
+			}
+			return nil
+		}
+	}
+}
+
+// replayIdempotentResponse は同じキーで保存されているレスポンスを返す
+func replayIdempotentResponse(c echo.Context, rdb *redis.Client, redisKey, requestHash string) error {
+	raw, err := rdb.Get(c.Request().Context(), redisKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// 確認している間にロックが外れた（最初のリクエストが 5xx で終わった）
+		return c.JSON(http.StatusConflict, echo.Map{"error": "request with this Idempotency-Key was not completed, please retry"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to check idempotency key"})
+	}
+	var record idempotencyRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to check idempotency key"})
+	}
+
+	if record.RequestHash != requestHash {
+		return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": "Idempotency-Key is already used for a different request"})
+	}
+	if record.Processing {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "request with this Idempotency-Key is in progress"})
+	}
+
+	c.Response().Header().Set(idempotentReplayedHeader, "true")
+	return c.Blob(record.StatusCode, record.ContentType, record.Body)
+}
+
+// responseRecorder はクライアントに書き込んだレスポンスボディを記録する
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
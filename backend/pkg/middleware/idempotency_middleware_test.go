@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// idempotencyServer は Idempotency を通したハンドラーを呼び出すテスト用のサーバー
+// ユーザーIDは X-User-ID ヘッダーで指定する（JWTMiddleware の代わり）
+type idempotencyServer struct {
+	e     *echo.Echo
+	calls int
+	// status はハンドラーが返すステータスコード（呼び出しごとに先頭から使い、最後の値を使い続ける）
+	status []int
+	// during はハンドラーの処理中に呼ぶ関数
+	during func()
+}
+
+func newIdempotencyServer(t *testing.T, status ...int) *idempotencyServer {
+	t.Helper()
+	s := &idempotencyServer{e: echo.New(), status: status}
+	setUser := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user_id", c.Request().Header.Get("X-User-ID"))
+			return next(c)
+		}
+	}
+	s.e.POST("/api/items", func(c echo.Context) error {
+		s.calls++
+		if s.during != nil {
+			during := s.during
+			s.during = nil
+			during()
+		}
+		status := s.status[min(s.calls, len(s.status))-1]
+		return c.JSON(status, echo.Map{"call": s.calls})
+	}, setUser, Idempotency(newTestRedis(t)))
+	return s
+}
+
+func (s *idempotencyServer) post(userID, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/items", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("X-User-ID", userID)
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	s := newIdempotencyServer(t, http.StatusCreated)
+
+	first := s.post("user-1", "key-1", `{"name":"a"}`)
+	second := s.post("user-1", "key-1", `{"name":"a"}`)
+
+	if s.calls != 1 {
+		t.Errorf("handler was called %d times, want 1", s.calls)
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Errorf("replayed %d %q, want %d %q", second.Code, second.Body, first.Code, first.Body)
+	}
+	if second.Header().Get(echo.HeaderContentType) != first.Header().Get(echo.HeaderContentType) {
+		t.Errorf("content type = %q, want %q", second.Header().Get(echo.HeaderContentType), first.Header().Get(echo.HeaderContentType))
+	}
+	if first.Header().Get(idempotentReplayedHeader) != "" || second.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("%s header = %q, %q; want \"\", \"true\"", idempotentReplayedHeader,
+			first.Header().Get(idempotentReplayedHeader), second.Header().Get(idempotentReplayedHeader))
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	tests := []struct {
+		name string
+		// requests は（ユーザーID、キー、ボディ）の順に送るリクエスト
+		requests  [][3]string
+		status    []int
+		wantCodes []int
+		wantCalls int
+	}{
+		{
+			name:      "without key",
+			requests:  [][3]string{{"user-1", "", `{}`}, {"user-1", "", `{}`}},
+			status:    []int{http.StatusCreated},
+			wantCodes: []int{http.StatusCreated, http.StatusCreated},
+			wantCalls: 2,
+		},
+		{
+			name:      "different request with the same key",
+			requests:  [][3]string{{"user-1", "key-1", `{"name":"a"}`}, {"user-1", "key-1", `{"name":"b"}`}},
+			status:    []int{http.StatusCreated},
+			wantCodes: []int{http.StatusCreated, http.StatusUnprocessableEntity},
+			wantCalls: 1,
+		},
+		{
+			name:      "keys are per user",
+			requests:  [][3]string{{"user-1", "key-1", `{}`}, {"user-2", "key-1", `{}`}},
+			status:    []int{http.StatusCreated},
+			wantCodes: []int{http.StatusCreated, http.StatusCreated},
+			wantCalls: 2,
+		},
+		{
+			name:      "4xx responses are replayed",
+			requests:  [][3]string{{"user-1", "key-1", `{}`}, {"user-1", "key-1", `{}`}},
+			status:    []int{http.StatusBadRequest, http.StatusCreated},
+			wantCodes: []int{http.StatusBadRequest, http.StatusBadRequest},
+			wantCalls: 1,
+		},
+		{
+			name:      "5xx responses can be retried",
+			requests:  [][3]string{{"user-1", "key-1", `{}`}, {"user-1", "key-1", `{}`}},
+			status:    []int{http.StatusInternalServerError, http.StatusCreated},
+			wantCodes: []int{http.StatusInternalServerError, http.StatusCreated},
+			wantCalls: 2,
+		},
+		{
+			name:      "key too long",
+			requests:  [][3]string{{"user-1", strings.Repeat("k", maxIdempotencyKeyLength+1), `{}`}},
+			status:    []int{http.StatusCreated},
+			wantCodes: []int{http.StatusBadRequest},
+			wantCalls: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newIdempotencyServer(t, tt.status...)
+			for i, r := range tt.requests {
+				if got := s.post(r[0], r[1], r[2]).Code; got != tt.wantCodes[i] {
+					t.Errorf("request %d: status = %d, want %d", i+1, got, tt.wantCodes[i])
+				}
+			}
+			if s.calls != tt.wantCalls {
+				t.Errorf("handler was called %d times, want %d", s.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// 最初のリクエストの処理中に同じキーで再送された場合は 409 を返す
+func TestIdempotencyRejectsConcurrentRequest(t *testing.T) {
+	s := newIdempotencyServer(t, http.StatusCreated)
+	var concurrent int
+	s.during = func() {
+		concurrent = s.post("user-1", "key-1", `{}`).Code
+	}
+
+	if got := s.post("user-1", "key-1", `{}`).Code; got != http.StatusCreated {
+		t.Errorf("status = %d, want %d", got, http.StatusCreated)
+	}
+	if concurrent != http.StatusConflict {
+		t.Errorf("concurrent request: status = %d, want %d", concurrent, http.StatusConflict)
+	}
+	if s.calls != 1 {
+		t.Errorf("handler was called %d times, want 1", s.calls)
+	}
+}
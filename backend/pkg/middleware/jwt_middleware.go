@@ -1,44 +1,64 @@
 package middleware
 
 import (
+	"OnlineLearningWebApp/pkg/session"
 	"OnlineLearningWebApp/pkg/utils"
-	"fmt"
 	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
 	"net/http"
-	"strings"
 )
 
 // JWTMiddleware
 // JWT 認証ミドルウェア
 // リクエストのAuthorizationヘッダーに含まれるJWTを検証し、ユーザーID（user_id）をcontextにセットする
-func JWTMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		// ① Authorization ヘッダーから JWT を取得
-		authHeader := c.Request().Header.Get("Authorization")
-		if authHeader == "" {
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "missing or invalid token"})
-		}
+// トークンが有効でも、ログアウト済み（セッション削除済み・失効リスト入り）の場合は弾く
+func JWTMiddleware(rdb *redis.Client) echo.MiddlewareFunc {
+	store := session.NewStore(rdb)
 
-		// ② "Bearer {token}" の形式をチェック
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token format"})
-		}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// ① Authorization ヘッダーから JWT を取得し、"Bearer {token}" の形式をチェック
+			tokenString, err := utils.ParseBearerToken(c.Request().Header.Get("Authorization"))
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "missing or invalid token"})
+			}
 
-		// ③ トークンの検証
-		claims, err := utils.ValidateToken(tokenParts[1])
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or expired token"})
-		}
+			// ② トークンの検証
+			claims, err := utils.ValidateToken(tokenString)
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or expired token"})
+			}
 
-		// ④ `user_id` を context にセット
-		userID := fmt.Sprintf("%v", claims["user_id"])
-		if userID == "" {
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token claims"})
-		}
-		c.Set("user_id", userID)
+			userID, _ := claims["user_id"].(string)
+			sessionID, _ := claims["sid"].(string)
+			jti, _ := claims["jti"].(string)
+			if userID == "" || sessionID == "" || jti == "" {
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token claims"})
+			}
 
-		// ⑤ 次のハンドラー (`GetAllGenres`) に処理を渡す
-		return next(c)
+			// ③ 失効リストとセッションの確認（ログアウト後のトークンを無効にする）
+			ctx := c.Request().Context()
+			revoked, err := store.IsAccessTokenRevoked(ctx, jti)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to verify token"})
+			}
+			active, err := store.IsSessionActive(ctx, sessionID, userID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to verify session"})
+			}
+			if revoked || !active {
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "token has been revoked"})
+			}
+
+			// ④ `user_id` などを context にセット
+			c.Set("user_id", userID)
+			c.Set("session_id", sessionID)
+			c.Set("jti", jti)
+			c.Set("roles", utils.RolesFromClaims(claims))
+			c.Set("token_exp", utils.TokenExpiry(claims))
+
+			// ⑤ 次のハンドラーに処理を渡す
+			return next(c)
+		}
 	}
 }
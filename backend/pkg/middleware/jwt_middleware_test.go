@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"OnlineLearningWebApp/pkg/session"
+	"OnlineLearningWebApp/pkg/utils"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+// serveWithJWT は JWTMiddleware を通してリクエストを処理し、ステータスコードを返す
+func serveWithJWT(t *testing.T, rdb *redis.Client, token string) int {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler := JWTMiddleware(rdb)(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	if err := handler(e.NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		// revoke はトークンの発行後に行う操作
+		revoke func(t *testing.T, store *session.Store, sessionID, token string)
+		want   int
+	}{
+		{
+			name: "active session",
+			want: http.StatusOK,
+		},
+		{
+			name: "revoked session",
+			revoke: func(t *testing.T, store *session.Store, sessionID, token string) {
+				if err := store.RevokeSession(ctx, sessionID); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "revoked access token",
+			revoke: func(t *testing.T, store *session.Store, sessionID, token string) {
+				claims, err := utils.ValidateToken(token)
+				if err != nil {
+					t.Fatal(err)
+				}
+				jti, _ := claims["jti"].(string)
+				if err := store.RevokeAccessToken(ctx, jti, time.Now().Add(utils.AccessTokenTTL)); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdb := newTestRedis(t)
+			store := session.NewStore(rdb)
+			sessionID, err := store.CreateSession(ctx, "user-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := utils.GenerateToken("user-1", sessionID, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.revoke != nil {
+				tt.revoke(t, store, sessionID, token)
+			}
+
+			if got := serveWithJWT(t, rdb, token); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTMiddlewareRejectsInvalidToken(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	rdb := newTestRedis(t)
+
+	for _, token := range []string{"", "not-a-jwt"} {
+		if got := serveWithJWT(t, rdb, token); got != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want %d", token, got, http.StatusUnauthorized)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"OnlineLearningWebApp/pkg/rbac"
+	"OnlineLearningWebApp/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// RequirePermission
+// 権限チェックミドルウェア（JWTMiddleware の後に使う）
+// JWT のロールが permissions のいずれも持っていない場合は 403 を返す
+func RequirePermission(permissions ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			roles := utils.GetRolesFromContext(c)
+			for _, permission := range permissions {
+				if rbac.HasPermission(roles, permission) {
+					return next(c)
+				}
+			}
+			return c.JSON(http.StatusForbidden, echo.Map{"error": "permission denied"})
+		}
+	}
+}
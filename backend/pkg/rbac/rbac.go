@@ -0,0 +1,130 @@
+package rbac
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ロール
+const (
+	RoleLearner   = "learner"   // 問題集を検索・回答する
+	RoleCreator   = "creator"   // 問題集を作成・修正する
+	RoleModerator = "moderator" // 他のユーザーの問題集を修正・削除できる
+	RoleAdmin     = "admin"     // ロールの付与・剥奪ができる
+)
+
+// 権限
+const (
+	PermQuestionRead      = "question:read"       // 問題集の検索・閲覧
+	PermQuestionAnswer    = "question:answer"     // 問題集の回答・マイ学習リスト・評価・お気に入り
+	PermQuestionCreate    = "question:create"     // 自分の問題集の作成・修正・削除
+	PermQuestionEditAny   = "question:edit_any"   // 他のユーザーの問題集の修正
+	PermQuestionDeleteAny = "question:delete_any" // 他のユーザーの問題集の削除
+	PermUserProfile       = "user:profile"        // 自分のユーザー情報の閲覧・編集
+	PermNotificationRead  = "notification:read"   // 自分宛ての通知の閲覧
+	PermRoleManage        = "role:manage"         // ロールの付与・剥奪
+)
+
+// DefaultRoles ロールが1つも登録されていないユーザーに与えるロール
+// RBAC 導入前と同じく、誰でも問題集を作成・回答できる
+// 管理者がロールを付与・剥奪したユーザー（roles_managed）は、登録がなければロールなしとして扱う
+var DefaultRoles = []string{RoleLearner, RoleCreator}
+
+// rolePermissions ロールごとの権限
+var rolePermissions = map[string][]string{
+	RoleLearner: {
+		PermQuestionRead,
+		PermQuestionAnswer,
+		PermUserProfile,
+		PermNotificationRead,
+	},
+	RoleCreator: {
+		PermQuestionRead,
+		PermQuestionCreate,
+		PermUserProfile,
+		PermNotificationRead,
+	},
+	RoleModerator: {
+		PermQuestionRead,
+		PermQuestionEditAny,
+		PermQuestionDeleteAny,
+		PermUserProfile,
+		PermNotificationRead,
+	},
+	RoleAdmin: {
+		PermQuestionRead,
+		PermQuestionAnswer,
+		PermQuestionCreate,
+		PermQuestionEditAny,
+		PermQuestionDeleteAny,
+		PermUserProfile,
+		PermNotificationRead,
+		PermRoleManage,
+	},
+}
+
+// IsValidRole は定義済みのロールかを返す
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission はロールのいずれかが権限を持っているかを返す
+func HasPermission(roles []string, permission string) bool {
+	for _, role := range roles {
+		for _, p := range rolePermissions[role] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UserRole ユーザーに付与されたロール
+type UserRole struct {
+	UserID    string    `json:"userId" gorm:"column:user_id;primaryKey;size:255"`
+	Role      string    `json:"role" gorm:"column:role;primaryKey;size:50"`
+	GrantedBy string    `json:"grantedBy" gorm:"column:granted_by;size:255"`
+	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at"`
+}
+
+// テーブル名を指定
+func (UserRole) TableName() string {
+	return "online_learning_user_roles"
+}
+
+// LoadUserRoles はユーザーのロールを取得する
+// 登録がなければ DefaultRoles を返す（ロールを管理済みのユーザーは空の配列を返す）
+func LoadUserRoles(db *gorm.DB, userID string) ([]string, error) {
+	roles := []string{}
+	if err := db.Model(&UserRole{}).
+		Where("user_id = ?", userID).
+		Order("role").
+		Pluck("role", &roles).Error; err != nil {
+		return nil, err
+	}
+	if len(roles) > 0 {
+		return roles, nil
+	}
+
+	var managed []bool
+	if err := db.Table("online_learning_users").
+		Where("id = ?", userID).
+		Limit(1).
+		Pluck("roles_managed", &managed).Error; err != nil {
+		return nil, err
+	}
+	if len(managed) > 0 && managed[0] {
+		return roles, nil
+	}
+	return append([]string(nil), DefaultRoles...), nil
+}
+
+// MarkRolesManaged はユーザーのロールを管理済みにする（以降はロールの登録がなくても DefaultRoles を与えない）
+func MarkRolesManaged(db *gorm.DB, userID string) error {
+	return db.Table("online_learning_users").
+		Where("id = ?", userID).
+		Update("roles_managed", true).Error
+}
@@ -9,7 +9,7 @@ import (
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Fatalf("failed to hash password: %v", err)
+		log.Printf("failed to hash password: %v", err)
 		return "", err
 	}
 	return string(bytes), nil
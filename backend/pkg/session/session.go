@@ -0,0 +1,238 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// RefreshTokenTTL はリフレッシュトークン（およびセッション）の有効期間
+const RefreshTokenTTL = 7 * 24 * time.Hour
+
+var (
+	// ErrRefreshTokenInvalid はリフレッシュトークンが存在しない・期限切れの場合に返す
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	// ErrRefreshTokenReused は使用済みのリフレッシュトークンが再度使われた場合に返す（ファミリーごと失効させる）
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// Redisのキー
+// session:<sid>              -> user_id（セッションが生きているか）
+// refresh_token:<hash>       -> refreshTokenRecord（トークン本体はハッシュ化して保存）
+// refresh_token_used:<hash>  -> 使用済みマーカー（再利用検知用）
+// session_tokens:<sid>       -> セッション（ファミリー）に属するトークンハッシュの集合
+// user_sessions:<user_id>    -> ユーザーのセッションIDの集合（パスワード変更時などに全セッションを失効させる）
+// revoked_jti:<jti>          -> 失効させたアクセストークン
+func sessionKey(sessionID string) string       { return "session:" + sessionID }
+func refreshKey(hash string) string            { return "refresh_token:" + hash }
+func refreshUsedKey(hash string) string        { return "refresh_token_used:" + hash }
+func sessionTokensKey(sessionID string) string { return "session_tokens:" + sessionID }
+func userSessionsKey(userID string) string     { return "user_sessions:" + userID }
+func revokedJTIKey(jti string) string          { return "revoked_jti:" + jti }
+
+type refreshTokenRecord struct {
+	UserID    string `json:"userId"`
+	SessionID string `json:"sessionId"`
+}
+
+// Store はセッションとリフレッシュトークンをRedisで管理する
+type Store struct {
+	RDB *redis.Client
+}
+
+// NewStore は Store を生成
+func NewStore(rdb *redis.Client) *Store {
+	return &Store{RDB: rdb}
+}
+
+// CreateSession は新しいセッションを作成し、セッションIDを返す
+// セッションIDはリフレッシュトークンのファミリーIDとしても使う
+func (s *Store) CreateSession(ctx context.Context, userID string) (string, error) {
+	sessionID := uuid.New().String()
+
+	pipe := s.RDB.TxPipeline()
+	pipe.Set(ctx, sessionKey(sessionID), userID, RefreshTokenTTL)
+	pipe.SAdd(ctx, userSessionsKey(userID), sessionID)
+	pipe.Expire(ctx, userSessionsKey(userID), RefreshTokenTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("failed to create session: %v", err)
+	}
+	return sessionID, nil
+}
+
+// IsSessionActive はセッションが有効で、かつ指定したユーザーのものであるかを確認する
+func (s *Store) IsSessionActive(ctx context.Context, sessionID, userID string) (bool, error) {
+	if sessionID == "" {
+		return false, nil
+	}
+	owner, err := s.RDB.Get(ctx, sessionKey(sessionID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return owner == userID, nil
+}
+
+// IssueRefreshToken はセッションに紐づくリフレッシュトークンを発行する
+func (s *Store) IssueRefreshToken(ctx context.Context, userID, sessionID string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	hash := HashToken(token)
+
+	record, err := json.Marshal(refreshTokenRecord{UserID: userID, SessionID: sessionID})
+	if err != nil {
+		return "", err
+	}
+
+	pipe := s.RDB.TxPipeline()
+	pipe.Set(ctx, refreshKey(hash), record, RefreshTokenTTL)
+	pipe.SAdd(ctx, sessionTokensKey(sessionID), hash)
+	pipe.Expire(ctx, sessionTokensKey(sessionID), RefreshTokenTTL)
+	// リフレッシュのたびにセッションと、ユーザーのセッション一覧の有効期限を延ばす
+	// （一覧が先に期限切れになると、パスワード変更時に失効させるセッションが漏れる）
+	pipe.Expire(ctx, sessionKey(sessionID), RefreshTokenTTL)
+	pipe.Expire(ctx, userSessionsKey(userID), RefreshTokenTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %v", err)
+	}
+	return token, nil
+}
+
+// LookupRefreshToken はリフレッシュトークン（使用前のもの）が属するユーザーとセッションを返す
+// トークンは使用済みにしない（ログアウト時に、セッションの持ち主であることを確認するために使う）
+func (s *Store) LookupRefreshToken(ctx context.Context, token string) (userID, sessionID string, err error) {
+	raw, err := s.RDB.Get(ctx, refreshKey(HashToken(token))).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", "", ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return "", "", err
+	}
+	var record refreshTokenRecord
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		return "", "", err
+	}
+	return record.UserID, record.SessionID, nil
+}
+
+// RotateRefreshToken はリフレッシュトークンを使用済みにして、同じセッションで新しいトークンを発行する
+// 使用済みのトークンが再度使われた場合は、盗用とみなしてセッション（ファミリー）ごと失効させる
+func (s *Store) RotateRefreshToken(ctx context.Context, token string) (userID, sessionID, newToken string, err error) {
+	hash := HashToken(token)
+
+	raw, err := s.RDB.Get(ctx, refreshKey(hash)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", "", "", ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+	var record refreshTokenRecord
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		return "", "", "", err
+	}
+
+	// SETNX で使用済みマーカーを立てる（すでに立っていれば再利用）
+	first, err := s.RDB.SetNX(ctx, refreshUsedKey(hash), 1, RefreshTokenTTL).Result()
+	if err != nil {
+		return "", "", "", err
+	}
+	if !first {
+		if err := s.RevokeSession(ctx, record.SessionID); err != nil {
+			return "", "", "", err
+		}
+		return "", "", "", ErrRefreshTokenReused
+	}
+
+	// ログアウト済みのセッションに属するトークンは使えない
+	active, err := s.IsSessionActive(ctx, record.SessionID, record.UserID)
+	if err != nil {
+		return "", "", "", err
+	}
+	if !active {
+		return "", "", "", ErrRefreshTokenInvalid
+	}
+
+	newToken, err = s.IssueRefreshToken(ctx, record.UserID, record.SessionID)
+	if err != nil {
+		return "", "", "", err
+	}
+	return record.UserID, record.SessionID, newToken, nil
+}
+
+// RevokeSession はセッションと、そのセッションに属するすべてのリフレッシュトークンを失効させる
+func (s *Store) RevokeSession(ctx context.Context, sessionID string) error {
+	hashes, err := s.RDB.SMembers(ctx, sessionTokensKey(sessionID)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	keys := []string{sessionKey(sessionID), sessionTokensKey(sessionID)}
+	for _, hash := range hashes {
+		keys = append(keys, refreshKey(hash))
+	}
+	if err := s.RDB.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("failed to revoke session: %v", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions はユーザーのすべてのセッションを失効させる（exceptSessionID は残す）
+// パスワードの変更・再設定時に、他の端末でのログインを無効にするために使う
+func (s *Store) RevokeUserSessions(ctx context.Context, userID, exceptSessionID string) error {
+	sessionIDs, err := s.RDB.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	for _, sessionID := range sessionIDs {
+		if sessionID == exceptSessionID {
+			continue
+		}
+		if err := s.RevokeSession(ctx, sessionID); err != nil {
+			return err
+		}
+		if err := s.RDB.SRem(ctx, userSessionsKey(userID), sessionID).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RevokeAccessToken はアクセストークン（jti）を有効期限まで失効リストに入れる
+func (s *Store) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+	return s.RDB.Set(ctx, revokedJTIKey(jti), 1, ttl).Err()
+}
+
+// IsAccessTokenRevoked はアクセストークン（jti）が失効リストに含まれているかを確認する
+func (s *Store) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := s.RDB.Exists(ctx, revokedJTIKey(jti)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// HashToken はトークンをRedisのキーにするためのハッシュを返す
+// トークン本体はRedisに保存せず、SHA-256のハッシュをキーにする
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
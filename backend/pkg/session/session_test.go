@@ -0,0 +1,194 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestStore(t *testing.T) (*Store, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewStore(rdb), mr
+}
+
+// newTestSession はセッションを作成して最初のリフレッシュトークンを発行する
+func newTestSession(t *testing.T, s *Store, userID string) (sessionID, token string) {
+	t.Helper()
+	ctx := context.Background()
+	sessionID, err := s.CreateSession(ctx, userID)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	token, err = s.IssueRefreshToken(ctx, userID, sessionID)
+	if err != nil {
+		t.Fatalf("IssueRefreshToken: %v", err)
+	}
+	return sessionID, token
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	sessionID, token := newTestSession(t, s, "user-1")
+
+	userID, gotSessionID, newToken, err := s.RotateRefreshToken(ctx, token)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	if userID != "user-1" || gotSessionID != sessionID {
+		t.Errorf("got (%q, %q), want (%q, %q)", userID, gotSessionID, "user-1", sessionID)
+	}
+	if newToken == "" || newToken == token {
+		t.Fatalf("new token = %q, want a different token", newToken)
+	}
+
+	// 新しいトークンは同じセッションで続けて使える
+	_, gotSessionID, _, err = s.RotateRefreshToken(ctx, newToken)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken(new token): %v", err)
+	}
+	if gotSessionID != sessionID {
+		t.Errorf("session = %q, want %q", gotSessionID, sessionID)
+	}
+}
+
+func TestRotateRefreshTokenRejectsUnknownToken(t *testing.T) {
+	s, _ := newTestStore(t)
+
+	_, _, _, err := s.RotateRefreshToken(context.Background(), "unknown")
+	if !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("err = %v, want %v", err, ErrRefreshTokenInvalid)
+	}
+}
+
+func TestRotateRefreshTokenRejectsExpiredToken(t *testing.T) {
+	s, mr := newTestStore(t)
+	_, token := newTestSession(t, s, "user-1")
+
+	mr.FastForward(RefreshTokenTTL + time.Second)
+	_, _, _, err := s.RotateRefreshToken(context.Background(), token)
+	if !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("err = %v, want %v", err, ErrRefreshTokenInvalid)
+	}
+}
+
+// 使用済みのトークンが再度使われたら、ファミリー（セッション）ごと失効させる
+func TestRotateRefreshTokenReuseRevokesFamily(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	sessionID, token := newTestSession(t, s, "user-1")
+	_, otherToken := newTestSession(t, s, "user-1")
+
+	_, _, newToken, err := s.RotateRefreshToken(ctx, token)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+
+	_, _, _, err = s.RotateRefreshToken(ctx, token)
+	if !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+
+	active, err := s.IsSessionActive(ctx, sessionID, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active {
+		t.Error("session is still active after token reuse")
+	}
+	// ローテーションで発行済みのトークンも使えない
+	if _, _, _, err := s.RotateRefreshToken(ctx, newToken); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("rotated token: err = %v, want %v", err, ErrRefreshTokenInvalid)
+	}
+	// 別のセッションには影響しない
+	if _, _, _, err := s.RotateRefreshToken(ctx, otherToken); err != nil {
+		t.Errorf("other session: %v", err)
+	}
+}
+
+func TestRotateRefreshTokenRejectsRevokedSession(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	sessionID, token := newTestSession(t, s, "user-1")
+
+	if err := s.RevokeSession(ctx, sessionID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if _, _, _, err := s.RotateRefreshToken(ctx, token); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("err = %v, want %v", err, ErrRefreshTokenInvalid)
+	}
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	current, _ := newTestSession(t, s, "user-1")
+	other, otherToken := newTestSession(t, s, "user-1")
+	anotherUser, _ := newTestSession(t, s, "user-2")
+
+	if err := s.RevokeUserSessions(ctx, "user-1", current); err != nil {
+		t.Fatalf("RevokeUserSessions: %v", err)
+	}
+
+	tests := []struct {
+		sessionID string
+		userID    string
+		want      bool
+	}{
+		{current, "user-1", true},
+		{other, "user-1", false},
+		{anotherUser, "user-2", true},
+	}
+	for _, tt := range tests {
+		active, err := s.IsSessionActive(ctx, tt.sessionID, tt.userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if active != tt.want {
+			t.Errorf("IsSessionActive(%s) = %v, want %v", tt.sessionID, active, tt.want)
+		}
+	}
+	if _, _, _, err := s.RotateRefreshToken(ctx, otherToken); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("err = %v, want %v", err, ErrRefreshTokenInvalid)
+	}
+}
+
+func TestIsSessionActiveChecksOwner(t *testing.T) {
+	s, _ := newTestStore(t)
+	sessionID, _ := newTestSession(t, s, "user-1")
+
+	active, err := s.IsSessionActive(context.Background(), sessionID, "user-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active {
+		t.Error("session of another user was reported as active")
+	}
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	s, mr := newTestStore(t)
+	ctx := context.Background()
+
+	if err := s.RevokeAccessToken(ctx, "jti-1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("RevokeAccessToken: %v", err)
+	}
+	revoked, err := s.IsAccessTokenRevoked(ctx, "jti-1")
+	if err != nil || !revoked {
+		t.Errorf("IsAccessTokenRevoked = %v, %v; want true", revoked, err)
+	}
+
+	// 有効期限を過ぎたら失効リストから消える
+	mr.FastForward(time.Minute + time.Second)
+	revoked, err = s.IsAccessTokenRevoked(ctx, "jti-1")
+	if err != nil || revoked {
+		t.Errorf("IsAccessTokenRevoked after expiry = %v, %v; want false", revoked, err)
+	}
+}
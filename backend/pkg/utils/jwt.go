@@ -3,16 +3,29 @@ package utils
 import (
 	"errors"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
-func GenerateToken(userID string) (string, error) {
+// AccessTokenTTL アクセストークンの有効期間（期限切れ後は /api/auth/refresh で再発行する）
+const AccessTokenTTL = 15 * time.Minute
+
+// GenerateToken アクセストークンを発行する
+// sid にはセッションIDを入れ、ミドルウェアでセッションが生きているかを確認できるようにする
+// roles は発行時点のロール（ロールの変更は次回のリフレッシュで反映される）
+func GenerateToken(userID, sessionID string, roles []string) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(7 * 24 * time.Hour).Unix(), // 1週間
+		"sid":     sessionID,
+		"roles":   roles,
+		"jti":     uuid.New().String(),
+		"iat":     now.Unix(),
+		"exp":     now.Add(AccessTokenTTL).Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
@@ -45,6 +58,49 @@ func ValidateToken(tokenString string) (jwt.MapClaims, error) {
 	return nil, errors.New("invalid token")
 }
 
+// ParseBearerToken Authorization ヘッダーの "Bearer {token}" からトークン部分を取り出す
+func ParseBearerToken(authHeader string) (string, error) {
+	if authHeader == "" {
+		return "", errors.New("missing token")
+	}
+	tokenParts := strings.Split(authHeader, " ")
+	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		return "", errors.New("invalid token format")
+	}
+	return tokenParts[1], nil
+}
+
+// TokenExpiry クレームから有効期限を取得する
+func TokenExpiry(claims jwt.MapClaims) time.Time {
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return time.Time{}
+	}
+	return exp.Time
+}
+
+// RolesFromClaims クレームからロールの一覧を取得する
+func RolesFromClaims(claims jwt.MapClaims) []string {
+	raw, ok := claims["roles"].([]interface{})
+	if !ok {
+		return nil
+	}
+	roles := make([]string, 0, len(raw))
+	for _, r := range raw {
+		if role, ok := r.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// GetRolesFromContext
+// JWTミドルウェアでセットされたロールを取得します
+func GetRolesFromContext(c echo.Context) []string {
+	roles, _ := c.Get("roles").([]string)
+	return roles
+}
+
 // GetUserIDFromContext
 // コンテキストから user_id を取得し、存在しない場合はエラーを返します
 func GetUserIDFromContext(c echo.Context) (string, error) {
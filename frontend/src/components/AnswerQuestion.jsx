@@ -6,7 +6,7 @@ import "../css/AnswerQuestion.css";
 import BackButton from "./BackButton";
 
 export default function AnswerQuestion() {
-  const getQuestionSet = useQuestion("getQuestionSet");
+  const startAttempt = useQuestion("startAttempt");
   const { id } = useParams();
   const submitQuestions = useQuestion("submit");
 
@@ -14,17 +14,20 @@ export default function AnswerQuestion() {
   const [errorMessage, setErrorMessage] = useState("");
   const [isSubmitting, setIsSubmitting] = useState(false); // 二重送信防止用
 
-  const [shuffledChoices, setShuffledChoices] = useState([]);
   const [selectedAnswers, setSelectedAnswers] = useState({});
   const questionRefs = useRef([]);
 
   const navigate = useNavigate();
 
-  // 問題集セットIDを元にデータを取得する
-  const { data: questions, isLoading } = useQuery({
-    queryKey: ["questions", { id }],
-    queryFn: () => getQuestionSet(id, "answer"),
+  // 問題集セットIDを元に回答を開始する（選択肢はサーバーでシャッフル済み）
+  // 再取得すると回答中のアテンプトが再開されるだけだが、不要なリクエストを送らないようにキャッシュしておく
+  const { data: delivery, isLoading } = useQuery({
+    queryKey: ["attempt", { id }],
+    queryFn: () => startAttempt(id),
+    staleTime: Infinity,
+    refetchOnWindowFocus: false,
   });
+  const questions = delivery?.questions;
 
   // 正誤判定を行うバックエンドに処理を流す
   const { mutate: submit } = useMutation({
@@ -52,23 +55,24 @@ export default function AnswerQuestion() {
   const handleSubmit = () => {
     if (isSubmitting) return; // すでに送信中なら処理しない
 
-    // questionSetIdと回答を送信する
-    submit({ questionSetId: id, questions: selectedAnswers });
+    // questionSetIdとアテンプトトークン、回答（問題ID → 回答）を送信する
+    submit({
+      questionSetId: id,
+      attemptToken: delivery.attemptToken,
+      answers: selectedAnswers,
+    });
   };
 
   useEffect(() => {
     if (questions) {
-      const shuffled = questions.map((q) => {
-        const choices = [q.answer, q.choices1, q.choices2];
-        const shuffledChoices = shuffleArray(choices);
-        return shuffledChoices;
-      });
-
-      setShuffledChoices(shuffled);
-
-      // 初期値として左端の選択肢をセット
-      const initialAnswers = questions.reduce((acc, q, index) => {
-        acc[q.id] = shuffled[index][0]; // 左端の選択肢
+      // 途中保存した回答があればそれを、なければ左端の選択肢を初期値にする
+      const initialAnswers = questions.reduce((acc, q) => {
+        const saved = delivery.savedAnswers?.[q.id];
+        if (saved !== undefined) {
+          acc[q.id] = saved;
+        } else if (q.choices?.length > 0) {
+          acc[q.id] = q.choices[0]; // 左端の選択肢
+        }
         return acc;
       }, {});
 
@@ -79,10 +83,6 @@ export default function AnswerQuestion() {
     }
   }, [questions]);
 
-  const shuffleArray = (array) => {
-    return array.sort(() => Math.random() - 0.5);
-  };
-
   const handleAnswerChange = (questionId, choice) => {
     setSelectedAnswers((prev) => ({
       ...prev,
@@ -146,7 +146,7 @@ export default function AnswerQuestion() {
             }}
             type="text"
           >
-            {!isLoading && questions[0]?.title}
+            {!isLoading && questions?.[0]?.title}
           </h1>
         </div>
         <div
@@ -166,7 +166,7 @@ export default function AnswerQuestion() {
             }}
             disabled={true}
           >
-            {!isLoading && questions[0]?.genreName}
+            {!isLoading && questions?.[0]?.genreName}
           </h1>
         </div>
       </div>
@@ -180,7 +180,20 @@ export default function AnswerQuestion() {
           >
             <h2 className="question-text">{q.question}</h2>
             <div className="choices">
-              {shuffledChoices[index]?.map((choice, i) => (
+              {/* 選択肢のない問題（記述式・数値）は入力欄で回答する */}
+              {!q.choices?.length && (
+                <input
+                  type="text"
+                  value={selectedAnswers[q.id] ?? ""}
+                  onChange={(e) =>
+                    setSelectedAnswers((prev) => ({
+                      ...prev,
+                      [q.id]: e.target.value,
+                    }))
+                  }
+                />
+              )}
+              {q.choices?.map((choice, i) => (
                 <label
                   key={i}
                   className={`choice-label ${
@@ -1,11 +1,22 @@
-import { googleAuthUrl } from "../utils/googleAuth";
+import { fetchAuthUrl } from "../utils/googleAuth";
 import { useNavigate } from "react-router-dom";
 import { useEffect } from "react";
+import useAxios from "../hooks/useAxios";
 import logo from "../common/images/logo.png";
 import "../css/GoogleLoginButton.css";
 
 const GoogleLoginButton = () => {
   const navigate = useNavigate();
+  const axios = useAxios();
+
+  // バックエンドで認可URLを作ってもらい、プロバイダのログイン画面に移動する
+  const handleLogin = async () => {
+    try {
+      window.location.href = await fetchAuthUrl(axios, "google");
+    } catch (error) {
+      // console.error("Failed to start login", error);
+    }
+  };
 
   // すでにログイン済みの場合、ログイン後の画面にリダイレクト
   // クッキーからセッションIDを取得
@@ -29,9 +40,11 @@ const GoogleLoginButton = () => {
       <div className="login-container">
         <img src={logo} alt="Logo" className="login-logo" />
         <h1 className="login-title">エコランにログイン</h1>
-        <a href={googleAuthUrl()} className="login-link">
-          <button className="login-button">Googleでログイン</button>
-        </a>
+        <div className="login-link">
+          <button className="login-button" onClick={handleLogin}>
+            Googleでログイン
+          </button>
+        </div>
       </div>
 
       <style>
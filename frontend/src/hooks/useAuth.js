@@ -7,15 +7,18 @@ export default function useAuth(action) {
   const axios = useAuthAxios();
   switch (action) {
     case "login":
-      return async (code) => Login(axios, code, setAuthState);
+      return async (code, state, provider) =>
+        Login(axios, code, state, provider, setAuthState);
     case "logout":
       return async () => Logout(axios, setAuthState);
   }
 }
 
-async function Login(axios, code, setAuthState) {
+async function Login(axios, code, state, provider, setAuthState) {
   try {
-    const res = await axios.post(`/auth/login?code=${code}`);
+    // state はバックエンドで検証され、PKCE の code_verifier と nonce の照合に使われる
+    const params = new URLSearchParams({ code, state });
+    const res = await axios.post(`/auth/${provider}/callback?${params}`);
 
     // Recoil にユーザー情報とトークンを保存
     setAuthState({
@@ -2,17 +2,64 @@ import axios from "axios";
 import { useRecoilState } from "recoil";
 import { authState } from "../recoils/authState";
 
+const baseURL = "http://localhost:8080/api/";
+
+// 実行中のリフレッシュ（同時に401になったリクエストで1回のリフレッシュを共有する）
+let refreshPromise = null;
+
+// リフレッシュトークン（HttpOnly クッキー）でアクセストークンを再発行する
+function refreshAccessToken() {
+  if (!refreshPromise) {
+    refreshPromise = axios
+      .post(`${baseURL}auth/refresh`, null, { withCredentials: true })
+      .then((res) => res.data.token)
+      .finally(() => {
+        refreshPromise = null;
+      });
+  }
+  return refreshPromise;
+}
+
 export default function useAxios() {
   const [auth, setAuthState] = useRecoilState(authState);
   const token = auth?.token; // JWTを取得（nullチェック）
 
   const ax = axios.create({
-    baseURL: "http://localhost:8080/api/",
+    baseURL,
     withCredentials: true, // クッキーを含める場合はtrue
     headers: {
       Authorization: token ? `Bearer ${token}` : "", // JWTをヘッダーにセット
     },
   });
 
+  // アクセストークンの期限切れ（401）はリフレッシュして1回だけリトライする
+  // リフレッシュにも失敗した場合はログアウト状態にする
+  ax.interceptors.response.use(
+    (res) => res,
+    async (error) => {
+      const config = error.config;
+      if (
+        error.response?.status !== 401 ||
+        !token ||
+        !config ||
+        config._retried
+      ) {
+        return Promise.reject(error);
+      }
+      config._retried = true;
+
+      let newToken;
+      try {
+        newToken = await refreshAccessToken();
+      } catch (refreshError) {
+        setAuthState({ user: null, token: null });
+        return Promise.reject(error);
+      }
+      setAuthState((prev) => ({ ...prev, token: newToken }));
+      config.headers.Authorization = `Bearer ${newToken}`;
+      return ax(config);
+    }
+  );
+
   return ax;
 }
@@ -40,6 +40,10 @@ export default function useQuestion(action) {
       return async (data) => {
         return fixQuestions(data, axios);
       };
+    case "startAttempt":
+      return async (questionSetId) => {
+        return startAttempt(questionSetId, axios);
+      };
     case "submit":
       return async (data) => {
         return submitQuestions(data, axios);
@@ -82,12 +86,26 @@ async function rating({ questionSetId, rating }, axios) {
   }
 }
 
-// 問題集回答で回答を提出する
-async function submitQuestions({ questionSetId, questions }, axios) {
+// 問題集の回答を開始する（正解を含まない問題とアテンプトトークンを取得する）
+// 回答中のアテンプトがある場合は、途中保存した回答（savedAnswers）とあわせて再開される
+async function startAttempt(questionSetId, axios) {
+  try {
+    const res = await axios.post(
+      `/StartAttempt?question_set_id=${questionSetId}`
+    );
+    return res.data;
+  } catch (error) {
+    // console.error("Error starting attempt", error);
+    throw error;
+  }
+}
+
+// 問題集回答で回答を提出する（answers は 問題ID → 回答 のマップ）
+async function submitQuestions({ questionSetId, attemptToken, answers }, axios) {
   try {
     const res = await axios.post(
       `/SubmitQuestions?question_set_id=${questionSetId}`,
-      questions
+      { attemptToken, answers }
     );
     return res.data;
   } catch (error) {
@@ -3,6 +3,7 @@ import React, { useEffect } from "react";
 import { useNavigate } from "react-router-dom";
 import useAuth from "../../hooks/useAuth";
 import LoadingMotion from "../../utils/LoadingMotion";
+import { takeAuthProvider } from "../../utils/googleAuth";
 
 const Callback = () => {
   const navigate = useNavigate();
@@ -11,9 +12,11 @@ const Callback = () => {
   useEffect(() => {
     const fetchAuthData = async () => {
       const urlParams = new URLSearchParams(window.location.search);
-      const code = urlParams.get("code"); // Googleから送信された認証コード（code）を取得
+      const code = urlParams.get("code"); // プロバイダから送信された認証コード（code）を取得
+      const state = urlParams.get("state"); // ログイン開始時にバックエンドが発行した state
+      const provider = takeAuthProvider();
 
-      if (!code) {
+      if (!code || !state) {
         // console.error("No authorization code found");
         navigate("/");
         return;
@@ -21,7 +24,7 @@ const Callback = () => {
 
       try {
         // login関数を使って認証コードでログイン処理を実行
-        await login(code);
+        await login(code, state, provider);
 
         // ログイン後、ウェルカムページにリダイレクト
         navigate("/welcome");
@@ -1,11 +1,18 @@
 // src/utils/googleAuth.js
-export const googleAuthUrl = () => {
-  const clientId =
-    "1011488123966-s8n27t0v2uh8j4jff352cmj9bbrm73qk.apps.googleusercontent.com"; // Google Client ID
-  const redirectUri = "http://localhost:3000/auth/callback"; // リダイレクトURL
-  const scope = "openid profile email"; // 必要なスコープ
+// ログインに使うプロバイダ（コールバック時にどのプロバイダのログインかを判別するために保存する）
+const PROVIDER_KEY = "oauth_provider";
 
-  const authUrl = `https://accounts.google.com/o/oauth2/v2/auth?client_id=${clientId}&redirect_uri=${redirectUri}&response_type=code&scope=${scope}`;
+// バックエンドから認可URLを取得する
+// state・PKCE・nonce はバックエンドで生成・保存され、認可URLに含まれる
+export const fetchAuthUrl = async (axios, provider = "google") => {
+  const res = await axios.get(`/auth/${provider}/start`);
+  sessionStorage.setItem(PROVIDER_KEY, provider);
+  return res.data.authUrl;
+};
 
-  return authUrl;
+// コールバック時にログイン中のプロバイダを取り出す
+export const takeAuthProvider = () => {
+  const provider = sessionStorage.getItem(PROVIDER_KEY) || "google";
+  sessionStorage.removeItem(PROVIDER_KEY);
+  return provider;
 };